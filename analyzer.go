@@ -11,6 +11,7 @@ package main
 import (
 	"fmt"
 	"math"
+	"strings"
 	"time"
 
 	log "github.com/couchbase/clog"
@@ -22,79 +23,313 @@ const (
 	percent = "%"
 )
 
-// Analyse the latest value of a stat for a particular node using
-// the alert thresholds
-func analyzeStat(stats *stats, node string, stat string,
-	eventChannel chan *widgets.Event) {
-
-	// Make a copy of the stat's threshold information to
-	// prevent using the lock multiple times
-	stats.statInfoLock.RLock()
-	statInfo := stats.statInfo[stat]
-	stats.statInfoLock.RUnlock()
+// Values of a stat the checks need, read while the node is locked
+type statValues struct {
+	// Latest value and the value MaxChangeTime seconds earlier
+	cur  float64
+	last float64
 
-	stats.bufferLock.RLock()
+	// Mean and deviation of the values before the latest one, see anomaly.go
+	mean float64
+	dev  float64
+}
 
-	length := len(stats.statBuffers[node][stat])
-	curVal := stats.statBuffers[node][stat][length-1]
-	lastTimeVal := math.NaN()
+// Latest value of a stat and its value MaxChangeTime seconds earlier,
+// NaN if the change is not checked or the sample is missing
+// Called with the lock of the node held
+func latestValues(stats *stats, buffer *ring[float64],
+	statInfo *configStatInfo) statValues {
+
+	length := buffer.len()
+	vals := statValues{
+		cur:  buffer.last(),
+		last: math.NaN(),
+		mean: math.NaN(),
+		dev:  math.NaN(),
+	}
 
 	// Check if max change can be calculated
 	// eg, cannot calculate change with only one valid value
-	if statInfo.MaxChangeTime <= length-1 &&
-		!math.IsNaN(statInfo.MaxChange) {
+	entries := stats.changeEntries(statInfo)
+	if entries <= length-1 && checksChange(statInfo) {
+
+		vals.last = buffer.at(length - 1 - entries)
+	}
+
+	if sensitivity, samples, method := stats.anomalySettings(
+		statInfo); sensitivity > 0 {
+
+		vals.mean, vals.dev = baseline(buffer, samples, method)
+	}
+
+	return vals
+}
+
+// Check the latest values of a stat, sampled at sampleTime, against the
+// alert thresholds
+func analyzeValues(stats *stats, node string, stat string,
+	statInfo *configStatInfo, sampleTime time.Time, vals statValues,
+	eventChannel chan *widgets.Event) {
+
+	curVal, lastTimeVal := vals.cur, vals.last
 
-		lastTimeVal =
-			stats.statBuffers[node][stat][length-1-statInfo.MaxChangeTime]
+	// Missing samples are never compared against the thresholds
+	if math.IsNaN(curVal) {
+		return
 	}
 
-	stats.bufferLock.RUnlock()
+	forTime := time.Duration(statInfo.For) * time.Second
 
 	// Check for minimum threshold
-	if curVal < statInfo.MinVal &&
-		!math.IsNaN(statInfo.MinVal) {
+	minClear := statInfo.MinClear
+	if math.IsNaN(minClear) {
+		minClear = statInfo.MinVal
+	}
+	if !math.IsNaN(statInfo.MinVal) {
+		if stats.sustained(
+			breachKey{node, stat, "Below Threshold"}, sampleTime, forTime,
+			curVal < statInfo.MinVal, curVal >= minClear,
+		) {
 
-		event := widgets.NewEvent(
-			node, stat, "Below Threshold", curVal, statInfo.MinVal,
-		)
+			event := widgets.NewEvent(
+				node, stat, "Below Threshold", curVal, statInfo.MinVal,
+			)
 
-		event.Description = makeDescription(event)
+			event.Description = makeDescription(event)
 
-		triggerEvent(event, eventChannel, stats)
+			triggerEvent(event, eventChannel, stats)
 
+		} else {
+			stats.resolve(
+				alertKey{node, stat, "Below Threshold", ""}, eventChannel,
+			)
+		}
 	}
 
 	// Check for maximum threshold
-	if curVal > statInfo.MaxVal &&
-		!math.IsNaN(statInfo.MaxVal) {
+	maxClear := statInfo.MaxClear
+	if math.IsNaN(maxClear) {
+		maxClear = statInfo.MaxVal
+	}
+	if !math.IsNaN(statInfo.MaxVal) {
+		if stats.sustained(
+			breachKey{node, stat, "Above Threshold"}, sampleTime, forTime,
+			curVal > statInfo.MaxVal, curVal <= maxClear,
+		) {
 
-		event := widgets.NewEvent(
-			node, stat, "Above Threshold", curVal, statInfo.MaxVal,
-		)
-		event.Description = makeDescription(event)
+			event := widgets.NewEvent(
+				node, stat, "Above Threshold", curVal, statInfo.MaxVal,
+			)
+			event.Description = makeDescription(event)
 
-		triggerEvent(event, eventChannel, stats)
+			triggerEvent(event, eventChannel, stats)
 
+		} else {
+			stats.resolve(
+				alertKey{node, stat, "Above Threshold", ""}, eventChannel,
+			)
+		}
 	}
 
 	// Check for maximum change
 	if !math.IsNaN(lastTimeVal) {
-		if math.Abs(curVal-lastTimeVal)/lastTimeVal >
-			statInfo.MaxChange &&
-			!math.IsNaN(statInfo.MaxChange) {
+		analyzeChange(
+			stats, node, stat, statInfo, curVal, lastTimeVal, eventChannel,
+		)
+	}
+
+	// Check for anomalies against the recent values
+	// A stat that held still has no deviation of its own
+	dev := math.Max(vals.dev, minAnomalyDev*math.Max(
+		math.Abs(vals.mean), math.Abs(curVal),
+	))
+	if sensitivity, _, _ := stats.anomalySettings(statInfo); sensitivity > 0 &&
+		!math.IsNaN(dev) && dev > 0 {
 
+		score := math.Abs(curVal-vals.mean) / dev
+		if score > sensitivity {
 			event := widgets.NewEvent(
-				node, stat, "Sudden Change", curVal,
-				statInfo.MaxChange,
+				node, stat, "Anomaly", curVal, sensitivity,
 			)
-			event.ThresholdChange = math.Abs(curVal-lastTimeVal) / lastTimeVal
-			event.ThresholdTime = statInfo.MaxChangeTime
+			event.ThresholdChange = score
+			event.Expected = vals.mean
 			event.Description = makeDescription(event)
 
 			triggerEvent(event, eventChannel, stats)
+		} else {
+			stats.resolve(alertKey{node, stat, "Anomaly", ""}, eventChannel)
+		}
+	}
+}
+
+// Whether any of the change thresholds is set, which all compare the
+// latest value with the one MaxChangeTime seconds earlier
+func checksChange(statInfo *configStatInfo) bool {
+	return !math.IsNaN(statInfo.MaxChange) || statInfo.MaxDelta > 0 ||
+		statInfo.MaxIncrease > 0 || statInfo.MaxDecrease > 0 ||
+		statInfo.MaxRate > 0
+}
+
+// Number of buffer entries MaxChangeTime covers, at least one if it is set
+func (stats *stats) changeEntries(statInfo *configStatInfo) int {
+
+	changeTime := time.Duration(statInfo.MaxChangeTime) * time.Second
+	entries := int(math.Round(
+		changeTime.Seconds() / stats.sampleInterval().Seconds(),
+	))
+	if entries < 1 && changeTime > 0 {
+		entries = 1
+	}
+
+	return entries
+}
+
+// Check the change from lastTimeVal to curVal against the change thresholds
+func analyzeChange(stats *stats, node string, stat string,
+	statInfo *configStatInfo, curVal float64, lastTimeVal float64,
+	eventChannel chan *widgets.Event) {
+
+	delta := curVal - lastTimeVal
+
+	check := func(eventType string, threshold float64, change float64) {
+		if change <= threshold {
+			stats.resolve(alertKey{node, stat, eventType, ""}, eventChannel)
+			return
+		}
+
+		event := widgets.NewEvent(node, stat, eventType, curVal, threshold)
+		event.ThresholdChange = change
+		event.ThresholdTime = stats.changeEntries(statInfo)
+		event.ChangeWindow = time.Duration(event.ThresholdTime) *
+			stats.sampleInterval()
+		event.Description = makeDescription(event)
+
+		triggerEvent(event, eventChannel, stats)
+	}
+
+	// A change from 0 has no relative size, only _max_delta and _max_rate
+	// can catch it
+	if lastTimeVal != 0 {
+		change := delta / math.Abs(lastTimeVal)
 
+		if !math.IsNaN(statInfo.MaxChange) {
+			check("Sudden Change", statInfo.MaxChange, math.Abs(change))
+		}
+		if statInfo.MaxIncrease > 0 {
+			check("Sudden Increase", statInfo.MaxIncrease, change)
 		}
+		if statInfo.MaxDecrease > 0 {
+			check("Sudden Decrease", statInfo.MaxDecrease, -change)
+		}
+	}
+
+	if statInfo.MaxDelta > 0 {
+		check("Sudden Delta", statInfo.MaxDelta, math.Abs(delta))
 	}
+
+	// Entries are an interval apart, gaps included
+	elapsed := time.Duration(stats.changeEntries(statInfo)) *
+		stats.sampleInterval()
+	if statInfo.MaxRate > 0 && elapsed > 0 {
+		check("Rate of Change", statInfo.MaxRate,
+			math.Abs(delta)/elapsed.Seconds())
+	}
+}
+
+// Alert of a node, the rule is only set for "Rule" alerts
+type alertKey struct {
+	node      string
+	stat      string
+	eventType string
+	rule      string
+}
+
+// Record that the condition of an alert held
+func (stats *stats) activate(key alertKey) {
+	stats.activeLock.Lock()
+	if stats.active == nil {
+		stats.active = make(map[alertKey]bool)
+	}
+	stats.active[key] = true
+	stats.activeLock.Unlock()
+}
+
+// Send the resolution of an alert whose condition no longer holds, nothing
+// is sent unless it held at the previous check
+func (stats *stats) resolve(key alertKey, eventChannel chan *widgets.Event) {
+
+	stats.activeLock.Lock()
+	active := stats.active[key]
+	delete(stats.active, key)
+	stats.activeLock.Unlock()
+
+	if !active {
+		return
+	}
+
+	event := widgets.NewEvent(
+		key.node, key.stat, key.eventType, math.NaN(), math.NaN(),
+	)
+	event.Rule = key.rule
+	event.State = widgets.StateResolved
+
+	eventChannel <- event
+}
+
+// Threshold of a stat being crossed by a node
+type breachKey struct {
+	node      string
+	stat      string
+	eventType string
+}
+
+type breach struct {
+	// Time of the first sample that crossed the threshold
+	since time.Time
+
+	// Whether the alert fired, after which it lasts until the value clears
+	firing bool
+}
+
+// Record whether a sample at sampleTime crossed a threshold or cleared it,
+// returning whether to alert
+// An alert fires once the threshold has been crossed for forTime and keeps
+// firing until the value clears, which is as soon as it is no longer crossed
+// unless a clear threshold is given
+func (stats *stats) sustained(key breachKey, sampleTime time.Time,
+	forTime time.Duration, crossed bool, cleared bool) bool {
+
+	stats.breachLock.Lock()
+	defer stats.breachLock.Unlock()
+
+	state, ok := stats.breaches[key]
+
+	switch {
+	case !ok:
+		if !crossed {
+			return false
+		}
+		if stats.breaches == nil {
+			stats.breaches = make(map[breachKey]*breach)
+		}
+		state = &breach{since: sampleTime}
+		stats.breaches[key] = state
+	case state.firing:
+		if cleared && !crossed {
+			delete(stats.breaches, key)
+			return false
+		}
+		return true
+	case !crossed:
+		delete(stats.breaches, key)
+		return false
+	}
+
+	if sampleTime.Sub(state.since) >= forTime {
+		state.firing = true
+	}
+
+	return state.firing
 }
 
 // Send the event to the event creation handler after basic checks
@@ -103,16 +338,28 @@ var triggerEvent = func(event *widgets.Event,
 	eventChannel chan *widgets.Event, stats *stats) {
 
 	switch event.EventType {
-	case "Sudden Change":
-		stats.timeLock.RLock()
-		index := len(stats.arrivalTimes[event.Node]) - event.ThresholdTime - 1
-		if !stats.arrivalTimes[event.Node][index].IsZero() {
-			eventChannel <- event
+	case "Sudden Change", "Sudden Increase", "Sudden Decrease",
+		"Sudden Delta", "Rate of Change":
+		series := stats.series(event.Node)
+		if series == nil {
+			return
+		}
+
+		// Only alert if the earlier value was received
+		series.lock.RLock()
+		index := series.times.len() - event.ThresholdTime - 1
+		known := !series.times.at(index).IsZero()
+		series.lock.RUnlock()
+
+		if !known {
+			return
 		}
-		stats.timeLock.RUnlock()
-	default:
-		eventChannel <- event
 	}
+
+	eventChannel <- event
+	stats.activate(
+		alertKey{event.Node, event.Stat, event.EventType, event.Rule},
+	)
 }
 
 // Handles incoming alerts. Adds to event display if alert is new, updates
@@ -124,6 +371,17 @@ func eventCreateHandler(eventChannel chan *widgets.Event,
 	// Main loop for event creation handling
 	for {
 		event := <-eventChannel
+
+		if event.State == widgets.StateResolved {
+			resolveEvent(event, eventDisplay)
+			continue
+		}
+
+		// Silenced alerts are neither shown nor counted
+		if stats.silences.silenced(event, widgets.Now()) {
+			continue
+		}
+
 		created := false
 
 		// Check if alert already exists
@@ -138,9 +396,11 @@ func eventCreateHandler(eventChannel chan *widgets.Event,
 			if event.Node == prevEvent.Node &&
 				event.Stat == prevEvent.Stat &&
 				event.EventType == prevEvent.EventType &&
+				event.Rule == prevEvent.Rule &&
 				event.LastTriggered.Before(eventTTL) &&
+				prevEvent.CurState() != widgets.StateExpired &&
 				!prevEvent.Deprecated &&
-				len(prevEvent.Data) < 300 {
+				!prevEvent.Full() {
 				updateEvent(prevEvent)
 				created = true
 				break
@@ -161,10 +421,30 @@ func eventCreateHandler(eventChannel chan *widgets.Event,
 	}
 }
 
+// Resolve the alerts the resolution is for that are still firing or
+// acknowledged
+func resolveEvent(resolution *widgets.Event,
+	eventDisplay *widgets.EventDisplay) {
+
+	eventDisplay.EventLock.Lock()
+	defer eventDisplay.EventLock.Unlock()
+
+	for _, event := range eventDisplay.Events {
+		if resolution.Node == event.Node &&
+			resolution.Stat == event.Stat &&
+			resolution.EventType == event.EventType &&
+			resolution.Rule == event.Rule {
+			event.SetState(widgets.StateResolved)
+		}
+	}
+}
+
 // Update existing alert with the latest alert
+// A resolved alert that triggers again is firing again
 func updateEvent(event *widgets.Event) {
-	event.AlertTimes = append(event.AlertTimes, time.Now())
-	event.LastTriggered = time.Now()
+	event.SetState(widgets.StateFiring)
+	event.AlertTimes = append(event.AlertTimes, widgets.Now())
+	event.LastTriggered = widgets.Now()
 	event.NumTimes++
 	event.Description = makeDescription(event)
 }
@@ -177,47 +457,41 @@ func createEvent(event *widgets.Event, stats *stats,
 		-time.Duration(*alerts["dataPadding"]) * time.Second,
 	)
 	event.DataStart = alertStartTime
-	startIndex := 0
-	event.AlertTimes = append(event.AlertTimes, time.Now())
+	event.MaxData = stats.historyLen
+	event.AlertTimes = append(event.AlertTimes, widgets.Now())
 
-	stats.timeLock.RLock()
-
-	if _, ok := stats.arrivalTimes[event.Node]; ok {
-		for i := len(stats.arrivalTimes[event.Node]) - 1; i >= 0; i-- {
-			if stats.arrivalTimes[event.Node][i].IsZero() {
-				if i != len(stats.arrivalTimes[event.Node])-1 {
-					startIndex = i + 1
-				}
-				break
-			} else if widgets.CompareTimes(
-				stats.arrivalTimes[event.Node][i], alertStartTime,
-			) {
-				startIndex = i
-				break
-			}
-		}
-
-		event.DataTimes = append(
-			event.DataTimes, stats.arrivalTimes[event.Node][startIndex:]...,
-		)
-	} else {
-		stats.timeLock.RUnlock()
+	// Nil if node gets deleted
+	series := stats.series(event.Node)
+	if series == nil {
 		return nil
 	}
 
-	stats.timeLock.RUnlock()
-
-	stats.bufferLock.RLock()
+	series.lock.RLock()
+	defer series.lock.RUnlock()
+
+	// Start from the sample at the start of the padding, or the oldest one
+	// if the padding goes back further
+	// Gaps after the start are kept so the report can show them
+	times := series.times
+	startIndex := times.len() - 1
+	for i := times.len() - 1; i >= 0; i-- {
+		if times.at(i).IsZero() {
+			continue
+		}
+		startIndex = i
+		if widgets.CompareTimes(times.at(i), alertStartTime) ||
+			times.at(i).Before(alertStartTime) {
+			break
+		}
+	}
 
-	if _, ok := stats.statBuffers[event.Node]; ok {
-		event.Data = append(
-			event.Data, stats.statBuffers[event.Node][event.Stat][startIndex:]...,
-		)
-	} else {
-		stats.bufferLock.RUnlock()
+	buffer, ok := series.buffers[event.Stat]
+	if !ok {
 		return nil
 	}
-	stats.bufferLock.RUnlock()
+
+	event.DataTimes = times.appendFrom(event.DataTimes, startIndex)
+	event.Data = buffer.appendFrom(event.Data, startIndex)
 
 	return event
 }
@@ -245,59 +519,49 @@ func updateEventData(eventDisplay *widgets.EventDisplay,
 		// Check if alert needs to be updated
 		// No updating alerts if node no longer in cluster
 		// or if alert already at full data capacity
-		if !event.DataFilled && len(event.Data) < 300 {
+		if !event.DataFilled && !event.Full() {
 
 			alertEndTime := event.LastTriggered.Add(
 				time.Duration(*alerts["dataPadding"]) * time.Second,
 			)
 
-			stats.timeLock.RLock()
+			series := stats.series(event.Node)
 
 			// Check if node still exists
-			if _, ok := stats.arrivalTimes[event.Node]; ok {
+			if series != nil {
+
+				series.lock.RLock()
 
 				var i int
 
+				times := series.times
 				lastUpdated := event.DataTimes[len(event.DataTimes)-1]
 
-				for i = len(stats.arrivalTimes[event.Node]) - 1; i >= 0; i-- {
-					if lastUpdated == stats.arrivalTimes[event.Node][i] {
-						break
-					}
-					if stats.arrivalTimes[event.Node][i].IsZero() {
-						i = -1
+				// Gaps since the last update are added like any sample
+				for i = times.len() - 1; i >= 0; i-- {
+					if lastUpdated == times.at(i) {
 						break
 					}
 				}
 
+				buffer, ok := series.buffers[event.Stat]
+				if !ok {
+					event.Deprecated = true
+					event.Description = makeDescription(event)
+					i = -1
+				}
+
 				if i >= 0 {
 					i++
-					for i < len(stats.arrivalTimes[event.Node]) {
-
-						stats.bufferLock.RLock()
-
-						if _, ok := stats.statBuffers[event.Node]; ok {
-							event.Data = append(
-								event.Data,
-								stats.statBuffers[event.Node][event.Stat][i],
-							)
-							stats.bufferLock.RUnlock()
-						} else {
-							event.Deprecated = true
-							event.Description = makeDescription(event)
-							stats.bufferLock.RUnlock()
-							break
-						}
+					for i < times.len() {
+
+						event.Data = append(event.Data, buffer.at(i))
 
 						// Update data arrival times
-						event.DataTimes = append(
-							event.DataTimes, stats.arrivalTimes[event.Node][i],
-						)
+						event.DataTimes = append(event.DataTimes, times.at(i))
 
 						// Check for alert fullness
-						if widgets.CompareTimes(
-							alertEndTime, stats.arrivalTimes[event.Node][i],
-						) {
+						if widgets.CompareTimes(alertEndTime, times.at(i)) {
 							event.DataFilled = true
 							break
 						}
@@ -305,14 +569,14 @@ func updateEventData(eventDisplay *widgets.EventDisplay,
 						i++
 					}
 				}
+
+				series.lock.RUnlock()
 			} else {
 				// Indicate that alert no longer needs updating
 				event.Deprecated = true
 				event.Description = makeDescription(event)
 			}
 
-			stats.timeLock.RUnlock()
-
 			// Check for alert fullness
 			if widgets.CompareTimes(
 				alertEndTime, event.DataTimes[len(event.DataTimes)-1],
@@ -320,8 +584,8 @@ func updateEventData(eventDisplay *widgets.EventDisplay,
 				event.DataFilled = true
 			}
 			// Remove event if triggered too frequently
-		} else if len(event.Data) >= 300 {
-			event.Stale = true
+		} else if event.Full() {
+			event.SetState(widgets.StateExpired)
 		}
 
 		eventTTL := event.LastTriggered.Add(
@@ -329,8 +593,11 @@ func updateEventData(eventDisplay *widgets.EventDisplay,
 		)
 
 		// Check for alert TTL
-		if time.Now().After(eventTTL) {
-			event.Stale = true
+		if widgets.Now().After(eventTTL) {
+			event.SetState(widgets.StateExpired)
+		}
+
+		if event.CurState() == widgets.StateExpired {
 			clean = false
 		}
 	}
@@ -358,7 +625,7 @@ func cleanEvents(eventDisplay *widgets.EventDisplay) []*widgets.Event {
 	deletedEvents := make([]*widgets.Event, 0)
 
 	for _, event := range eventDisplay.Events {
-		if event.Stale {
+		if event.CurState() == widgets.StateExpired {
 			deletedEvents = append(deletedEvents, event)
 		} else {
 			cleanEvents = append(cleanEvents, event)
@@ -389,10 +656,10 @@ func makeDescription(event *widgets.Event) string {
 			event.ThresholdData,
 			event.Threshold,
 		)
-	case "Sudden Change":
+	case "Sudden Change", "Sudden Increase", "Sudden Decrease":
 		description = fmt.Sprintf(
 			"%s:- %s:%s Event - %s, Value - %f, Threshold Value - %f"+
-				", Changed %f%s over %d seconds",
+				", Changed %f%s over %g seconds",
 			event.FirstTriggered.Format("2006-01-02 15:04:05"),
 			event.Node,
 			event.Stat,
@@ -401,8 +668,77 @@ func makeDescription(event *widgets.Event) string {
 			event.Threshold,
 			event.ThresholdChange,
 			percent,
-			event.ThresholdTime,
+			event.ChangeWindow.Seconds(),
+		)
+	case "Sudden Delta":
+		description = fmt.Sprintf(
+			"%s:- %s:%s Event - %s, Value - %f, Threshold Value - %f"+
+				", Changed by %f over %g seconds",
+			event.FirstTriggered.Format("2006-01-02 15:04:05"),
+			event.Node,
+			event.Stat,
+			event.EventType,
+			event.ThresholdData,
+			event.Threshold,
+			event.ThresholdChange,
+			event.ChangeWindow.Seconds(),
+		)
+	case "Rate of Change":
+		description = fmt.Sprintf(
+			"%s:- %s:%s Event - %s, Value - %f, Rate - %f/s"+
+				", Threshold Rate - %f/s, Over %g seconds",
+			event.FirstTriggered.Format("2006-01-02 15:04:05"),
+			event.Node,
+			event.Stat,
+			event.EventType,
+			event.ThresholdData,
+			event.ThresholdChange,
+			event.Threshold,
+			event.ChangeWindow.Seconds(),
+		)
+	case "Anomaly":
+		description = fmt.Sprintf(
+			"%s:- %s:%s Event - %s, Value - %f, Expected Value - %f"+
+				", Deviation - %.2f, Sensitivity - %.2f",
+			event.FirstTriggered.Format("2006-01-02 15:04:05"),
+			event.Node,
+			event.Stat,
+			event.EventType,
+			event.ThresholdData,
+			event.Expected,
+			event.ThresholdChange,
+			event.Threshold,
 		)
+	case "Node Outlier":
+		description = fmt.Sprintf(
+			"%s:- %s:%s Event - %s, Value - %f, Median of the Nodes - %f"+
+				", Ratio - %.2f, Threshold Factor - %.2f",
+			event.FirstTriggered.Format("2006-01-02 15:04:05"),
+			event.Node,
+			event.Stat,
+			event.EventType,
+			event.ThresholdData,
+			event.Expected,
+			event.ThresholdChange,
+			event.Threshold,
+		)
+	case "Rule":
+		description = fmt.Sprintf(
+			"%s:- %s:%s Event - Rule %s, Condition - %s, Severity - %s"+
+				", Value - %f, Threshold Value - %f",
+			event.FirstTriggered.Format("2006-01-02 15:04:05"),
+			event.Node,
+			event.Stat,
+			event.Rule,
+			event.Condition,
+			event.Severity,
+			event.ThresholdData,
+			event.Threshold,
+		)
+		if len(event.RuleStats) > 1 {
+			description = description + ", Stats - " +
+				strings.Join(event.RuleStats, ", ")
+		}
 	}
 
 	if event.NumTimes > 1 {
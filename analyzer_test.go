@@ -17,9 +17,55 @@ import (
 	"github.com/couchbaselabs/chronos/widgets"
 )
 
+// Stats of a test case, given as plain slices
+type testStats struct {
+	statBuffers  map[string]map[string][]float64
+	arrivalTimes map[string][]time.Time
+	statInfo     map[string]*configStatInfo
+}
+
+// Build the stats struct holding the data of the test case
+func (input *testStats) load() *stats {
+	stats := &stats{statInfo: input.statInfo}
+	setNodes(stats, input.statBuffers, input.arrivalTimes)
+	return stats
+}
+
+// Replace the data of every node with copies of the given slices
+func setNodes(stats *stats, statBuffers map[string]map[string][]float64,
+	arrivalTimes map[string][]time.Time) {
+
+	nodes := make(map[string]*nodeSeries)
+
+	getSeries := func(node string) *nodeSeries {
+		if _, ok := nodes[node]; !ok {
+			nodes[node] = &nodeSeries{
+				times:   newRing[time.Time](0),
+				buffers: make(map[string]*ring[float64]),
+			}
+		}
+		return nodes[node]
+	}
+
+	for node, buffers := range statBuffers {
+		series := getSeries(node)
+		for stat, buffer := range buffers {
+			series.buffers[stat] = ringOf(buffer)
+		}
+	}
+
+	for node, times := range arrivalTimes {
+		getSeries(node).times = ringOf(times)
+	}
+
+	stats.nodesLock.Lock()
+	stats.nodes = nodes
+	stats.nodesLock.Unlock()
+}
+
 func TestAnalyzer(t *testing.T) {
 
-	inputStats := []*stats{
+	inputStats := []*testStats{
 		{
 			statBuffers: map[string]map[string][]float64{
 				"node1": {
@@ -36,7 +82,6 @@ func TestAnalyzer(t *testing.T) {
 					MaxChangeTime: 1,
 				},
 			},
-			bufferLock: sync.RWMutex{},
 		},
 		{
 			statBuffers: map[string]map[string][]float64{
@@ -54,7 +99,6 @@ func TestAnalyzer(t *testing.T) {
 					MaxChangeTime: 1,
 				},
 			},
-			bufferLock: sync.RWMutex{},
 		},
 		{
 			statBuffers: map[string]map[string][]float64{
@@ -72,7 +116,6 @@ func TestAnalyzer(t *testing.T) {
 					MaxChangeTime: 1,
 				},
 			},
-			bufferLock: sync.RWMutex{},
 		},
 		{
 			statBuffers: map[string]map[string][]float64{
@@ -90,7 +133,6 @@ func TestAnalyzer(t *testing.T) {
 					MaxChangeTime: 1,
 				},
 			},
-			bufferLock: sync.RWMutex{},
 		},
 		{
 			statBuffers: map[string]map[string][]float64{
@@ -108,7 +150,6 @@ func TestAnalyzer(t *testing.T) {
 					MaxChangeTime: 1,
 				},
 			},
-			bufferLock: sync.RWMutex{},
 		},
 		{
 			statBuffers: map[string]map[string][]float64{
@@ -126,7 +167,6 @@ func TestAnalyzer(t *testing.T) {
 					MaxChangeTime: 1,
 				},
 			},
-			bufferLock: sync.RWMutex{},
 		},
 		{
 			statBuffers: map[string]map[string][]float64{
@@ -144,7 +184,6 @@ func TestAnalyzer(t *testing.T) {
 					MaxChangeTime: 1,
 				},
 			},
-			bufferLock: sync.RWMutex{},
 		},
 		{
 			statBuffers: map[string]map[string][]float64{
@@ -162,7 +201,6 @@ func TestAnalyzer(t *testing.T) {
 					MaxChangeTime: 1,
 				},
 			},
-			bufferLock: sync.RWMutex{},
 		},
 		{
 			statBuffers: map[string]map[string][]float64{
@@ -180,7 +218,6 @@ func TestAnalyzer(t *testing.T) {
 					MaxChangeTime: 1,
 				},
 			},
-			bufferLock: sync.RWMutex{},
 		},
 		{
 			statBuffers: map[string]map[string][]float64{
@@ -198,7 +235,6 @@ func TestAnalyzer(t *testing.T) {
 					MaxChangeTime: 1,
 				},
 			},
-			bufferLock: sync.RWMutex{},
 		},
 		{
 			statBuffers: map[string]map[string][]float64{
@@ -216,7 +252,6 @@ func TestAnalyzer(t *testing.T) {
 					MaxChangeTime: 0,
 				},
 			},
-			bufferLock: sync.RWMutex{},
 		},
 		{
 			statBuffers: map[string]map[string][]float64{
@@ -234,7 +269,6 @@ func TestAnalyzer(t *testing.T) {
 					MaxChangeTime: 1,
 				},
 			},
-			bufferLock: sync.RWMutex{},
 		},
 		{
 			statBuffers: map[string]map[string][]float64{
@@ -252,7 +286,6 @@ func TestAnalyzer(t *testing.T) {
 					MaxChangeTime: 2,
 				},
 			},
-			bufferLock: sync.RWMutex{},
 		},
 		{
 			statBuffers: map[string]map[string][]float64{
@@ -270,7 +303,6 @@ func TestAnalyzer(t *testing.T) {
 					MaxChangeTime: 6,
 				},
 			},
-			bufferLock: sync.RWMutex{},
 		},
 		{
 			statBuffers: map[string]map[string][]float64{
@@ -288,7 +320,6 @@ func TestAnalyzer(t *testing.T) {
 					MaxChangeTime: 7,
 				},
 			},
-			bufferLock: sync.RWMutex{},
 		},
 		{
 			statBuffers: map[string]map[string][]float64{
@@ -306,7 +337,6 @@ func TestAnalyzer(t *testing.T) {
 					MaxChangeTime: 8,
 				},
 			},
-			bufferLock: sync.RWMutex{},
 		},
 		{
 			statBuffers: map[string]map[string][]float64{
@@ -324,7 +354,6 @@ func TestAnalyzer(t *testing.T) {
 					MaxChangeTime: 1,
 				},
 			},
-			bufferLock: sync.RWMutex{},
 		},
 		{
 			statBuffers: map[string]map[string][]float64{
@@ -342,7 +371,6 @@ func TestAnalyzer(t *testing.T) {
 					MaxChangeTime: 1,
 				},
 			},
-			bufferLock: sync.RWMutex{},
 		},
 		{
 			statBuffers: map[string]map[string][]float64{
@@ -360,7 +388,6 @@ func TestAnalyzer(t *testing.T) {
 					MaxChangeTime: 1,
 				},
 			},
-			bufferLock: sync.RWMutex{},
 		},
 		{
 			statBuffers: map[string]map[string][]float64{
@@ -378,7 +405,6 @@ func TestAnalyzer(t *testing.T) {
 					MaxChangeTime: 1,
 				},
 			},
-			bufferLock: sync.RWMutex{},
 		},
 		{
 			statBuffers: map[string]map[string][]float64{
@@ -396,7 +422,6 @@ func TestAnalyzer(t *testing.T) {
 					MaxChangeTime: 1,
 				},
 			},
-			bufferLock: sync.RWMutex{},
 		},
 		{
 			statBuffers: map[string]map[string][]float64{
@@ -414,7 +439,6 @@ func TestAnalyzer(t *testing.T) {
 					MaxChangeTime: 1,
 				},
 			},
-			bufferLock: sync.RWMutex{},
 		},
 	}
 
@@ -648,9 +672,23 @@ func TestAnalyzer(t *testing.T) {
 		events = append(events, event)
 	}
 
-	for i, stats := range inputStats {
+	for i, input := range inputStats {
+
+		// Read and checked the way a poll does for the newest chunk
+		stats := input.load()
+		statInfo := stats.statInfo[inputStat[i]]
+		series := stats.series(inputNode[i])
 
-		analyzeStat(stats, inputNode[i], inputStat[i], nil)
+		series.lock.RLock()
+		vals := latestValues(
+			stats, series.buffers[inputStat[i]], statInfo,
+		)
+		series.lock.RUnlock()
+
+		analyzeValues(
+			stats, inputNode[i], inputStat[i], statInfo, time.Time{}, vals,
+			nil,
+		)
 
 		correct := true
 		if len(events) == len(outputEvents[i]) {
@@ -691,7 +729,7 @@ func TestTriggerEvent(t *testing.T) {
 	eventChannel := make(chan *widgets.Event)
 	testCases := []struct {
 		event *widgets.Event
-		stat  *stats
+		stat  *testStats
 		count int
 	}{
 		{
@@ -700,8 +738,7 @@ func TestTriggerEvent(t *testing.T) {
 				EventType:     "Above Threshold",
 				ThresholdTime: 0,
 			},
-			stat: &stats{
-				timeLock: sync.RWMutex{},
+			stat: &testStats{
 				arrivalTimes: map[string][]time.Time{
 					"node1": {
 						time.Time{}, time.Time{}, time.Now(),
@@ -716,8 +753,7 @@ func TestTriggerEvent(t *testing.T) {
 				EventType:     "Above Threshold",
 				ThresholdTime: 0,
 			},
-			stat: &stats{
-				timeLock: sync.RWMutex{},
+			stat: &testStats{
 				arrivalTimes: map[string][]time.Time{
 					"node2": {
 						time.Time{}, time.Now(), time.Now(),
@@ -732,8 +768,7 @@ func TestTriggerEvent(t *testing.T) {
 				EventType:     "Above Threshold",
 				ThresholdTime: 0,
 			},
-			stat: &stats{
-				timeLock: sync.RWMutex{},
+			stat: &testStats{
 				arrivalTimes: map[string][]time.Time{
 					"node3": {
 						time.Now(), time.Now(), time.Now(),
@@ -748,8 +783,7 @@ func TestTriggerEvent(t *testing.T) {
 				EventType:     "Above Threshold",
 				ThresholdTime: 1,
 			},
-			stat: &stats{
-				timeLock: sync.RWMutex{},
+			stat: &testStats{
 				arrivalTimes: map[string][]time.Time{
 					"node4": {
 						time.Time{}, time.Time{}, time.Now(),
@@ -764,8 +798,7 @@ func TestTriggerEvent(t *testing.T) {
 				EventType:     "Above Threshold",
 				ThresholdTime: 1,
 			},
-			stat: &stats{
-				timeLock: sync.RWMutex{},
+			stat: &testStats{
 				arrivalTimes: map[string][]time.Time{
 					"node5": {
 						time.Time{}, time.Now(), time.Now(),
@@ -780,8 +813,7 @@ func TestTriggerEvent(t *testing.T) {
 				EventType:     "Above Threshold",
 				ThresholdTime: 1,
 			},
-			stat: &stats{
-				timeLock: sync.RWMutex{},
+			stat: &testStats{
 				arrivalTimes: map[string][]time.Time{
 					"node6": {
 						time.Now(), time.Now(), time.Now(),
@@ -796,8 +828,7 @@ func TestTriggerEvent(t *testing.T) {
 				EventType:     "Above Threshold",
 				ThresholdTime: 2,
 			},
-			stat: &stats{
-				timeLock: sync.RWMutex{},
+			stat: &testStats{
 				arrivalTimes: map[string][]time.Time{
 					"node7": {
 						time.Time{}, time.Time{}, time.Now(),
@@ -812,8 +843,7 @@ func TestTriggerEvent(t *testing.T) {
 				EventType:     "Above Threshold",
 				ThresholdTime: 2,
 			},
-			stat: &stats{
-				timeLock: sync.RWMutex{},
+			stat: &testStats{
 				arrivalTimes: map[string][]time.Time{
 					"node8": {
 						time.Time{}, time.Now(), time.Now(),
@@ -828,8 +858,7 @@ func TestTriggerEvent(t *testing.T) {
 				EventType:     "Above Threshold",
 				ThresholdTime: 2,
 			},
-			stat: &stats{
-				timeLock: sync.RWMutex{},
+			stat: &testStats{
 				arrivalTimes: map[string][]time.Time{
 					"node9": {
 						time.Now(), time.Now(), time.Now(),
@@ -844,8 +873,7 @@ func TestTriggerEvent(t *testing.T) {
 				EventType:     "Below Threshold",
 				ThresholdTime: 0,
 			},
-			stat: &stats{
-				timeLock: sync.RWMutex{},
+			stat: &testStats{
 				arrivalTimes: map[string][]time.Time{
 					"node10": {
 						time.Time{}, time.Time{}, time.Now(),
@@ -860,8 +888,7 @@ func TestTriggerEvent(t *testing.T) {
 				EventType:     "Below Threshold",
 				ThresholdTime: 0,
 			},
-			stat: &stats{
-				timeLock: sync.RWMutex{},
+			stat: &testStats{
 				arrivalTimes: map[string][]time.Time{
 					"node11": {
 						time.Time{}, time.Now(), time.Now(),
@@ -876,8 +903,7 @@ func TestTriggerEvent(t *testing.T) {
 				EventType:     "Below Threshold",
 				ThresholdTime: 0,
 			},
-			stat: &stats{
-				timeLock: sync.RWMutex{},
+			stat: &testStats{
 				arrivalTimes: map[string][]time.Time{
 					"node12": {
 						time.Now(), time.Now(), time.Now(),
@@ -892,8 +918,7 @@ func TestTriggerEvent(t *testing.T) {
 				EventType:     "Below Threshold",
 				ThresholdTime: 1,
 			},
-			stat: &stats{
-				timeLock: sync.RWMutex{},
+			stat: &testStats{
 				arrivalTimes: map[string][]time.Time{
 					"node13": {
 						time.Time{}, time.Time{}, time.Now(),
@@ -908,8 +933,7 @@ func TestTriggerEvent(t *testing.T) {
 				EventType:     "Below Threshold",
 				ThresholdTime: 1,
 			},
-			stat: &stats{
-				timeLock: sync.RWMutex{},
+			stat: &testStats{
 				arrivalTimes: map[string][]time.Time{
 					"node14": {
 						time.Time{}, time.Now(), time.Now(),
@@ -924,8 +948,7 @@ func TestTriggerEvent(t *testing.T) {
 				EventType:     "Below Threshold",
 				ThresholdTime: 1,
 			},
-			stat: &stats{
-				timeLock: sync.RWMutex{},
+			stat: &testStats{
 				arrivalTimes: map[string][]time.Time{
 					"node15": {
 						time.Now(), time.Now(), time.Now(),
@@ -940,8 +963,7 @@ func TestTriggerEvent(t *testing.T) {
 				EventType:     "Below Threshold",
 				ThresholdTime: 2,
 			},
-			stat: &stats{
-				timeLock: sync.RWMutex{},
+			stat: &testStats{
 				arrivalTimes: map[string][]time.Time{
 					"node16": {
 						time.Time{}, time.Time{}, time.Now(),
@@ -956,8 +978,7 @@ func TestTriggerEvent(t *testing.T) {
 				EventType:     "Below Threshold",
 				ThresholdTime: 2,
 			},
-			stat: &stats{
-				timeLock: sync.RWMutex{},
+			stat: &testStats{
 				arrivalTimes: map[string][]time.Time{
 					"node17": {
 						time.Time{}, time.Now(), time.Now(),
@@ -972,8 +993,7 @@ func TestTriggerEvent(t *testing.T) {
 				EventType:     "Below Threshold",
 				ThresholdTime: 2,
 			},
-			stat: &stats{
-				timeLock: sync.RWMutex{},
+			stat: &testStats{
 				arrivalTimes: map[string][]time.Time{
 					"node18": {
 						time.Now(), time.Now(), time.Now(),
@@ -988,8 +1008,7 @@ func TestTriggerEvent(t *testing.T) {
 				EventType:     "Sudden Change",
 				ThresholdTime: 0,
 			},
-			stat: &stats{
-				timeLock: sync.RWMutex{},
+			stat: &testStats{
 				arrivalTimes: map[string][]time.Time{
 					"node19": {
 						time.Time{}, time.Time{}, time.Now(),
@@ -1004,8 +1023,7 @@ func TestTriggerEvent(t *testing.T) {
 				EventType:     "Sudden Change",
 				ThresholdTime: 0,
 			},
-			stat: &stats{
-				timeLock: sync.RWMutex{},
+			stat: &testStats{
 				arrivalTimes: map[string][]time.Time{
 					"node20": {
 						time.Time{}, time.Now(), time.Now(),
@@ -1020,8 +1038,7 @@ func TestTriggerEvent(t *testing.T) {
 				EventType:     "Sudden Change",
 				ThresholdTime: 0,
 			},
-			stat: &stats{
-				timeLock: sync.RWMutex{},
+			stat: &testStats{
 				arrivalTimes: map[string][]time.Time{
 					"node21": {
 						time.Now(), time.Now(), time.Now(),
@@ -1036,8 +1053,7 @@ func TestTriggerEvent(t *testing.T) {
 				EventType:     "Sudden Change",
 				ThresholdTime: 1,
 			},
-			stat: &stats{
-				timeLock: sync.RWMutex{},
+			stat: &testStats{
 				arrivalTimes: map[string][]time.Time{
 					"node22": {
 						time.Time{}, time.Time{}, time.Now(),
@@ -1052,8 +1068,7 @@ func TestTriggerEvent(t *testing.T) {
 				EventType:     "Sudden Change",
 				ThresholdTime: 1,
 			},
-			stat: &stats{
-				timeLock: sync.RWMutex{},
+			stat: &testStats{
 				arrivalTimes: map[string][]time.Time{
 					"node23": {
 						time.Time{}, time.Now(), time.Now(),
@@ -1068,8 +1083,7 @@ func TestTriggerEvent(t *testing.T) {
 				EventType:     "Sudden Change",
 				ThresholdTime: 1,
 			},
-			stat: &stats{
-				timeLock: sync.RWMutex{},
+			stat: &testStats{
 				arrivalTimes: map[string][]time.Time{
 					"node24": {
 						time.Now(), time.Now(), time.Now(),
@@ -1084,8 +1098,7 @@ func TestTriggerEvent(t *testing.T) {
 				EventType:     "Sudden Change",
 				ThresholdTime: 2,
 			},
-			stat: &stats{
-				timeLock: sync.RWMutex{},
+			stat: &testStats{
 				arrivalTimes: map[string][]time.Time{
 					"node25": {
 						time.Time{}, time.Time{}, time.Now(),
@@ -1100,8 +1113,7 @@ func TestTriggerEvent(t *testing.T) {
 				EventType:     "Sudden Change",
 				ThresholdTime: 2,
 			},
-			stat: &stats{
-				timeLock: sync.RWMutex{},
+			stat: &testStats{
 				arrivalTimes: map[string][]time.Time{
 					"node26": {
 						time.Time{}, time.Now(), time.Now(),
@@ -1116,8 +1128,7 @@ func TestTriggerEvent(t *testing.T) {
 				EventType:     "Sudden Change",
 				ThresholdTime: 2,
 			},
-			stat: &stats{
-				timeLock: sync.RWMutex{},
+			stat: &testStats{
 				arrivalTimes: map[string][]time.Time{
 					"node27": {
 						time.Now(), time.Now(), time.Now(),
@@ -1131,7 +1142,7 @@ func TestTriggerEvent(t *testing.T) {
 	for i, testCase := range testCases {
 		count := 0
 
-		go triggerEvent(testCase.event, eventChannel, testCase.stat)
+		go triggerEvent(testCase.event, eventChannel, testCase.stat.load())
 
 		timeout := time.After(time.Duration(200) * time.Millisecond)
 
@@ -1611,24 +1622,52 @@ func TestEventCreateHandler(t *testing.T) {
 			eventDataLen: 4,
 			numTimes:     0,
 		},
+		{
+			// Gaps within the padding are kept, the ones before are not
+			event: &widgets.Event{
+				Node:          "node14",
+				Stat:          "stat14",
+				EventType:     "Above Threshold",
+				LastTriggered: curTime,
+				AlertTimes:    make([]time.Time, 0),
+				DataTimes:     make([]time.Time, 0),
+				Data:          make([]float64, 0),
+			},
+			prevEvents: []*widgets.Event{},
+			arrivalTimes: map[string][]time.Time{
+				"node14": {
+					time.Time{}, curTime.Add(-time.Second * time.Duration(3)), time.Time{}, curTime.Add(-time.Second), curTime,
+				},
+			},
+			statBuffers: map[string]map[string][]float64{
+				"node14": {
+					"stat14": {
+						math.NaN(), 1.0, math.NaN(), 3.0, 4.0,
+					},
+				},
+			},
+			alerts: map[string]*int{
+				"ttl":         intPointer(3),
+				"dataPadding": intPointer(4),
+			},
+			create:       true,
+			eventDataLen: 4,
+			numTimes:     0,
+		},
 	}
 
 	eventChannel := make(chan *widgets.Event)
 	eventDisplay := &widgets.EventDisplay{
 		EventLock: sync.RWMutex{},
 	}
-	stats := &stats{
-		timeLock:   sync.RWMutex{},
-		bufferLock: sync.RWMutex{},
-	}
+	stats := &stats{}
 	alerts := make(map[string]*int)
 
 	go eventCreateHandler(eventChannel, eventDisplay, stats, alerts)
 
 	for i, testCase := range testCases {
 		eventDisplay.Events = testCase.prevEvents
-		stats.arrivalTimes = testCase.arrivalTimes
-		stats.statBuffers = testCase.statBuffers
+		setNodes(stats, testCase.statBuffers, testCase.arrivalTimes)
 		alerts["ttl"] = testCase.alerts["ttl"]
 		alerts["dataPadding"] = testCase.alerts["dataPadding"]
 
@@ -1677,7 +1716,6 @@ func TestEventDataHandler(t *testing.T) {
 					Data: []float64{
 						0.0, 0.0, 0.0, 0.0,
 					},
-					Stale: false,
 				},
 			},
 			arrivalTimes: map[string][]time.Time{
@@ -1713,7 +1751,6 @@ func TestEventDataHandler(t *testing.T) {
 					Data: []float64{
 						0.0, 0.0, 0.0, 0.0,
 					},
-					Stale: false,
 				},
 			},
 			arrivalTimes: map[string][]time.Time{
@@ -1749,7 +1786,6 @@ func TestEventDataHandler(t *testing.T) {
 					Data: []float64{
 						0.0, 0.0, 0.0, 0.0,
 					},
-					Stale: false,
 				},
 			},
 			arrivalTimes: map[string][]time.Time{
@@ -1785,7 +1821,6 @@ func TestEventDataHandler(t *testing.T) {
 					Data: []float64{
 						0.0, 0.0, 0.0, 0.0,
 					},
-					Stale: false,
 				},
 			},
 			arrivalTimes: map[string][]time.Time{
@@ -1821,7 +1856,6 @@ func TestEventDataHandler(t *testing.T) {
 					Data: []float64{
 						0.0, 0.0, 0.0, 0.0,
 					},
-					Stale: false,
 				},
 			},
 			arrivalTimes: map[string][]time.Time{
@@ -1857,7 +1891,6 @@ func TestEventDataHandler(t *testing.T) {
 					Data: []float64{
 						0.0, 0.0, 0.0, 0.0,
 					},
-					Stale: false,
 				},
 			},
 			arrivalTimes: map[string][]time.Time{
@@ -1893,7 +1926,6 @@ func TestEventDataHandler(t *testing.T) {
 					Data: []float64{
 						0.0, 0.0, 0.0, 0.0,
 					},
-					Stale: false,
 				},
 			},
 			arrivalTimes: map[string][]time.Time{
@@ -1921,17 +1953,13 @@ func TestEventDataHandler(t *testing.T) {
 	eventDisplay := &widgets.EventDisplay{
 		EventLock: sync.RWMutex{},
 	}
-	stats := &stats{
-		timeLock:   sync.RWMutex{},
-		bufferLock: sync.RWMutex{},
-	}
+	stats := &stats{}
 	alerts := make(map[string]*int)
 
 	for i, testCase := range testCases {
 
 		eventDisplay.Events = testCase.events
-		stats.arrivalTimes = testCase.arrivalTimes
-		stats.statBuffers = testCase.statBuffers
+		setNodes(stats, testCase.statBuffers, testCase.arrivalTimes)
 		alerts["ttl"] = testCase.alerts["ttl"]
 		alerts["dataPadding"] = testCase.alerts["dataPadding"]
 
@@ -1975,3 +2003,227 @@ func TestEventDataHandler(t *testing.T) {
 
 	reportDelete = ReportDeleteOri
 }
+
+func TestSustainedThresholds(t *testing.T) {
+
+	statInfo := newStatInfo()
+	statInfo.MaxVal = 10
+	statInfo.MaxClear = 5
+	statInfo.MinVal = 2
+	statInfo.MinClear = 4
+	statInfo.For = 2
+
+	// One value a second, the alerts expected for each
+	tests := []struct {
+		val      float64
+		expected []string
+	}{
+		{11, nil},
+		{12, nil},
+		{13, []string{"Above Threshold"}},
+		// Above the clear value, still firing
+		{8, []string{"Above Threshold"}},
+		{4, nil},
+		// Crossed again, has to hold for 2 seconds again
+		{11, nil},
+		{9, nil},
+		{1, nil},
+		// Missing samples do not break the 2 seconds
+		{math.NaN(), nil},
+		{1, []string{"Below Threshold"}},
+		{1, []string{"Below Threshold"}},
+		{3, []string{"Below Threshold"}},
+		{5, nil},
+	}
+
+	events := make([]*widgets.Event, 0)
+
+	TriggerEventOri := triggerEvent
+	triggerEvent = func(event *widgets.Event, eventChannel chan *widgets.Event, stats *stats) {
+		events = append(events, event)
+	}
+
+	stats := &stats{}
+	start := time.UnixMilli(1690000000000)
+
+	for i, test := range tests {
+		analyzeValues(
+			stats, "node1", "stat1", statInfo,
+			start.Add(time.Second*time.Duration(i)),
+			statValues{test.val, math.NaN(), math.NaN(), math.NaN()}, nil,
+		)
+
+		if len(events) != len(test.expected) {
+			t.Errorf("Expected %v got %v %d", test.expected, events, i)
+		} else {
+			for j, event := range events {
+				if event.EventType != test.expected[j] {
+					t.Errorf("Expected %v got %v %d", test.expected[j],
+						event.EventType, i)
+				}
+			}
+		}
+
+		events = make([]*widgets.Event, 0)
+	}
+
+	triggerEvent = TriggerEventOri
+}
+
+func TestChangeThresholds(t *testing.T) {
+
+	statInfo := newStatInfo()
+	statInfo.MaxChange = 0.5
+	statInfo.MaxIncrease = 1
+	statInfo.MaxDecrease = 0.2
+	statInfo.MaxDelta = 50
+	statInfo.MaxRate = 10
+	statInfo.MaxChangeTime = 2
+
+	// Changes over 2 seconds
+	tests := []struct {
+		last     float64
+		cur      float64
+		expected map[string]float64
+	}{
+		{100, 110, map[string]float64{}},
+		{100, 130, map[string]float64{"Rate of Change": 15}},
+		{100, 250, map[string]float64{
+			"Sudden Change": 1.5, "Sudden Increase": 1.5,
+			"Sudden Delta": 150, "Rate of Change": 75,
+		}},
+		{100, 70, map[string]float64{
+			"Sudden Decrease": 0.3, "Rate of Change": 15,
+		}},
+		// Relative to the size of the earlier value
+		{-100, -40, map[string]float64{
+			"Sudden Change": 0.6, "Sudden Delta": 60, "Rate of Change": 30,
+		}},
+		// No relative change from 0
+		{0, 10, map[string]float64{}},
+		{0, 100, map[string]float64{"Sudden Delta": 100, "Rate of Change": 50}},
+	}
+
+	events := make([]*widgets.Event, 0)
+
+	TriggerEventOri := triggerEvent
+	triggerEvent = func(event *widgets.Event, eventChannel chan *widgets.Event, stats *stats) {
+		events = append(events, event)
+	}
+
+	stats := &stats{}
+
+	for i, test := range tests {
+		analyzeValues(
+			stats, "node1", "stat1", statInfo, time.Time{},
+			statValues{test.cur, test.last, math.NaN(), math.NaN()}, nil,
+		)
+
+		if len(events) != len(test.expected) {
+			t.Errorf("Expected %v got %v %d", test.expected, events, i)
+		}
+		for _, event := range events {
+			change, ok := test.expected[event.EventType]
+			if !ok || math.Abs(event.ThresholdChange-change) > 1e-9 {
+				t.Errorf("Expected %v got %v %v %d", test.expected,
+					event.EventType, event.ThresholdChange, i)
+			}
+			if event.ThresholdTime != 2 ||
+				event.ChangeWindow != 2*time.Second {
+				t.Errorf("Expected %v got %v %v %d", 2, event.ThresholdTime,
+					event.ChangeWindow, i)
+			}
+		}
+
+		events = make([]*widgets.Event, 0)
+	}
+
+	triggerEvent = TriggerEventOri
+}
+
+func TestEventLifecycle(t *testing.T) {
+
+	statInfo := newStatInfo()
+	statInfo.MaxVal = 10
+
+	stats := &stats{}
+	eventChannel := make(chan *widgets.Event, 10)
+	eventDisplay := &widgets.EventDisplay{EventLock: sync.RWMutex{}}
+	start := time.UnixMilli(1690000000000)
+
+	// Value of each second and the state of the alert after it
+	tests := []struct {
+		val         float64
+		acknowledge bool
+		expected    string
+	}{
+		{11, false, widgets.StateFiring},
+		{12, true, widgets.StateAcknowledged},
+		{13, false, widgets.StateAcknowledged},
+		{9, false, widgets.StateResolved},
+		// Missing samples do not resolve or fire
+		{math.NaN(), false, widgets.StateResolved},
+		{11, false, widgets.StateFiring},
+	}
+
+	for i, test := range tests {
+		analyzeValues(
+			stats, "node1", "stat1", statInfo,
+			start.Add(time.Second*time.Duration(i)),
+			statValues{test.val, math.NaN(), math.NaN(), math.NaN()},
+			eventChannel,
+		)
+
+		for len(eventChannel) > 0 {
+			event := <-eventChannel
+			switch {
+			case event.State == widgets.StateResolved:
+				resolveEvent(event, eventDisplay)
+			case len(eventDisplay.Events) == 0:
+				eventDisplay.AddEvent(event)
+			default:
+				updateEvent(eventDisplay.Events[0])
+			}
+		}
+
+		if test.acknowledge && !eventDisplay.AcknowledgeEvent() {
+			t.Errorf("Expected %v got %v %d", true, false, i)
+		}
+
+		if len(eventDisplay.Events) != 1 {
+			t.Fatalf("Expected %v got %v events %d", 1,
+				len(eventDisplay.Events), i)
+		}
+		if state := eventDisplay.Events[0].CurState(); state != test.expected {
+			t.Errorf("Expected %v got %v %d", test.expected, state, i)
+		}
+	}
+}
+
+func TestChangeEntries(t *testing.T) {
+
+	tests := []struct {
+		interval      time.Duration
+		maxChangeTime int
+		expected      int
+	}{
+		{0, 2, 2},
+		{time.Second, 1, 1},
+		{10 * time.Second, 30, 3},
+		{10 * time.Second, 1, 1},
+		{10 * time.Second, 14, 1},
+		{500 * time.Millisecond, 2, 4},
+		{10 * time.Second, 0, 0},
+	}
+
+	for i, test := range tests {
+		stats := &stats{interval: test.interval}
+		statInfo := newStatInfo()
+		statInfo.MaxChangeTime = test.maxChangeTime
+
+		entries := stats.changeEntries(statInfo)
+		if entries != test.expected {
+			t.Errorf("Expected %v got %v %d", test.expected, entries, i)
+		}
+	}
+}
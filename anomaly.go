@@ -0,0 +1,133 @@
+//  Copyright 2023-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included
+//  in the file licenses/BSL-Couchbase.txt.  As of the Change Date specified
+//  in that file, in accordance with the Business Source License, use of this
+//  software will be governed by the Apache License, Version 2.0, included in
+//  the file licenses/APL2.txt.
+
+package main
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// Ways of computing the expected value of a stat from its recent values
+const (
+	// Mean and standard deviation of the window
+	anomalyZScore = "zscore"
+
+	// Exponentially weighted mean and deviation, favouring the newest values
+	anomalyEWMA = "ewma"
+)
+
+// Fewest known values in the window before a stat is checked
+const minAnomalySamples = 5
+
+// Smallest deviation used, as a part of the size of the values, so a stat
+// that held still is an anomaly once it moves by more than a few percent
+const minAnomalyDev = 0.01
+
+// Anomaly detection used for the stats without their own flags
+type anomalyConfig struct {
+	// Number of deviations from the expected value that is an anomaly,
+	// 0 to only check the stats with an _anomaly flag
+	sensitivity float64
+
+	window time.Duration
+	method string
+}
+
+func checkAnomalyMethod(method string) error {
+	if method != anomalyZScore && method != anomalyEWMA {
+		return fmt.Errorf("anomaly method must be %s or %s, got %q",
+			anomalyZScore, anomalyEWMA, method)
+	}
+	return nil
+}
+
+// Sensitivity, window in samples and method of a stat, falling back to
+// the defaults of stats
+func (stats *stats) anomalySettings(
+	statInfo *configStatInfo) (float64, int, string) {
+
+	sensitivity := statInfo.Anomaly
+	if math.IsNaN(sensitivity) {
+		sensitivity = stats.anomaly.sensitivity
+	}
+
+	window := time.Duration(statInfo.AnomalyWindow) * time.Second
+	if window <= 0 {
+		window = stats.anomaly.window
+	}
+
+	method := statInfo.AnomalyMethod
+	if method == "" {
+		method = stats.anomaly.method
+	}
+
+	return sensitivity, int(window / stats.sampleInterval()), method
+}
+
+// Expected value and deviation of the latest value of a buffer from the
+// samples before it, NaN if too few of them are known
+func baseline(buffer *ring[float64], samples int,
+	method string) (float64, float64) {
+
+	end := buffer.len() - 1
+	start := end - samples
+	if start < 0 {
+		start = 0
+	}
+
+	known := 0
+	for i := start; i < end; i++ {
+		if !math.IsNaN(buffer.at(i)) {
+			known++
+		}
+	}
+	if known < minAnomalySamples {
+		return math.NaN(), math.NaN()
+	}
+
+	if method == anomalyEWMA {
+		alpha := 2 / (float64(samples) + 1)
+		mean, variance := math.NaN(), 0.0
+
+		for i := start; i < end; i++ {
+			val := buffer.at(i)
+			if math.IsNaN(val) {
+				continue
+			}
+			if math.IsNaN(mean) {
+				mean = val
+				continue
+			}
+			diff := val - mean
+			incr := alpha * diff
+			mean += incr
+			variance = (1 - alpha) * (variance + diff*incr)
+		}
+
+		return mean, math.Sqrt(variance)
+	}
+
+	sum := 0.0
+	for i := start; i < end; i++ {
+		if val := buffer.at(i); !math.IsNaN(val) {
+			sum += val
+		}
+	}
+	mean := sum / float64(known)
+
+	squares := 0.0
+	for i := start; i < end; i++ {
+		if val := buffer.at(i); !math.IsNaN(val) {
+			squares += (val - mean) * (val - mean)
+		}
+	}
+
+	return mean, math.Sqrt(squares / float64(known))
+}
@@ -0,0 +1,189 @@
+//  Copyright 2023-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included
+//  in the file licenses/BSL-Couchbase.txt.  As of the Change Date specified
+//  in that file, in accordance with the Business Source License, use of this
+//  software will be governed by the Apache License, Version 2.0, included in
+//  the file licenses/APL2.txt.
+
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/couchbaselabs/chronos/widgets"
+)
+
+func TestBaseline(t *testing.T) {
+
+	nan := math.NaN()
+
+	tests := []struct {
+		buffer  []float64
+		samples int
+		method  string
+		mean    float64
+		dev     float64
+	}{
+		// The latest value is left out
+		{[]float64{2, 4, 4, 4, 5, 5, 7, 9, 100}, 8, anomalyZScore, 5, 2},
+		// Only the window before the latest value
+		{[]float64{100, 2, 4, 4, 4, 5, 5, 7, 9, 100}, 8, anomalyZScore, 5, 2},
+		{[]float64{2, 4, nan, 4, 4, 5, 5, 7, 9, 100}, 9, anomalyZScore, 5, 2},
+		{[]float64{1, 2, nan, nan, 3, 4, 100}, 6, anomalyZScore, nan, nan},
+		{[]float64{3, 3, 3, 3, 3, 3, 100}, 6, anomalyEWMA, 3, 0},
+		{[]float64{0, 0, 0, 0, 8, 100}, 5, anomalyEWMA, 8.0 / 3, math.Sqrt(128.0 / 9)},
+	}
+
+	for i, test := range tests {
+		mean, dev := baseline(ringOf(test.buffer), test.samples, test.method)
+		if math.Abs(mean-test.mean) > 1e-9 && !sameValue(mean, test.mean) {
+			t.Errorf("Expected %v got %v %d", test.mean, mean, i)
+		}
+		if math.Abs(dev-test.dev) > 1e-9 && !sameValue(dev, test.dev) {
+			t.Errorf("Expected %v got %v %d", test.dev, dev, i)
+		}
+	}
+}
+
+func TestAnomalySettings(t *testing.T) {
+
+	interval := time.Millisecond * time.Duration(500)
+	stats := statsInit(&config{
+		stats:    make(map[string]*configStatInfo),
+		interval: &interval,
+	}, nil)
+	stats.anomaly = anomalyConfig{
+		sensitivity: 3, window: time.Minute, method: anomalyZScore,
+	}
+
+	own := newStatInfo()
+	own.Anomaly = 2
+	own.AnomalyWindow = 10
+	own.AnomalyMethod = anomalyEWMA
+
+	tests := []struct {
+		statInfo    *configStatInfo
+		sensitivity float64
+		samples     int
+		method      string
+	}{
+		{newStatInfo(), 3, 120, anomalyZScore},
+		{own, 2, 20, anomalyEWMA},
+	}
+
+	for i, test := range tests {
+		sensitivity, samples, method := stats.anomalySettings(test.statInfo)
+		if sensitivity != test.sensitivity || samples != test.samples ||
+			method != test.method {
+			t.Errorf("Expected %v %v %v got %v %v %v %d", test.sensitivity,
+				test.samples, test.method, sensitivity, samples, method, i)
+		}
+	}
+}
+
+func TestAnomalyEvent(t *testing.T) {
+
+	events := make([]*widgets.Event, 0)
+
+	TriggerEventOri := triggerEvent
+	triggerEvent = func(event *widgets.Event, eventChannel chan *widgets.Event, stats *stats) {
+		events = append(events, event)
+	}
+
+	interval := time.Second
+	stats := statsInit(&config{
+		stats:    make(map[string]*configStatInfo),
+		interval: &interval,
+	}, []string{"node1"})
+	stats.addStat("stat1")
+
+	statInfo := newStatInfo()
+	statInfo.Anomaly = 3
+	statInfo.AnomalyWindow = 8
+
+	series := stats.series("node1")
+	start := time.UnixMilli(1690000000000)
+
+	// Mean of 11 and deviation of 1 before the last value
+	vals := []float64{10, 12, 10, 12, 10, 12, 10, 12, 11, 30}
+	expected := []int{0, 0, 0, 0, 0, 0, 0, 0, 0, 1}
+
+	var timeDiff float64
+	for i, val := range vals {
+		sampleTime := start.Add(interval * time.Duration(i))
+
+		series.lock.Lock()
+		series.store(sampleTime, map[string]float64{"stat1": val},
+			[]string{"stat1"}, interval, &timeDiff)
+		latest := latestValues(stats, series.buffers["stat1"], statInfo)
+		series.lock.Unlock()
+
+		analyzeValues(stats, "node1", "stat1", statInfo, sampleTime, latest, nil)
+
+		if len(events) != expected[i] {
+			t.Errorf("Expected %v got %v %d", expected[i], len(events), i)
+		}
+	}
+
+	if len(events) == 1 {
+		event := events[0]
+		if event.EventType != "Anomaly" || event.ThresholdData != 30 ||
+			event.Threshold != 3 || event.ThresholdChange <= 3 {
+			t.Errorf("Expected %v got %v", "Anomaly", event.Description)
+		}
+	}
+
+	triggerEvent = TriggerEventOri
+}
+
+func TestAnomalyFlat(t *testing.T) {
+
+	events := make([]*widgets.Event, 0)
+
+	TriggerEventOri := triggerEvent
+	triggerEvent = func(event *widgets.Event, eventChannel chan *widgets.Event, stats *stats) {
+		events = append(events, event)
+	}
+
+	statInfo := newStatInfo()
+	statInfo.Anomaly = 3
+
+	// Values that never moved before the latest one
+	tests := []struct {
+		mean     float64
+		cur      float64
+		expected int
+	}{
+		{10, 10, 0},
+		{10, 12, 1},
+		{100, 101, 0},
+		{0, 5, 1},
+		{0, 0, 0},
+	}
+
+	stats := &stats{}
+
+	for i, test := range tests {
+		analyzeValues(
+			stats, "node1", "stat1", statInfo, time.Time{},
+			statValues{test.cur, math.NaN(), test.mean, 0}, nil,
+		)
+
+		if len(events) != test.expected {
+			t.Errorf("Expected %v got %v %d", test.expected, len(events), i)
+		}
+		for _, event := range events {
+			if math.IsInf(event.ThresholdChange, 0) {
+				t.Errorf("Expected %v got %v %d", "finite",
+					event.ThresholdChange, i)
+			}
+		}
+
+		events = make([]*widgets.Event, 0)
+	}
+
+	triggerEvent = TriggerEventOri
+}
@@ -0,0 +1,122 @@
+//  Copyright 2023-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included
+//  in the file licenses/BSL-Couchbase.txt.  As of the Change Date specified
+//  in that file, in accordance with the Business Source License, use of this
+//  software will be governed by the Apache License, Version 2.0, included in
+//  the file licenses/APL2.txt.
+
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	log "github.com/couchbase/clog"
+	"github.com/couchbase/gocb/v2"
+	"golang.org/x/term"
+)
+
+// Environment variable read for the password if no other source is given
+const passwordEnv = "CB_PASSWORD"
+
+// Credentials used for the cluster and for all the REST calls to the nodes
+type credentials struct {
+	username string
+	password string
+
+	// Client certificate, nil if not using one
+	// Used on its own for authentication when there is no password
+	cert *tls.Certificate
+}
+
+// Gather the credentials from the flags, a password file, the environment
+// or an interactive prompt, in that order
+func credentialsInit(username string, password string, passwordFile string,
+	tlsConfig *tls.Config) (*credentials, error) {
+
+	creds := &credentials{
+		username: username,
+	}
+
+	if tlsConfig != nil && len(tlsConfig.Certificates) != 0 {
+		creds.cert = &tlsConfig.Certificates[0]
+	}
+
+	switch {
+	case password != "":
+		log.Warnf("init: -password is visible in the shell history and the " +
+			"process list, consider -password_file or " + passwordEnv)
+		creds.password = password
+	case passwordFile != "":
+		contents, err := os.ReadFile(passwordFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read password file: %v", err)
+		}
+		creds.password = strings.TrimRight(string(contents), "\r\n")
+	case os.Getenv(passwordEnv) != "":
+		creds.password = os.Getenv(passwordEnv)
+	case creds.cert != nil:
+		// Certificate authentication without a password
+	case term.IsTerminal(int(os.Stdin.Fd())):
+		fmt.Printf("Password for %s: ", username)
+		contents, err := term.ReadPassword(int(os.Stdin.Fd()))
+		fmt.Println()
+		if err != nil {
+			return nil, fmt.Errorf("unable to read password: %v", err)
+		}
+		creds.password = string(contents)
+	default:
+		return nil, fmt.Errorf("no password given, use -password_file, " +
+			passwordEnv + " or a client certificate")
+	}
+
+	return creds, nil
+}
+
+// Set the credentials on a request made to a node
+// The client certificate is presented by the shared client itself
+func (creds *credentials) authorize(req *http.Request) {
+	if creds.password != "" {
+		req.SetBasicAuth(creds.username, creds.password)
+	}
+}
+
+// Authenticator for the go sdk matching the credentials
+func (creds *credentials) authenticator() gocb.Authenticator {
+
+	passwordAuth := gocb.PasswordAuthenticator{
+		Username: creds.username,
+		Password: creds.password,
+	}
+
+	if creds.cert == nil {
+		return passwordAuth
+	}
+
+	if creds.password == "" {
+		return gocb.CertificateAuthenticator{
+			ClientCertificate: creds.cert,
+		}
+	}
+
+	return passwordCertAuthenticator{
+		PasswordAuthenticator: passwordAuth,
+		cert:                  creds.cert,
+	}
+}
+
+// Authenticates with a password while presenting a client certificate
+// Used for clusters that require client certificates on every connection
+type passwordCertAuthenticator struct {
+	gocb.PasswordAuthenticator
+	cert *tls.Certificate
+}
+
+func (auth passwordCertAuthenticator) Certificate(
+	req gocb.AuthCertRequest) (*tls.Certificate, error) {
+	return auth.cert, nil
+}
@@ -0,0 +1,121 @@
+//  Copyright 2023-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included
+//  in the file licenses/BSL-Couchbase.txt.  As of the Change Date specified
+//  in that file, in accordance with the Business Source License, use of this
+//  software will be governed by the Apache License, Version 2.0, included in
+//  the file licenses/APL2.txt.
+
+package main
+
+import (
+	"crypto/tls"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/couchbase/gocb/v2"
+)
+
+func TestCredentialsInit(t *testing.T) {
+
+	passwordFile := filepath.Join(t.TempDir(), "password")
+	err := os.WriteFile(passwordFile, []byte("fromfile\n"), 0600)
+	if err != nil {
+		t.Fatalf("Unable to write password file %v", err)
+	}
+
+	certConfig := &tls.Config{
+		Certificates: []tls.Certificate{{}},
+	}
+
+	testCases := []struct {
+		password      string
+		passwordFile  string
+		env           string
+		tlsConfig     *tls.Config
+		expected      string
+		err           bool
+		authenticator gocb.Authenticator
+		basicAuth     bool
+	}{
+		{
+			password:      "fromflag",
+			passwordFile:  passwordFile,
+			env:           "fromenv",
+			expected:      "fromflag",
+			authenticator: gocb.PasswordAuthenticator{},
+			basicAuth:     true,
+		},
+		{
+			passwordFile:  passwordFile,
+			env:           "fromenv",
+			expected:      "fromfile",
+			authenticator: gocb.PasswordAuthenticator{},
+			basicAuth:     true,
+		},
+		{
+			env:           "fromenv",
+			tlsConfig:     certConfig,
+			expected:      "fromenv",
+			authenticator: passwordCertAuthenticator{},
+			basicAuth:     true,
+		},
+		{
+			tlsConfig:     certConfig,
+			expected:      "",
+			authenticator: gocb.CertificateAuthenticator{},
+			basicAuth:     false,
+		},
+		{
+			passwordFile: filepath.Join(t.TempDir(), "missing"),
+			err:          true,
+		},
+	}
+
+	for i, testCase := range testCases {
+
+		t.Setenv(passwordEnv, testCase.env)
+
+		creds, err := credentialsInit(
+			"user", testCase.password, testCase.passwordFile, testCase.tlsConfig,
+		)
+		if (err != nil) != testCase.err {
+			t.Errorf("Expected error %v got %v %d", testCase.err, err, i)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+
+		if creds.password != testCase.expected {
+			t.Errorf("Expected %v got %v %d", testCase.expected, creds.password, i)
+		}
+
+		switch creds.authenticator().(type) {
+		case gocb.PasswordAuthenticator:
+			_, ok := testCase.authenticator.(gocb.PasswordAuthenticator)
+			if !ok {
+				t.Errorf("Expected %T got password authenticator %d", testCase.authenticator, i)
+			}
+		case gocb.CertificateAuthenticator:
+			_, ok := testCase.authenticator.(gocb.CertificateAuthenticator)
+			if !ok {
+				t.Errorf("Expected %T got certificate authenticator %d", testCase.authenticator, i)
+			}
+		case passwordCertAuthenticator:
+			_, ok := testCase.authenticator.(passwordCertAuthenticator)
+			if !ok {
+				t.Errorf("Expected %T got password certificate authenticator %d", testCase.authenticator, i)
+			}
+		}
+
+		req, _ := http.NewRequest("GET", "http://127.0.0.1/api/manager", nil)
+		creds.authorize(req)
+
+		if _, _, ok := req.BasicAuth(); ok != testCase.basicAuth {
+			t.Errorf("Expected basic auth %v got %v %d", testCase.basicAuth, ok, i)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+//  Copyright 2023-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included
+//  in the file licenses/BSL-Couchbase.txt.  As of the Change Date specified
+//  in that file, in accordance with the Business Source License, use of this
+//  software will be governed by the Apache License, Version 2.0, included in
+//  the file licenses/APL2.txt.
+
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/couchbase/gocb/v2"
+)
+
+// Timeouts for the connections made to the nodes
+// There is no overall request timeout since the stats stream never ends
+const (
+	dialTimeout           = 10 * time.Second
+	tlsHandshakeTimeout   = 10 * time.Second
+	responseHeaderTimeout = 30 * time.Second
+	idleConnTimeout       = 90 * time.Second
+)
+
+// Build the TLS configuration from the certificate flags
+// Returns nil if no certificate options were given
+func tlsInit(caCert string, cert string, key string,
+	skipVerify bool) (*tls.Config, error) {
+
+	if caCert == "" && cert == "" && key == "" && !skipVerify {
+		return nil, nil
+	}
+
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: skipVerify,
+	}
+
+	if caCert != "" {
+		pem, err := os.ReadFile(caCert)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read CA certificate: %v", err)
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", caCert)
+		}
+
+		tlsConfig.RootCAs = pool
+	}
+
+	if cert != "" || key != "" {
+		if cert == "" || key == "" {
+			return nil, fmt.Errorf("both -cert and -key are needed for a " +
+				"client certificate")
+		}
+
+		clientCert, err := tls.LoadX509KeyPair(cert, key)
+		if err != nil {
+			return nil, fmt.Errorf("unable to load client certificate: %v", err)
+		}
+
+		tlsConfig.Certificates = []tls.Certificate{clientCert}
+	}
+
+	return tlsConfig, nil
+}
+
+// Create the client shared by all the REST calls made to the nodes
+func httpClientInit(tlsConfig *tls.Config) *http.Client {
+
+	return &http.Client{
+		Transport: &http.Transport{
+			Proxy: http.ProxyFromEnvironment,
+			DialContext: (&net.Dialer{
+				Timeout:   dialTimeout,
+				KeepAlive: 30 * time.Second,
+			}).DialContext,
+			TLSClientConfig:       tlsConfig,
+			TLSHandshakeTimeout:   tlsHandshakeTimeout,
+			ResponseHeaderTimeout: responseHeaderTimeout,
+			IdleConnTimeout:       idleConnTimeout,
+			ForceAttemptHTTP2:     true,
+		},
+	}
+}
+
+// Apply the TLS configuration to the go sdk options
+func securityConfig(tlsConfig *tls.Config) gocb.SecurityConfig {
+
+	if tlsConfig == nil {
+		return gocb.SecurityConfig{}
+	}
+
+	return gocb.SecurityConfig{
+		TLSRootCAs:    tlsConfig.RootCAs,
+		TLSSkipVerify: tlsConfig.InsecureSkipVerify,
+	}
+}
@@ -0,0 +1,89 @@
+//  Copyright 2023-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included
+//  in the file licenses/BSL-Couchbase.txt.  As of the Change Date specified
+//  in that file, in accordance with the Business Source License, use of this
+//  software will be governed by the Apache License, Version 2.0, included in
+//  the file licenses/APL2.txt.
+
+package main
+
+import (
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestHTTPClientTLS(t *testing.T) {
+
+	server := httptest.NewTLSServer(http.HandlerFunc(
+		func(w http.ResponseWriter, req *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		},
+	))
+	defer server.Close()
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	err := os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{
+		Type:  "CERTIFICATE",
+		Bytes: server.Certificate().Raw,
+	}), 0644)
+	if err != nil {
+		t.Fatalf("Unable to write CA file %v", err)
+	}
+
+	testCases := []struct {
+		caCert     string
+		cert       string
+		key        string
+		skipVerify bool
+		configErr  bool
+		requestErr bool
+	}{
+		// No TLS options, server certificate is unknown
+		{
+			requestErr: true,
+		},
+		{
+			caCert: caFile,
+		},
+		{
+			skipVerify: true,
+		},
+		{
+			caCert:    filepath.Join(t.TempDir(), "missing.pem"),
+			configErr: true,
+		},
+		// Client certificate without a key
+		{
+			cert:      caFile,
+			configErr: true,
+		},
+	}
+
+	for i, testCase := range testCases {
+
+		tlsConfig, err := tlsInit(
+			testCase.caCert, testCase.cert, testCase.key, testCase.skipVerify,
+		)
+		if (err != nil) != testCase.configErr {
+			t.Errorf("Expected error %v got %v %d", testCase.configErr, err, i)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+
+		resp, err := httpClientInit(tlsConfig).Get(server.URL)
+		if err == nil {
+			resp.Body.Close()
+		}
+
+		if (err != nil) != testCase.requestErr {
+			t.Errorf("Expected error %v got %v %d", testCase.requestErr, err, i)
+		}
+	}
+}
@@ -0,0 +1,355 @@
+//  Copyright 2023-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included
+//  in the file licenses/BSL-Couchbase.txt.  As of the Change Date specified
+//  in that file, in accordance with the Business Source License, use of this
+//  software will be governed by the Apache License, Version 2.0, included in
+//  the file licenses/APL2.txt.
+
+package main
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/couchbaselabs/chronos/widgets"
+)
+
+// Way of combining a stat across the nodes for the cluster row
+type aggregation int
+
+const (
+	aggSum aggregation = iota
+	aggAvg
+	aggMin
+	aggMax
+)
+
+// Every aggregation is kept so switching between them shows the history
+var aggregations = []aggregation{aggSum, aggAvg, aggMin, aggMax}
+
+func (agg aggregation) String() string {
+	switch agg {
+	case aggAvg:
+		return "avg"
+	case aggMin:
+		return "min"
+	case aggMax:
+		return "max"
+	default:
+		return "sum"
+	}
+}
+
+// Aggregation shown after agg in the cluster row
+func (agg aggregation) next() aggregation {
+	return aggregations[(int(agg)+1)%len(aggregations)]
+}
+
+// Name of the cluster row, also the node its data is kept under
+// Prefixed with the cluster by nodeKey when monitoring more than one
+func clusterNode(agg aggregation) string {
+	return "cluster (" + agg.String() + ")"
+}
+
+func isClusterNode(node string) bool {
+	_, addr := widgets.SplitNodeKey(node)
+	for _, agg := range aggregations {
+		if addr == clusterNode(agg) {
+			return true
+		}
+	}
+	return false
+}
+
+// Clusters the nodes belong to, in the order they first appear
+func clusterNames(nodesList []string) []string {
+	seen := make(map[string]bool)
+	names := make([]string, 0)
+	for _, node := range nodesList {
+		cluster, _ := widgets.SplitNodeKey(node)
+		if !seen[cluster] {
+			seen[cluster] = true
+			names = append(names, cluster)
+		}
+	}
+	return names
+}
+
+// Nodes with the row of their cluster showing agg before the nodes of
+// each cluster
+func withClusterRows(nodesList []string, agg aggregation) []string {
+	rows := make([]string, 0, len(nodesList)+1)
+	seen := make(map[string]bool)
+	for _, node := range nodesList {
+		cluster, _ := widgets.SplitNodeKey(node)
+		if !seen[cluster] {
+			seen[cluster] = true
+			rows = append(rows, nodeKey(cluster, clusterNode(agg)))
+		}
+		rows = append(rows, node)
+	}
+	return rows
+}
+
+// Name the thresholds of an aggregate are given under,
+// e.g. -cluster_sum.num_bytes_used_ram_max_val
+func clusterStatName(agg aggregation, stat string) string {
+	return "cluster_" + agg.String() + "." + stat
+}
+
+// State of the aggregates of every cluster
+type clusterState struct {
+	lock sync.Mutex
+
+	// Keyed by the name of the cluster, empty for a single cluster
+	clusters map[string]*aggregateState
+}
+
+// State of the aggregates of one cluster kept between chunks
+type aggregateState struct {
+	lock sync.Mutex
+
+	// Time of the last samples combined
+	last time.Time
+
+	// Rounding error of each aggregate series, see nodeSeries.store
+	timeDiffs map[aggregation]*float64
+}
+
+// State of the aggregates of a cluster, adding the series of its cluster
+// row, one per aggregation, the first time
+func (stats *stats) clusterAggregates(cluster string) *aggregateState {
+
+	stats.cluster.lock.Lock()
+	defer stats.cluster.lock.Unlock()
+
+	if stats.cluster.clusters == nil {
+		stats.cluster.clusters = make(map[string]*aggregateState)
+	}
+
+	state, ok := stats.cluster.clusters[cluster]
+	if !ok {
+		state = &aggregateState{
+			timeDiffs: make(map[aggregation]*float64),
+		}
+		for _, agg := range aggregations {
+			stats.addNode(nodeKey(cluster, clusterNode(agg)), nil)
+			state.timeDiffs[agg] = new(float64)
+		}
+		stats.cluster.clusters[cluster] = state
+	}
+
+	return state
+}
+
+// Combine the samples of the nodes of a cluster into its cluster series
+// once a chunk sampled at curTime starts the next interval, check the
+// aggregates against their thresholds and the nodes against each other
+// Each node adds its latest sample from the interval before curTime,
+// nodes that sent none are left out
+func aggregateCluster(params *updateStatsParams, curTime time.Time,
+	statsList []string) {
+
+	stats := params.stats
+	name, _ := widgets.SplitNodeKey(params.nodeName)
+	cluster := stats.clusterAggregates(name)
+
+	cluster.lock.Lock()
+
+	if cluster.last.IsZero() {
+		cluster.last = curTime.Add(-stats.interval)
+		cluster.lock.Unlock()
+		return
+	}
+	if curTime.Sub(cluster.last) < stats.interval*3/2 {
+		cluster.lock.Unlock()
+		return
+	}
+
+	cutoff := curTime.Add(-stats.interval / 2)
+	sampleTime, vals, nodeVals := clusterValues(
+		stats, name, cutoff, statsList,
+	)
+	if sampleTime.IsZero() {
+		sampleTime = cutoff.Add(-stats.interval / 2)
+	}
+	cluster.last = sampleTime
+
+	// Thresholds of the aggregates, most stats have none
+	statInfo := make(map[aggregation]map[string]*configStatInfo)
+	stats.statInfoLock.RLock()
+	for _, agg := range aggregations {
+		for _, stat := range statsList {
+			if info, ok := stats.statInfo[clusterStatName(agg, stat)]; ok {
+				if statInfo[agg] == nil {
+					statInfo[agg] = make(map[string]*configStatInfo)
+				}
+				statInfo[agg][stat] = info
+			}
+		}
+	}
+	stats.statInfoLock.RUnlock()
+
+	type check struct {
+		node     string
+		stat     string
+		statInfo *configStatInfo
+		vals     statValues
+	}
+	checks := make([]check, 0)
+
+	for _, agg := range aggregations {
+		node := nodeKey(name, clusterNode(agg))
+		series := stats.series(node)
+		if series == nil {
+			continue
+		}
+
+		series.lock.Lock()
+
+		// Stats no longer sent by any node
+		if len(series.buffers) > len(statsList) {
+			current := make(map[string]bool, len(statsList))
+			for _, stat := range statsList {
+				current[stat] = true
+			}
+			for stat := range series.buffers {
+				if !current[stat] {
+					delete(series.buffers, stat)
+					for _, tier := range series.tiers {
+						tier.removeStat(stat)
+					}
+				}
+			}
+		}
+		for _, stat := range statsList {
+			series.addStat(stat)
+		}
+
+		series.store(
+			sampleTime, vals[agg], statsList, stats.interval,
+			cluster.timeDiffs[agg],
+		)
+
+		for stat, info := range statInfo[agg] {
+			if buffer, ok := series.buffers[stat]; ok {
+				checks = append(checks, check{
+					node, stat, info,
+					latestValues(stats, buffer, info),
+				})
+			}
+		}
+
+		series.lock.Unlock()
+	}
+
+	cluster.lock.Unlock()
+
+	for _, check := range checks {
+		analyzeValues(
+			stats, check.node, check.stat, check.statInfo, sampleTime,
+			check.vals, params.eventChannel,
+		)
+	}
+	for _, agg := range aggregations {
+		analyzeRules(
+			stats, nodeKey(name, clusterNode(agg)), statsList,
+			params.eventChannel,
+		)
+	}
+
+	analyzeOutliers(stats, name, nodeVals, statsList, params.eventChannel)
+}
+
+// Combine the latest sample at or before cutoff of every node of a
+// cluster, as long as it is from the interval before cutoff
+// Returns the time of the newest sample used, zero if there was none, and
+// the samples of each node
+func clusterValues(stats *stats, cluster string, cutoff time.Time,
+	statsList []string) (time.Time, map[aggregation]map[string]float64,
+	map[string]map[string]float64) {
+
+	stats.nodesLock.RLock()
+	nodes := make(map[string]*nodeSeries, len(stats.nodes))
+	for node, series := range stats.nodes {
+		nodeCluster, _ := widgets.SplitNodeKey(node)
+		if nodeCluster == cluster && !isClusterNode(node) {
+			nodes[node] = series
+		}
+	}
+	stats.nodesLock.RUnlock()
+
+	nodeVals := make(map[string]map[string]float64, len(nodes))
+
+	var sampleTime time.Time
+	sums := make(map[string]float64, len(statsList))
+	counts := make(map[string]int, len(statsList))
+	mins := make(map[string]float64, len(statsList))
+	maxs := make(map[string]float64, len(statsList))
+
+	for node, series := range nodes {
+		series.lock.RLock()
+
+		// Skip the samples after the cutoff and the gaps between them
+		i := series.times.len() - 1
+		for ; i >= 0; i-- {
+			t := series.times.at(i)
+			if !t.IsZero() && !t.After(cutoff) {
+				break
+			}
+		}
+
+		if i >= 0 && series.times.at(i).After(cutoff.Add(-stats.interval)) {
+			if series.times.at(i).After(sampleTime) {
+				sampleTime = series.times.at(i)
+			}
+			nodeVals[node] = make(map[string]float64, len(statsList))
+
+			for _, stat := range statsList {
+				buffer, ok := series.buffers[stat]
+				if !ok {
+					continue
+				}
+				val := buffer.at(i)
+				if math.IsNaN(val) {
+					continue
+				}
+				nodeVals[node][stat] = val
+
+				if counts[stat] == 0 {
+					mins[stat], maxs[stat] = val, val
+				} else {
+					mins[stat] = math.Min(mins[stat], val)
+					maxs[stat] = math.Max(maxs[stat], val)
+				}
+				sums[stat] += val
+				counts[stat]++
+			}
+		}
+
+		series.lock.RUnlock()
+	}
+
+	vals := make(map[aggregation]map[string]float64, len(aggregations))
+	for _, agg := range aggregations {
+		vals[agg] = make(map[string]float64, len(statsList))
+	}
+
+	// Stats no node sent are gaps
+	for _, stat := range statsList {
+		if counts[stat] == 0 {
+			for _, agg := range aggregations {
+				vals[agg][stat] = math.NaN()
+			}
+			continue
+		}
+		vals[aggSum][stat] = sums[stat]
+		vals[aggAvg][stat] = sums[stat] / float64(counts[stat])
+		vals[aggMin][stat] = mins[stat]
+		vals[aggMax][stat] = maxs[stat]
+	}
+
+	return sampleTime, vals, nodeVals
+}
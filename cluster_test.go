@@ -0,0 +1,322 @@
+//  Copyright 2023-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included
+//  in the file licenses/BSL-Couchbase.txt.  As of the Change Date specified
+//  in that file, in accordance with the Business Source License, use of this
+//  software will be governed by the Apache License, Version 2.0, included in
+//  the file licenses/APL2.txt.
+
+package main
+
+import (
+	"context"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	flag "github.com/couchbaselabs/chronos/cflag"
+	"github.com/couchbaselabs/chronos/widgets"
+)
+
+func TestAggregateCluster(t *testing.T) {
+
+	interval := time.Second
+	nodes := []string{"node1", "node2", "node3"}
+
+	stats := statsInit(&config{
+		stats:    make(map[string]*configStatInfo),
+		interval: &interval,
+	}, nodes)
+	stats.initialized[""] = true
+	stats.statsList = []string{"stat1"}
+	stats.addStat("stat1")
+	stats.statInfo["stat1"] = newStatInfo()
+
+	clusterInfo := newStatInfo()
+	clusterInfo.MaxVal = 10
+	stats.statInfo[clusterStatName(aggSum, "stat1")] = clusterInfo
+
+	eventChannel := make(chan *widgets.Event, 10)
+	params := make(map[string]*updateStatsParams)
+	for _, node := range nodes {
+		params[node] = newUpdateStatsParams(
+			nil, stats, node, nil, eventChannel, make(chan string, 10), nil,
+			context.Background(), nil,
+		)
+	}
+
+	start := time.UnixMilli(1690000000000)
+
+	// node3 stops sending after the first chunk
+	chunks := []struct {
+		node   string
+		offset int
+		val    float64
+	}{
+		{"node1", 0, 2},
+		{"node2", 0, 3},
+		{"node3", 0, 10},
+		{"node1", 1, 4},
+		{"node2", 1, 5},
+		{"node1", 2, 6},
+	}
+
+	for _, chunk := range chunks {
+		m := &message{Stats: map[string]float64{"stat1": chunk.val}}
+		processMessage(
+			params[chunk.node], m,
+			start.Add(interval*time.Duration(chunk.offset)),
+		)
+	}
+
+	expected := map[aggregation][]float64{
+		aggSum: {15, 9},
+		aggAvg: {5, 4.5},
+		aggMin: {2, 4},
+		aggMax: {10, 5},
+	}
+	expectedTimes := []time.Time{start, start.Add(interval)}
+
+	for agg, expectedData := range expected {
+		node := clusterNode(agg)
+		times := stats.series(node).times.snapshot()[stats.historyLen-2:]
+		data := stats.snapshot(node, "stat1")[stats.historyLen-2:]
+
+		for i := range expectedData {
+			if !times[i].Equal(expectedTimes[i]) {
+				t.Errorf("Expected %v got %v %s", expectedTimes[i], times[i], node)
+			}
+			if !sameValue(data[i], expectedData[i]) {
+				t.Errorf("Expected %v got %v %s", expectedData[i], data[i], node)
+			}
+		}
+	}
+
+	// Only the sum of the first samples is above its threshold, the
+	// second one resolves it
+	if len(eventChannel) != 2 {
+		t.Fatalf("Expected %v got %v events", 2, len(eventChannel))
+	}
+	event := <-eventChannel
+	if event.Node != clusterNode(aggSum) {
+		t.Errorf("Expected %v got %v", clusterNode(aggSum), event.Node)
+	}
+	if event.ThresholdData != 15 {
+		t.Errorf("Expected %v got %v", 15, event.ThresholdData)
+	}
+	event = <-eventChannel
+	if event.Node != clusterNode(aggSum) ||
+		event.State != widgets.StateResolved {
+		t.Errorf("Expected %v got %v", widgets.StateResolved, event.State)
+	}
+}
+
+func TestClusterValues(t *testing.T) {
+
+	interval := time.Second
+	start := time.UnixMilli(1690000000000)
+
+	stats := statsInit(&config{
+		stats:    make(map[string]*configStatInfo),
+		interval: &interval,
+	}, []string{"node1", "node2"})
+	stats.addStat("stat1")
+	stats.addStat("stat2")
+
+	var timeDiff float64
+	stats.series("node1").store(start, map[string]float64{
+		"stat1": 1, "stat2": math.NaN(),
+	}, []string{"stat1", "stat2"}, interval, &timeDiff)
+	stats.series("node2").store(start, map[string]float64{
+		"stat1": 3, "stat2": math.NaN(),
+	}, []string{"stat1", "stat2"}, interval, &timeDiff)
+
+	tests := []struct {
+		cutoff   time.Time
+		stat     string
+		expected map[aggregation]float64
+	}{
+		{
+			cutoff: start.Add(interval / 2),
+			stat:   "stat1",
+			expected: map[aggregation]float64{
+				aggSum: 4, aggAvg: 2, aggMin: 1, aggMax: 3,
+			},
+		},
+		// Missing from every node
+		{
+			cutoff: start.Add(interval / 2),
+			stat:   "stat2",
+			expected: map[aggregation]float64{
+				aggSum: math.NaN(), aggAvg: math.NaN(),
+				aggMin: math.NaN(), aggMax: math.NaN(),
+			},
+		},
+		// Samples too old to be combined
+		{
+			cutoff: start.Add(interval * 2),
+			stat:   "stat1",
+			expected: map[aggregation]float64{
+				aggSum: math.NaN(), aggAvg: math.NaN(),
+				aggMin: math.NaN(), aggMax: math.NaN(),
+			},
+		},
+	}
+
+	for i, test := range tests {
+		_, vals, _ := clusterValues(
+			stats, "", test.cutoff, []string{"stat1", "stat2"},
+		)
+		for agg, expected := range test.expected {
+			if !sameValue(vals[agg][test.stat], expected) {
+				t.Errorf("Expected %v got %v %d", expected,
+					vals[agg][test.stat], i)
+			}
+		}
+	}
+}
+
+func TestClusterThresholdFlags(t *testing.T) {
+
+	stats := statsInit(&config{stats: make(map[string]*configStatInfo)},
+		[]string{"node1"})
+	params := newUpdateStatsParams(
+		nil, stats, "node1", make(chan *errorMsg, 1), nil, nil,
+		make(chan updateMessage, 10), context.Background(), nil,
+	)
+
+	flag.CommandLine.Additional["stat1_max_val"] = "20"
+	flag.CommandLine.Additional["cluster_sum.stat1_max_val"] = "50"
+	flag.CommandLine.Additional["cluster_min.stat1_min_val"] = "2"
+
+	if val := initStatsList(params, map[string]float64{"stat1": 1}); val != 0 {
+		t.Fatalf("Expected %v got %v", 0, val)
+	}
+
+	tests := []struct {
+		name     string
+		expected *configStatInfo
+	}{
+		{"stat1", &configStatInfo{
+			MinVal: math.NaN(), MaxVal: 20, MaxChange: math.NaN(),
+		}},
+		{"cluster_sum.stat1", &configStatInfo{
+			MinVal: math.NaN(), MaxVal: 50, MaxChange: math.NaN(),
+		}},
+		{"cluster_min.stat1", &configStatInfo{
+			MinVal: 2, MaxVal: math.NaN(), MaxChange: math.NaN(),
+		}},
+		{"cluster_avg.stat1", nil},
+	}
+
+	for _, test := range tests {
+		statInfo, ok := stats.statInfo[test.name]
+		if test.expected == nil {
+			if ok {
+				t.Errorf("Expected %v got %v %s", nil, statInfo, test.name)
+			}
+			continue
+		}
+		if !ok {
+			t.Errorf("Expected %v got %v %s", test.expected, nil, test.name)
+			continue
+		}
+		if !sameValue(statInfo.MinVal, test.expected.MinVal) ||
+			!sameValue(statInfo.MaxVal, test.expected.MaxVal) {
+			t.Errorf("Expected %v got %v %s", test.expected, statInfo,
+				test.name)
+		}
+	}
+
+	if len(flag.CommandLine.Additional) != 0 {
+		t.Errorf("Expected %v got %v", 0, flag.CommandLine.Additional)
+	}
+}
+
+func TestAggregateClusters(t *testing.T) {
+
+	interval := time.Second
+	nodes := []string{
+		"east/http://node1", "east/http://node2", "west/http://node3",
+	}
+
+	stats := statsInit(&config{
+		stats:    make(map[string]*configStatInfo),
+		interval: &interval,
+	}, nodes)
+	stats.initialized["east"] = true
+	stats.initialized["west"] = true
+	stats.statsList = []string{"stat1"}
+	stats.addStat("stat1")
+	stats.statInfo["stat1"] = newStatInfo()
+
+	start := time.UnixMilli(1690000000000)
+	vals := map[string]float64{
+		"east/http://node1": 2, "east/http://node2": 3, "west/http://node3": 10,
+	}
+
+	// Each cluster row is filled once its next interval starts
+	for offset := 0; offset < 2; offset++ {
+		for _, node := range nodes {
+			params := newUpdateStatsParams(
+				nil, stats, node, nil, nil, make(chan string, 10), nil,
+				context.Background(), nil,
+			)
+			processMessage(params, &message{
+				Stats: map[string]float64{"stat1": vals[node]},
+			}, start.Add(interval*time.Duration(offset)))
+		}
+	}
+
+	expected := map[string]float64{
+		"east/cluster (sum)": 5,
+		"west/cluster (sum)": 10,
+		"east/cluster (max)": 3,
+	}
+	for node, expectedVal := range expected {
+		data := stats.snapshot(node, "stat1")
+		if !sameValue(data[len(data)-1], expectedVal) {
+			t.Errorf("Expected %v got %v %s", expectedVal,
+				data[len(data)-1], node)
+		}
+	}
+
+	if stats.series(clusterNode(aggSum)) != nil {
+		t.Errorf("Expected %v got %v", nil,
+			stats.series(clusterNode(aggSum)))
+	}
+}
+
+func TestWithClusterRows(t *testing.T) {
+
+	tests := []struct {
+		nodesList []string
+		expected  []string
+	}{
+		{
+			[]string{"http://node1", "http://node2"},
+			[]string{"cluster (avg)", "http://node1", "http://node2"},
+		},
+		{
+			[]string{"east/http://node1", "west/http://node2",
+				"west/http://node3"},
+			[]string{"east/cluster (avg)", "east/http://node1",
+				"west/cluster (avg)", "west/http://node2", "west/http://node3"},
+		},
+	}
+
+	for i, test := range tests {
+		rows := withClusterRows(test.nodesList, aggAvg)
+		if !reflect.DeepEqual(rows, test.expected) {
+			t.Errorf("Expected %v got %v %d", test.expected, rows, i)
+		}
+		for _, row := range rows {
+			if isClusterNode(row) != strings.Contains(row, "cluster (") {
+				t.Errorf("Expected %v got %v %d",
+					!isClusterNode(row), isClusterNode(row), i)
+			}
+		}
+	}
+}
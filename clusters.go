@@ -0,0 +1,208 @@
+//  Copyright 2023-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included
+//  in the file licenses/BSL-Couchbase.txt.  As of the Change Date specified
+//  in that file, in accordance with the Business Source License, use of this
+//  software will be governed by the Apache License, Version 2.0, included in
+//  the file licenses/APL2.txt.
+
+package main
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Connection string used when none is given
+const defaultConnectionString = "couchbase://127.0.0.1:12000"
+
+// Values of a flag that can be repeated
+type stringList []string
+
+func (list *stringList) String() string {
+	return strings.Join(*list, ",")
+}
+
+func (list *stringList) Set(val string) error {
+	*list = append(*list, val)
+	return nil
+}
+
+// A cluster to monitor, as given in the clusters file
+type clusterSpec struct {
+	// Prefix for the nodes of the cluster, empty for a single cluster
+	Name string `json:"name"`
+
+	ConnectionString string `json:"connection_string,omitempty"`
+
+	// Search nodes to poll directly instead of using the connection string
+	Nodes []string `json:"nodes,omitempty"`
+
+	// Override the -username and -password_file flags for the cluster
+	Username     string `json:"username,omitempty"`
+	PasswordFile string `json:"password_file,omitempty"`
+}
+
+// Build the list of clusters to monitor from the flags or the clusters file
+func clustersInit(connStrings []string, nodes string,
+	clustersFile string) ([]*clusterSpec, error) {
+
+	if clustersFile != "" {
+		if len(connStrings) != 0 || nodes != "" {
+			return nil, fmt.Errorf("-clusters cannot be used with " +
+				"-connection_string or -nodes")
+		}
+		return readClustersFile(clustersFile)
+	}
+
+	if len(connStrings) <= 1 {
+		spec := &clusterSpec{
+			ConnectionString: defaultConnectionString,
+		}
+		if len(connStrings) == 1 {
+			spec.ConnectionString = connStrings[0]
+		}
+		if nodes != "" {
+			spec.Nodes = strings.Split(nodes, ",")
+		}
+		return []*clusterSpec{spec}, nil
+	}
+
+	if nodes != "" {
+		return nil, fmt.Errorf("-nodes cannot be used with more than one " +
+			"-connection_string, use -clusters instead")
+	}
+
+	// Name the clusters after the host of their connection string
+	specs := make([]*clusterSpec, 0, len(connStrings))
+	names := make(map[string]int)
+
+	for _, connString := range connStrings {
+		name := connStringHost(connString)
+
+		names[name]++
+		if names[name] > 1 {
+			name = fmt.Sprintf("%s-%d", name, names[name])
+		}
+
+		specs = append(specs, &clusterSpec{
+			Name:             name,
+			ConnectionString: connString,
+		})
+	}
+
+	return specs, nil
+}
+
+// Read and validate the clusters file
+func readClustersFile(path string) ([]*clusterSpec, error) {
+
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read clusters file: %v", err)
+	}
+
+	var specs []*clusterSpec
+	err = json.Unmarshal(contents, &specs)
+	if err != nil {
+		return nil, fmt.Errorf("invalid clusters file: %v", err)
+	}
+
+	if len(specs) == 0 {
+		return nil, fmt.Errorf("no clusters in %s", path)
+	}
+
+	names := make(map[string]bool)
+
+	for i, spec := range specs {
+		if spec.Name == "" || strings.Contains(spec.Name, "/") {
+			return nil, fmt.Errorf("cluster %d needs a name without '/'", i)
+		}
+		if names[spec.Name] {
+			return nil, fmt.Errorf("cluster %s is defined more than once", spec.Name)
+		}
+		names[spec.Name] = true
+
+		if spec.ConnectionString == "" && len(spec.Nodes) == 0 {
+			return nil, fmt.Errorf("cluster %s needs a connection_string "+
+				"or nodes", spec.Name)
+		}
+	}
+
+	return specs, nil
+}
+
+// First host of a connection string, eg. 10.0.0.1:12000 for
+// couchbase://10.0.0.1:12000,10.0.0.2
+func connStringHost(connString string) string {
+
+	host := connString
+	if i := strings.Index(host, "://"); i >= 0 {
+		host = host[i+3:]
+	}
+	if i := strings.IndexAny(host, ",/?"); i >= 0 {
+		host = host[:i]
+	}
+
+	// Names cannot be empty since they prefix the nodes
+	if host == "" {
+		return "cluster"
+	}
+
+	return host
+}
+
+// A cluster connected to at startup
+type clusterConn struct {
+	spec      *clusterSpec
+	creds     *credentials
+	lister    nodeLister
+	nodesList []string
+}
+
+// Connect to a cluster and get its search nodes
+func connectCluster(spec *clusterSpec, creds *credentials,
+	tlsConfig *tls.Config) (*clusterConn, error) {
+
+	var lister nodeLister
+
+	if len(spec.Nodes) != 0 {
+
+		// Poll the given nodes directly
+		lister = staticNodes(spec.Nodes)
+	} else {
+
+		// Connect to cluster using the go sdk connector
+		cluster, err := clusterInit(spec.ConnectionString, creds, tlsConfig)
+		if err != nil {
+			return nil, fmt.Errorf("unable to connect to cluster: %v", err)
+		}
+
+		lister = &gocbNodes{cluster: cluster}
+	}
+
+	// Get a list of search node hostnames
+	nodesList, err := lister.SearchNodes()
+	if err != nil {
+		return nil, fmt.Errorf(
+			"unable to get node configuration from the server: %v", err,
+		)
+	}
+
+	// If the cluster has no search nodes
+	if len(nodesList) == 0 {
+		return nil, fmt.Errorf(
+			"unable to detect any active search nodes in the cluster",
+		)
+	}
+
+	return &clusterConn{
+		spec:      spec,
+		creds:     creds,
+		lister:    lister,
+		nodesList: nodesList,
+	}, nil
+}
@@ -0,0 +1,234 @@
+//  Copyright 2023-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included
+//  in the file licenses/BSL-Couchbase.txt.  As of the Change Date specified
+//  in that file, in accordance with the Business Source License, use of this
+//  software will be governed by the Apache License, Version 2.0, included in
+//  the file licenses/APL2.txt.
+
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	flag "github.com/couchbaselabs/chronos/cflag"
+	"github.com/couchbaselabs/chronos/fakenode"
+	"github.com/couchbaselabs/chronos/widgets"
+)
+
+func TestClustersInit(t *testing.T) {
+
+	dir := t.TempDir()
+
+	writeFile := func(name string, contents string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(contents), 0600); err != nil {
+			t.Fatalf("Unable to write %s %v", name, err)
+		}
+		return path
+	}
+
+	valid := writeFile("valid.json", `[
+		{"name": "east", "connection_string": "couchbase://10.0.0.1"},
+		{"name": "west", "nodes": ["http://10.1.0.1:8094"],
+			"username": "xdcr", "password_file": "/etc/west"}
+	]`)
+	duplicate := writeFile("duplicate.json", `[
+		{"name": "east", "connection_string": "couchbase://10.0.0.1"},
+		{"name": "east", "connection_string": "couchbase://10.0.0.2"}
+	]`)
+	unnamed := writeFile("unnamed.json", `[
+		{"connection_string": "couchbase://10.0.0.1"}
+	]`)
+
+	testCases := []struct {
+		connStrings  []string
+		nodes        string
+		clustersFile string
+		expected     []*clusterSpec
+		err          bool
+	}{
+		{
+			expected: []*clusterSpec{
+				{ConnectionString: defaultConnectionString},
+			},
+		},
+		{
+			connStrings: []string{"couchbase://10.0.0.1"},
+			nodes:       "http://10.0.0.1:8094,http://10.0.0.2:8094",
+			expected: []*clusterSpec{
+				{
+					ConnectionString: "couchbase://10.0.0.1",
+					Nodes: []string{
+						"http://10.0.0.1:8094", "http://10.0.0.2:8094",
+					},
+				},
+			},
+		},
+		{
+			connStrings: []string{
+				"couchbase://10.0.0.1,10.0.0.2", "couchbases://10.1.0.1:11207",
+				"couchbase://10.0.0.1?network=external",
+			},
+			expected: []*clusterSpec{
+				{Name: "10.0.0.1", ConnectionString: "couchbase://10.0.0.1,10.0.0.2"},
+				{Name: "10.1.0.1:11207", ConnectionString: "couchbases://10.1.0.1:11207"},
+				{Name: "10.0.0.1-2", ConnectionString: "couchbase://10.0.0.1?network=external"},
+			},
+		},
+		{
+			connStrings: []string{"couchbase://10.0.0.1", "couchbase://10.1.0.1"},
+			nodes:       "http://10.0.0.1:8094",
+			err:         true,
+		},
+		{
+			clustersFile: valid,
+			expected: []*clusterSpec{
+				{Name: "east", ConnectionString: "couchbase://10.0.0.1"},
+				{
+					Name:         "west",
+					Nodes:        []string{"http://10.1.0.1:8094"},
+					Username:     "xdcr",
+					PasswordFile: "/etc/west",
+				},
+			},
+		},
+		{
+			clustersFile: valid,
+			connStrings:  []string{"couchbase://10.0.0.1"},
+			err:          true,
+		},
+		{
+			clustersFile: duplicate,
+			err:          true,
+		},
+		{
+			clustersFile: unnamed,
+			err:          true,
+		},
+		{
+			clustersFile: filepath.Join(dir, "missing.json"),
+			err:          true,
+		},
+	}
+
+	for i, testCase := range testCases {
+
+		specs, err := clustersInit(
+			testCase.connStrings, testCase.nodes, testCase.clustersFile,
+		)
+		if (err != nil) != testCase.err {
+			t.Errorf("Expected error %v got %v %d", testCase.err, err, i)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+
+		if !reflect.DeepEqual(specs, testCase.expected) {
+			t.Errorf("Expected %+v got %+v %d", testCase.expected, specs, i)
+		}
+	}
+}
+
+func TestMonitorClusters(t *testing.T) {
+
+	scenario := &fakenode.Scenario{
+		Interval: time.Millisecond * time.Duration(100),
+		Stats: map[string]fakenode.Series{
+			"pct_cpu_gc": fakenode.Spike(0.01, 0.5, 1, 1000),
+		},
+	}
+
+	flag.CommandLine.Additional["pct_cpu_gc_max_val"] = "0.2"
+
+	names := []string{"east", "west"}
+	clusters := make(map[string]*fakenode.Cluster)
+	nodesList := make([]string, 0)
+
+	for _, name := range names {
+		cluster, err := fakenode.NewCluster(scenario, 1, 0, "user", "pass")
+		if err != nil {
+			t.Fatalf("Unable to start cluster %v", err)
+		}
+		defer cluster.Close()
+
+		clusters[name] = cluster
+
+		urls, _ := cluster.SearchNodes()
+		for _, url := range urls {
+			nodesList = append(nodesList, nodeKey(name, url))
+		}
+	}
+
+	stats := statsInit(&config{stats: make(map[string]*configStatInfo)}, nodesList)
+	channels := newChannels()
+	managers := make([]*manager, 0)
+
+	for _, name := range names {
+		urls, _ := clusters[name].SearchNodes()
+
+		manager := newManager(
+			context.Background(), name, urls, stats,
+			&credentials{username: "user", password: "pass"},
+			clusters[name], httpClientInit(nil), channels,
+		)
+		managers = append(managers, manager)
+
+		go monitorCluster(manager)
+	}
+
+	// Alerts seen from each cluster
+	alerted := make(map[string]*widgets.Event)
+
+	timeout := time.After(time.Second * time.Duration(20))
+
+	for len(alerted) < len(names) {
+		select {
+		case event := <-channels.eventChannel:
+			cluster, _ := widgets.SplitNodeKey(event.Node)
+			alerted[cluster] = event
+		case errorMsg := <-channels.errChannel:
+			if errorMsg.terminate {
+				t.Fatalf("Unexpected termination %v", errorMsg.description)
+			}
+		case <-channels.popupChannel:
+		case <-channels.updateChannel:
+		case <-timeout:
+			t.Fatalf("Timed out, alerted %v", alerted)
+		}
+	}
+
+	for _, name := range names {
+		event, ok := alerted[name]
+		if !ok {
+			t.Errorf("Expected alert from %v got %v", name, alerted)
+			continue
+		}
+
+		if !strings.HasPrefix(event.Node, name+"/http://") {
+			t.Errorf("Expected node of %v got %v", name, event.Node)
+		}
+
+		if event.Cluster != name {
+			t.Errorf("Expected %v got %v", name, event.Cluster)
+		}
+	}
+
+	go func() {
+		for range channels.eventChannel {
+		}
+	}()
+
+	for _, manager := range managers {
+		if !manager.stop(time.Second * time.Duration(5)) {
+			t.Errorf("Expected polls to stop got still running")
+		}
+	}
+}
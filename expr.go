@@ -0,0 +1,426 @@
+//  Copyright 2023-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included
+//  in the file licenses/BSL-Couchbase.txt.  As of the Change Date specified
+//  in that file, in accordance with the Business Source License, use of this
+//  software will be governed by the Apache License, Version 2.0, included in
+//  the file licenses/APL2.txt.
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Expressions of derived stats, built from:
+//
+//	numbers:    1, 0.5, 1e6
+//	stats:      total_gc, bucket:index:num_recs or "*:*:num_recs" when the
+//	            name holds other characters
+//	operators:  + - * / and parentheses
+//	rate(expr): change of expr per second since the previous chunk
+//
+// An expression is NaN when a stat it uses is missing from the chunk
+//
+// Rule conditions use the same expressions over the samples of a node,
+// see rules.go
+
+// Stat computed from the other stats of every chunk
+type derivedStat struct {
+	name string
+	expr expr
+}
+
+// Node of a parsed expression
+type expr interface {
+	eval(env *exprEnv) float64
+}
+
+// Values an expression is evaluated against
+type exprEnv struct {
+	vals       map[string]float64
+	sampleTime time.Time
+
+	// Previous value of every rate for the node the chunk came from
+	rates map[*rateExpr]rateSample
+
+	// Node a rule is checked against instead of a chunk, and the stat
+	// $stat stands for
+	series *nodeSeries
+	stat   string
+}
+
+// Name of a stat in the expression, resolving $stat
+func (env *exprEnv) statName(name string) string {
+	if name == thisStat {
+		return env.stat
+	}
+	return name
+}
+
+type numberExpr float64
+
+func (e numberExpr) eval(env *exprEnv) float64 {
+	return float64(e)
+}
+
+type statExpr string
+
+func (e statExpr) eval(env *exprEnv) float64 {
+
+	// Rules read the latest sample of the node
+	if env.series != nil {
+		if buffer, ok := env.series.buffers[env.statName(string(e))]; ok {
+			return buffer.last()
+		}
+		return math.NaN()
+	}
+
+	if val, ok := env.vals[string(e)]; ok {
+		return val
+	}
+	return math.NaN()
+}
+
+type negExpr struct {
+	operand expr
+}
+
+func (e *negExpr) eval(env *exprEnv) float64 {
+	return -e.operand.eval(env)
+}
+
+type binaryExpr struct {
+	op          byte
+	left, right expr
+}
+
+func (e *binaryExpr) eval(env *exprEnv) float64 {
+
+	left, right := e.left.eval(env), e.right.eval(env)
+
+	switch e.op {
+	case '+':
+		return left + right
+	case '-':
+		return left - right
+	case '*':
+		return left * right
+	default:
+		return left / right
+	}
+}
+
+// Value of a rate at the previous chunk
+type rateSample struct {
+	val        float64
+	sampleTime time.Time
+}
+
+type rateExpr struct {
+	operand expr
+}
+
+// Change per second since the previous chunk, NaN for the first chunk and
+// when the value went down since counters only go down when reset
+func (e *rateExpr) eval(env *exprEnv) float64 {
+
+	val := e.operand.eval(env)
+
+	prev, ok := env.rates[e]
+	env.rates[e] = rateSample{val: val, sampleTime: env.sampleTime}
+
+	elapsed := env.sampleTime.Sub(prev.sampleTime).Seconds()
+	if !ok || elapsed <= 0 || val < prev.val {
+		return math.NaN()
+	}
+
+	return (val - prev.val) / elapsed
+}
+
+// Add the derived stats to a chunk sampled at sampleTime
+// rates holds the previous values of the rates for the node
+func addDerivedStats(derived []*derivedStat, incomingStats map[string]float64,
+	sampleTime time.Time, rates map[*rateExpr]rateSample) {
+
+	if len(derived) == 0 {
+		return
+	}
+
+	env := &exprEnv{
+		vals:       incomingStats,
+		sampleTime: sampleTime,
+		rates:      rates,
+	}
+
+	// Computed before any is added so they cannot depend on each other
+	vals := make([]float64, len(derived))
+	for i, stat := range derived {
+		vals[i] = stat.expr.eval(env)
+
+		// Division by zero has no value either
+		if math.IsInf(vals[i], 0) {
+			vals[i] = math.NaN()
+		}
+	}
+
+	for i, stat := range derived {
+		incomingStats[stat.name] = vals[i]
+	}
+}
+
+// Parse definitions of the form name=expression
+func parseDerivedStats(defs []string) ([]*derivedStat, error) {
+
+	derived := make([]*derivedStat, 0, len(defs))
+	names := make(map[string]bool)
+
+	for _, def := range defs {
+		name, source, ok := strings.Cut(def, "=")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" || !isStatName(name) {
+			return nil, fmt.Errorf("invalid derived stat %q, "+
+				"expected name=expression", def)
+		}
+
+		if names[name] {
+			return nil, fmt.Errorf("derived stat %s defined twice", name)
+		}
+		names[name] = true
+
+		expr, err := parseExpr(source)
+		if err != nil {
+			return nil, fmt.Errorf("derived stat %s: %v", name, err)
+		}
+
+		derived = append(derived, &derivedStat{name: name, expr: expr})
+	}
+
+	return derived, nil
+}
+
+// Read the definitions of a derived stats file, one name = expression
+// per line, ignoring blank lines and lines starting with #
+func readDerivedFile(path string) ([]string, error) {
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	defs := make([]string, 0)
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		defs = append(defs, line)
+	}
+
+	return defs, scanner.Err()
+}
+
+// Characters of stat names that can be written without quotes
+func isStatChar(c byte) bool {
+	return c == '_' || c == ':' || c == '.' ||
+		('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') ||
+		('0' <= c && c <= '9')
+}
+
+func isStatName(name string) bool {
+	for i := 0; i < len(name); i++ {
+		if !isStatChar(name[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// Recursive descent parser over the source of an expression
+type exprParser struct {
+	source string
+	pos    int
+
+	// Parsing a rule condition, which can use the functions of rules.go
+	// and $stat
+	rule bool
+}
+
+func parseExpr(source string) (expr, error) {
+
+	parser := &exprParser{source: source}
+
+	expr, err := parser.sum()
+	if err != nil {
+		return nil, err
+	}
+
+	if parser.peek() != 0 {
+		return nil, parser.errorf("unexpected %q", parser.peek())
+	}
+
+	return expr, nil
+}
+
+func (p *exprParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("at %d of %q: %s",
+		p.pos, p.source, fmt.Sprintf(format, args...))
+}
+
+// Next character after any spaces, 0 at the end
+func (p *exprParser) peek() byte {
+	for p.pos < len(p.source) && p.source[p.pos] == ' ' {
+		p.pos++
+	}
+	if p.pos == len(p.source) {
+		return 0
+	}
+	return p.source[p.pos]
+}
+
+// sum := product (('+' | '-') product)*
+func (p *exprParser) sum() (expr, error) {
+
+	left, err := p.product()
+	if err != nil {
+		return nil, err
+	}
+
+	for op := p.peek(); op == '+' || op == '-'; op = p.peek() {
+		p.pos++
+		right, err := p.product()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryExpr{op: op, left: left, right: right}
+	}
+
+	return left, nil
+}
+
+// product := unary (('*' | '/') unary)*
+func (p *exprParser) product() (expr, error) {
+
+	left, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+
+	for op := p.peek(); op == '*' || op == '/'; op = p.peek() {
+		p.pos++
+		right, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryExpr{op: op, left: left, right: right}
+	}
+
+	return left, nil
+}
+
+// unary := '-' unary | primary
+func (p *exprParser) unary() (expr, error) {
+
+	if p.peek() == '-' {
+		p.pos++
+		operand, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return &negExpr{operand: operand}, nil
+	}
+
+	return p.primary()
+}
+
+// primary := number | stat | '"' stat '"' | 'rate(' sum ')' | '(' sum ')'
+// Rules also have '$stat' and the window functions
+func (p *exprParser) primary() (expr, error) {
+
+	c := p.peek()
+
+	switch {
+	case c == 0:
+		return nil, p.errorf("missing operand")
+
+	case c == '$' && p.rule:
+		return p.thisStat()
+
+	case c == '(':
+		p.pos++
+		inner, err := p.sum()
+		if err != nil {
+			return nil, err
+		}
+		return inner, p.expect(')')
+
+	case c == '"':
+		end := strings.IndexByte(p.source[p.pos+1:], '"')
+		if end <= 0 {
+			return nil, p.errorf("unterminated stat name")
+		}
+		name := p.source[p.pos+1 : p.pos+1+end]
+		p.pos += end + 2
+		return statExpr(name), nil
+
+	case isStatChar(c):
+		start := p.pos
+		for p.pos < len(p.source) && isStatChar(p.source[p.pos]) {
+			p.pos++
+		}
+		word := p.source[start:p.pos]
+
+		// Numbers can have an exponent such as 1e-3
+		if '0' <= c && c <= '9' || c == '.' {
+			if strings.HasSuffix(word, "e") || strings.HasSuffix(word, "E") {
+				if p.pos < len(p.source) &&
+					(p.source[p.pos] == '+' || p.source[p.pos] == '-') {
+					p.pos++
+					for p.pos < len(p.source) && isStatChar(p.source[p.pos]) {
+						p.pos++
+					}
+					word = p.source[start:p.pos]
+				}
+			}
+			val, err := strconv.ParseFloat(word, 64)
+			if err != nil {
+				return nil, p.errorf("invalid number %s", word)
+			}
+			return numberExpr(val), nil
+		}
+
+		if p.rule && p.peek() == '(' {
+			return p.window(word)
+		}
+
+		if word == "rate" && p.peek() == '(' {
+			p.pos++
+			operand, err := p.sum()
+			if err != nil {
+				return nil, err
+			}
+			return &rateExpr{operand: operand}, p.expect(')')
+		}
+
+		return statExpr(word), nil
+	}
+
+	return nil, p.errorf("unexpected %q", c)
+}
+
+func (p *exprParser) expect(c byte) error {
+	if p.peek() != c {
+		return p.errorf("expected %q", c)
+	}
+	p.pos++
+	return nil
+}
@@ -0,0 +1,181 @@
+//  Copyright 2023-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included
+//  in the file licenses/BSL-Couchbase.txt.  As of the Change Date specified
+//  in that file, in accordance with the Business Source License, use of this
+//  software will be governed by the Apache License, Version 2.0, included in
+//  the file licenses/APL2.txt.
+
+package main
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseExpr(t *testing.T) {
+
+	vals := map[string]float64{
+		"batch_bytes_added":   10,
+		"batch_bytes_removed": 4,
+		"b1:idx:num_recs":     3,
+		"*:*:num_recs":        7,
+	}
+
+	testCases := []struct {
+		source   string
+		expected float64
+		valid    bool
+	}{
+		{"batch_bytes_added - batch_bytes_removed", 6, true},
+		{"batch_bytes_added-batch_bytes_removed*2", 2, true},
+		{"(batch_bytes_added - batch_bytes_removed) * 2", 12, true},
+		{"-batch_bytes_added / 4", -2.5, true},
+		{"b1:idx:num_recs + \"*:*:num_recs\"", 10, true},
+		{"1e-3 * 2e3", 2, true},
+		{"unknown_stat + 1", math.NaN(), true},
+		{"batch_bytes_added -", 0, false},
+		{"(batch_bytes_added", 0, false},
+		{"batch_bytes_added batch_bytes_removed", 0, false},
+		{"\"*:*:num_recs", 0, false},
+		{"1.2.3", 0, false},
+		{"", 0, false},
+	}
+
+	env := &exprEnv{vals: vals, rates: make(map[*rateExpr]rateSample)}
+
+	for i, testCase := range testCases {
+		expr, err := parseExpr(testCase.source)
+		if (err == nil) != testCase.valid {
+			t.Errorf("Expected %v got %v %d", testCase.valid, err, i)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if val := expr.eval(env); !sameValue(val, testCase.expected) {
+			t.Errorf("Expected %v got %v %d", testCase.expected, val, i)
+		}
+	}
+}
+
+func TestAddDerivedStats(t *testing.T) {
+
+	derived, err := parseDerivedStats([]string{
+		"gc_rate=rate(total_gc)",
+		"net_bytes = batch_bytes_added - batch_bytes_removed",
+		"per_batch=batch_bytes_added / tot_batches_new",
+	})
+	if err != nil {
+		t.Fatalf("Unable to parse derived stats %v", err)
+	}
+
+	start := time.UnixMilli(1690000000000)
+	rates := make(map[*rateExpr]rateSample)
+
+	testCases := []struct {
+		offset   time.Duration
+		vals     map[string]float64
+		expected map[string]float64
+	}{
+		// No rate for the first chunk
+		{
+			offset: 0,
+			vals: map[string]float64{
+				"total_gc": 10, "batch_bytes_added": 8, "batch_bytes_removed": 3,
+				"tot_batches_new": 0,
+			},
+			expected: map[string]float64{
+				"gc_rate": math.NaN(), "net_bytes": 5, "per_batch": math.NaN(),
+			},
+		},
+		{
+			offset: time.Second * time.Duration(2),
+			vals: map[string]float64{
+				"total_gc": 16, "batch_bytes_added": 8, "batch_bytes_removed": 3,
+				"tot_batches_new": 2,
+			},
+			expected: map[string]float64{
+				"gc_rate": 3, "net_bytes": 5, "per_batch": 4,
+			},
+		},
+		// Counter reset
+		{
+			offset: time.Second * time.Duration(3),
+			vals: map[string]float64{
+				"total_gc": 1, "tot_batches_new": 2,
+			},
+			expected: map[string]float64{
+				"gc_rate": math.NaN(), "net_bytes": math.NaN(), "per_batch": math.NaN(),
+			},
+		},
+		{
+			offset: time.Second * time.Duration(4),
+			vals: map[string]float64{
+				"total_gc": 5,
+			},
+			expected: map[string]float64{
+				"gc_rate": 4, "net_bytes": math.NaN(), "per_batch": math.NaN(),
+			},
+		},
+	}
+
+	for i, testCase := range testCases {
+		addDerivedStats(derived, testCase.vals, start.Add(testCase.offset), rates)
+
+		for stat, expected := range testCase.expected {
+			if val, ok := testCase.vals[stat]; !ok || !sameValue(val, expected) {
+				t.Errorf("Expected %v got %v %s %d", expected, val, stat, i)
+			}
+		}
+	}
+}
+
+func TestParseDerivedStats(t *testing.T) {
+
+	testCases := []struct {
+		defs  []string
+		names []string
+		valid bool
+	}{
+		{[]string{"a=x+1", "b = rate(y)"}, []string{"a", "b"}, true},
+		{[]string{"x+1"}, nil, false},
+		{[]string{"=x"}, nil, false},
+		{[]string{"a b=x"}, nil, false},
+		{[]string{"a=x", "a=y"}, nil, false},
+		{[]string{"a=rate(x"}, nil, false},
+	}
+
+	for i, testCase := range testCases {
+		derived, err := parseDerivedStats(testCase.defs)
+		if (err == nil) != testCase.valid {
+			t.Errorf("Expected %v got %v %d", testCase.valid, err, i)
+			continue
+		}
+
+		names := make([]string, 0)
+		for _, stat := range derived {
+			names = append(names, stat.name)
+		}
+		if testCase.valid && !reflect.DeepEqual(names, testCase.names) {
+			t.Errorf("Expected %v got %v %d", testCase.names, names, i)
+		}
+	}
+
+	path := filepath.Join(t.TempDir(), "derived")
+	os.WriteFile(path, []byte("# Rates\ngc_rate = rate(total_gc)\n\n"+
+		"net_bytes = batch_bytes_added - batch_bytes_removed\n"), 0600)
+
+	defs, err := readDerivedFile(path)
+	expected := []string{
+		"gc_rate = rate(total_gc)",
+		"net_bytes = batch_bytes_added - batch_bytes_removed",
+	}
+	if err != nil || !reflect.DeepEqual(defs, expected) {
+		t.Errorf("Expected %v got %v %v", expected, defs, err)
+	}
+}
@@ -0,0 +1,84 @@
+//  Copyright 2023-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included
+//  in the file licenses/BSL-Couchbase.txt.  As of the Change Date specified
+//  in that file, in accordance with the Business Source License, use of this
+//  software will be governed by the Apache License, Version 2.0, included in
+//  the file licenses/APL2.txt.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	flag "github.com/couchbaselabs/chronos/cflag"
+	"github.com/couchbaselabs/chronos/fakenode"
+)
+
+// Runs the 'chronos fakenode' subcommand
+// Serves a cluster of fake search nodes following a scenario until interrupted
+func runFakeNode(args []string) int {
+
+	flags := flag.NewFlagSet("fakenode", flag.ExitOnError)
+
+	scenarioName := flags.String(
+		"scenario", "steady", "Provide the scenario to follow ("+
+			strings.Join(fakenode.ScenarioNames(), ", ")+")",
+	)
+	numNodes := flags.Int(
+		"num_nodes", 1, "Provide the number of nodes to serve",
+	)
+	port := flags.Int(
+		"port", 9200, "Provide the port of the first node, the others "+
+			"use the following ports",
+	)
+	interval := flags.Duration(
+		"interval", time.Second, "Provide the time between two chunks",
+	)
+	username := flags.String(
+		"username", "", "Provide the username the nodes expect",
+	)
+	password := flags.String(
+		"password", "", "Provide the password the nodes expect",
+	)
+
+	flags.Parse(args)
+
+	if len(flags.Additional) != 0 {
+		for name := range flags.Additional {
+			fmt.Println("fakenode: Invalid flag", name)
+		}
+		return 2
+	}
+
+	newScenario, ok := fakenode.Scenarios[*scenarioName]
+	if !ok {
+		fmt.Println("fakenode: Unknown scenario", *scenarioName)
+		return 2
+	}
+
+	cluster, err := fakenode.NewCluster(
+		newScenario(*interval), *numNodes, *port, *username, *password,
+	)
+	if err != nil {
+		fmt.Println("fakenode: Unable to start nodes:", err)
+		return 1
+	}
+	defer cluster.Close()
+
+	nodesList, _ := cluster.SearchNodes()
+
+	fmt.Printf("Serving scenario %s on %s\n", *scenarioName,
+		strings.Join(nodesList, ", "))
+	fmt.Printf("Monitor with: chronos -nodes %s\n", strings.Join(nodesList, ","))
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	<-interrupt
+
+	return 0
+}
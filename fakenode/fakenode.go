@@ -0,0 +1,304 @@
+//  Copyright 2023-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included
+//  in the file licenses/BSL-Couchbase.txt.  As of the Change Date specified
+//  in that file, in accordance with the Business Source License, use of this
+//  software will be governed by the Apache License, Version 2.0, included in
+//  the file licenses/APL2.txt.
+
+// Package fakenode serves the FTS endpoints used by chronos from scripted
+// scenarios, so that chronos can be run and tested without a cluster
+package fakenode
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Structure of chunk sent on /api/statsStream
+type chunk struct {
+	Stats               map[string]float64 `json:"stats,omitempty"`
+	RebalanceInProgress bool               `json:"rebalance,omitempty"`
+	Timestamp           int64              `json:"timestamp,omitempty"`
+}
+
+// A single fake search node serving /api/statsStream and /api/manager
+type Node struct {
+	scenario *Scenario
+
+	// Credentials expected from the client, no checks if username is empty
+	username string
+	password string
+
+	server   *http.Server
+	listener net.Listener
+
+	// Number of chunks sent across all the streams
+	tick int
+
+	// Lock for tick
+	lock sync.Mutex
+}
+
+// Start a new fake node listening on addr, e.g. "127.0.0.1:0"
+func NewNode(scenario *Scenario, addr string, username string,
+	password string) (*Node, error) {
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	node := &Node{
+		scenario: scenario,
+		username: username,
+		password: password,
+		listener: listener,
+	}
+
+	mux := http.NewServeMux()
+	if !scenario.NoStream {
+		mux.HandleFunc("/api/statsStream", node.handleStatsStream)
+	}
+	mux.HandleFunc("/api/nsstats", node.handleNsStats)
+	mux.HandleFunc("/api/manager", node.handleManager)
+
+	node.server = &http.Server{Handler: mux}
+
+	go node.server.Serve(listener)
+
+	return node, nil
+}
+
+// Address of the node in the form used by chronos
+func (node *Node) URL() string {
+	return "http://" + node.listener.Addr().String()
+}
+
+// Stop the node and close all the open streams
+func (node *Node) Close() error {
+	return node.server.Close()
+}
+
+// Get the chunk number for the next chunk
+func (node *Node) nextTick() int {
+
+	node.lock.Lock()
+	defer node.lock.Unlock()
+
+	tick := node.tick
+	node.tick++
+
+	return tick
+}
+
+// Check the basic auth credentials of a request
+func (node *Node) authorized(req *http.Request) bool {
+
+	if node.username == "" {
+		return true
+	}
+
+	username, password, ok := req.BasicAuth()
+
+	return ok && username == node.username && password == node.password
+}
+
+// Stream chunks following the scenario until the client goes away
+// or the scenario drops the connection
+func (node *Node) handleStatsStream(w http.ResponseWriter, req *http.Request) {
+
+	if !node.authorized(req) {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	enc := json.NewEncoder(w)
+	ticker := time.NewTicker(node.scenario.Interval)
+	defer ticker.Stop()
+
+	for sent := 0; node.scenario.DropAfter == 0 ||
+		sent < node.scenario.DropAfter; sent++ {
+
+		select {
+		case <-req.Context().Done():
+			return
+		case <-ticker.C:
+		}
+
+		tick := node.nextTick()
+
+		if node.scenario.Delay != nil {
+			select {
+			case <-req.Context().Done():
+				return
+			case <-time.After(node.scenario.Delay(tick)):
+			}
+		}
+
+		// Sampled after any delay, like a server that fell behind
+		c := &chunk{
+			Stats:     node.scenario.chunk(tick),
+			Timestamp: time.Now().UnixMilli(),
+		}
+		if node.scenario.Rebalance != nil {
+			c.RebalanceInProgress = node.scenario.Rebalance(tick)
+		}
+
+		if err := enc.Encode(c); err != nil {
+			return
+		}
+		flusher.Flush()
+	}
+}
+
+// Respond with the next chunk of stats as a flat map
+func (node *Node) handleNsStats(w http.ResponseWriter, req *http.Request) {
+
+	if !node.authorized(req) {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(node.scenario.chunk(node.nextTick()))
+}
+
+// Respond with the manager options used by chronos
+func (node *Node) handleManager(w http.ResponseWriter, req *http.Request) {
+
+	if !node.authorized(req) {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	options := make(map[string]interface{})
+	if node.scenario.MemoryQuota != 0 {
+		options["ftsMemoryQuota"] =
+			strconv.FormatFloat(node.scenario.MemoryQuota, 'f', -1, 64)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status": "ok",
+		"mgr": map[string]interface{}{
+			"options": options,
+		},
+	})
+}
+
+// A set of fake search nodes standing in for a cluster
+type Cluster struct {
+	scenario *Scenario
+	username string
+	password string
+
+	// Nodes currently part of the cluster
+	nodes []*Node
+
+	// Lock for nodes
+	lock sync.RWMutex
+}
+
+// Start a cluster of numNodes fake nodes following the same scenario
+// Nodes listen on consecutive ports starting from basePort, or on random
+// ports if basePort is 0
+func NewCluster(scenario *Scenario, numNodes int, basePort int,
+	username string, password string) (*Cluster, error) {
+
+	cluster := &Cluster{
+		scenario: scenario,
+		username: username,
+		password: password,
+		nodes:    make([]*Node, 0),
+	}
+
+	for i := 0; i < numNodes; i++ {
+
+		port := 0
+		if basePort != 0 {
+			port = basePort + i
+		}
+
+		_, err := cluster.AddNode(fmt.Sprintf("127.0.0.1:%d", port))
+		if err != nil {
+			cluster.Close()
+			return nil, err
+		}
+	}
+
+	return cluster, nil
+}
+
+// Start a new node in the cluster listening on addr
+func (cluster *Cluster) AddNode(addr string) (*Node, error) {
+
+	node, err := NewNode(
+		cluster.scenario, addr, cluster.username, cluster.password,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	cluster.lock.Lock()
+	cluster.nodes = append(cluster.nodes, node)
+	cluster.lock.Unlock()
+
+	return node, nil
+}
+
+// Stop a node and remove it from the cluster
+func (cluster *Cluster) RemoveNode(url string) {
+
+	cluster.lock.Lock()
+	defer cluster.lock.Unlock()
+
+	for i, node := range cluster.nodes {
+		if node.URL() == url {
+			node.Close()
+			cluster.nodes = append(cluster.nodes[:i], cluster.nodes[i+1:]...)
+			return
+		}
+	}
+}
+
+// List of the search nodes currently in the cluster
+func (cluster *Cluster) SearchNodes() ([]string, error) {
+
+	cluster.lock.RLock()
+	defer cluster.lock.RUnlock()
+
+	nodesList := make([]string, 0, len(cluster.nodes))
+	for _, node := range cluster.nodes {
+		nodesList = append(nodesList, node.URL())
+	}
+
+	return nodesList, nil
+}
+
+// Stop all the nodes in the cluster
+func (cluster *Cluster) Close() {
+
+	cluster.lock.Lock()
+	defer cluster.lock.Unlock()
+
+	for _, node := range cluster.nodes {
+		node.Close()
+	}
+	cluster.nodes = nil
+}
@@ -0,0 +1,161 @@
+//  Copyright 2023-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included
+//  in the file licenses/BSL-Couchbase.txt.  As of the Change Date specified
+//  in that file, in accordance with the Business Source License, use of this
+//  software will be governed by the Apache License, Version 2.0, included in
+//  the file licenses/APL2.txt.
+
+package fakenode
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestSeries(t *testing.T) {
+
+	testCases := []struct {
+		series Series
+		tick   int
+		val    float64
+		ok     bool
+	}{
+		{Constant(5), 0, 5, true},
+		{Constant(5), 100, 5, true},
+		{Ramp(10, 2), 0, 10, true},
+		{Ramp(10, 2), 5, 20, true},
+		{Spike(1, 9, 3, 2), 2, 1, true},
+		{Spike(1, 9, 3, 2), 3, 9, true},
+		{Spike(1, 9, 3, 2), 4, 9, true},
+		{Spike(1, 9, 3, 2), 5, 1, true},
+		{Window(Constant(1), 2, 4), 1, 0, false},
+		{Window(Constant(1), 2, 4), 2, 1, true},
+		{Window(Constant(1), 2, 4), 4, 0, false},
+		{Window(Constant(1), 2, 0), 400, 1, true},
+	}
+
+	for i, testCase := range testCases {
+
+		val, ok := testCase.series(testCase.tick)
+
+		if val != testCase.val || ok != testCase.ok {
+			t.Errorf("Expected %v %v got %v %v %d",
+				testCase.val, testCase.ok, val, ok, i)
+		}
+	}
+}
+
+func TestStatsStream(t *testing.T) {
+
+	scenario := &Scenario{
+		Interval: time.Millisecond * time.Duration(10),
+		Stats: map[string]Series{
+			"stat1": Ramp(0, 1),
+			"stat2": Window(Constant(7), 1, 2),
+		},
+		Rebalance: func(tick int) bool {
+			return tick == 2
+		},
+		DropAfter:   3,
+		MemoryQuota: 1024,
+	}
+
+	cluster, err := NewCluster(scenario, 2, 0, "user", "pass")
+	if err != nil {
+		t.Fatalf("Unable to start cluster %v", err)
+	}
+	defer cluster.Close()
+
+	nodesList, _ := cluster.SearchNodes()
+	if len(nodesList) != 2 {
+		t.Fatalf("Expected %v got %v", 2, len(nodesList))
+	}
+
+	// Requests without credentials are rejected
+	resp, err := http.Get(nodesList[0] + "/api/statsStream")
+	if err != nil {
+		t.Fatalf("Request failed %v", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Expected %v got %v", http.StatusUnauthorized, resp.StatusCode)
+	}
+
+	req, _ := http.NewRequest("GET", nodesList[0]+"/api/statsStream", nil)
+	req.SetBasicAuth("user", "pass")
+
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Request failed %v", err)
+	}
+	defer resp.Body.Close()
+
+	dec := json.NewDecoder(resp.Body)
+
+	expected := []chunk{
+		{Stats: map[string]float64{"stat1": 0}},
+		{Stats: map[string]float64{"stat1": 1, "stat2": 7}},
+		{Stats: map[string]float64{"stat1": 2}, RebalanceInProgress: true},
+	}
+
+	for i, exp := range expected {
+
+		var c chunk
+		if err := dec.Decode(&c); err != nil {
+			t.Fatalf("Unable to decode chunk %v %d", err, i)
+		}
+
+		if len(c.Stats) != len(exp.Stats) ||
+			c.RebalanceInProgress != exp.RebalanceInProgress {
+			t.Errorf("Expected %v got %v %d", exp, c, i)
+			continue
+		}
+
+		for stat, val := range exp.Stats {
+			if c.Stats[stat] != val {
+				t.Errorf("Expected %v got %v %d", exp, c, i)
+			}
+		}
+	}
+
+	// Stream is dropped after 3 chunks
+	var c chunk
+	if err := dec.Decode(&c); err != io.EOF {
+		t.Errorf("Expected %v got %v", io.EOF, err)
+	}
+
+	req, _ = http.NewRequest("GET", nodesList[1]+"/api/manager", nil)
+	req.SetBasicAuth("user", "pass")
+
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Request failed %v", err)
+	}
+	defer resp.Body.Close()
+
+	var respMsg struct {
+		Mgr struct {
+			Options map[string]string `json:"options"`
+		} `json:"mgr"`
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&respMsg); err != nil {
+		t.Fatalf("Unable to decode response %v", err)
+	}
+
+	if respMsg.Mgr.Options["ftsMemoryQuota"] != "1024" {
+		t.Errorf("Expected %v got %v", "1024", respMsg.Mgr.Options["ftsMemoryQuota"])
+	}
+
+	cluster.RemoveNode(nodesList[0])
+
+	nodesList, _ = cluster.SearchNodes()
+	if len(nodesList) != 1 {
+		t.Errorf("Expected %v got %v", 1, len(nodesList))
+	}
+}
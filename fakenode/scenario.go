@@ -0,0 +1,216 @@
+//  Copyright 2023-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included
+//  in the file licenses/BSL-Couchbase.txt.  As of the Change Date specified
+//  in that file, in accordance with the Business Source License, use of this
+//  software will be governed by the Apache License, Version 2.0, included in
+//  the file licenses/APL2.txt.
+
+package fakenode
+
+import (
+	"sort"
+	"time"
+)
+
+// Generates the value of a stat for the given chunk number
+// Returns false if the stat should be left out of the chunk
+type Series func(tick int) (float64, bool)
+
+// Script followed by a fake node while streaming stats
+type Scenario struct {
+
+	// Time between two chunks
+	Interval time.Duration
+
+	// Stats sent in every chunk
+	Stats map[string]Series
+
+	// Reports if the rebalance flag is set for a chunk, nil for never
+	Rebalance func(tick int) bool
+
+	// Additional delay before sending a chunk, nil for none
+	Delay func(tick int) time.Duration
+
+	// Number of chunks after which the stream is closed by the node
+	// 0 to keep the stream open
+	DropAfter int
+
+	// FTS memory quota returned by /api/manager, 0 to leave it out
+	MemoryQuota float64
+
+	// Leave out /api/statsStream like FTS versions without the streaming
+	// endpoint, stats are then only served on /api/nsstats
+	NoStream bool
+}
+
+// Series with the same value for every chunk
+func Constant(val float64) Series {
+	return func(tick int) (float64, bool) {
+		return val, true
+	}
+}
+
+// Series increasing by step with every chunk
+func Ramp(start float64, step float64) Series {
+	return func(tick int) (float64, bool) {
+		return start + step*float64(tick), true
+	}
+}
+
+// Series staying at base except for width chunks starting from at
+func Spike(base float64, peak float64, at int, width int) Series {
+	return func(tick int) (float64, bool) {
+		if tick >= at && tick < at+width {
+			return peak, true
+		}
+		return base, true
+	}
+}
+
+// Series only present in the chunks from start up to (not including) end
+// An end of 0 keeps the stat present once it appears
+func Window(series Series, start int, end int) Series {
+	return func(tick int) (float64, bool) {
+		if tick < start || (end > 0 && tick >= end) {
+			return 0, false
+		}
+		return series(tick)
+	}
+}
+
+// Builds the stats of a chunk from the scenario
+func (scenario *Scenario) chunk(tick int) map[string]float64 {
+
+	stats := make(map[string]float64)
+
+	for stat, series := range scenario.Stats {
+		if val, ok := series(tick); ok {
+			stats[stat] = val
+		}
+	}
+
+	return stats
+}
+
+// Stats common to all the scenarios, staying constant
+func baseStats() map[string]Series {
+	return map[string]Series{
+		"batch_bytes_added":              Constant(1024),
+		"batch_bytes_removed":            Constant(512),
+		"curr_batches_blocked_by_herder": Constant(0),
+		"num_bytes_used_ram":             Constant(200000000),
+		"pct_cpu_gc":                     Constant(0.01),
+		"tot_batches_new":                Ramp(0, 10),
+		"total_gc":                       Ramp(0, 1),
+		"utilization:cpuPercent":         Constant(20),
+	}
+}
+
+// Scenarios available by name
+var Scenarios = map[string]func(interval time.Duration) *Scenario{
+
+	// Constant stats with no events
+	"steady": func(interval time.Duration) *Scenario {
+		return &Scenario{
+			Interval:    interval,
+			Stats:       baseStats(),
+			MemoryQuota: 512000000,
+		}
+	},
+
+	// Memory usage growing until it crosses the memory quota
+	"ramp": func(interval time.Duration) *Scenario {
+		stats := baseStats()
+		stats["num_bytes_used_ram"] = Ramp(200000000, 5000000)
+		return &Scenario{
+			Interval:    interval,
+			Stats:       stats,
+			MemoryQuota: 512000000,
+		}
+	},
+
+	// Short bursts of garbage collection and cpu usage
+	"spike": func(interval time.Duration) *Scenario {
+		stats := baseStats()
+		stats["pct_cpu_gc"] = Spike(0.01, 0.5, 10, 3)
+		stats["utilization:cpuPercent"] = Spike(20, 95, 20, 5)
+		return &Scenario{
+			Interval:    interval,
+			Stats:       stats,
+			MemoryQuota: 512000000,
+		}
+	},
+
+	// Node closing the stream every 15 chunks
+	"drop": func(interval time.Duration) *Scenario {
+		return &Scenario{
+			Interval:    interval,
+			Stats:       baseStats(),
+			DropAfter:   15,
+			MemoryQuota: 512000000,
+		}
+	},
+
+	// Every tenth chunk arriving late by three intervals
+	"slow": func(interval time.Duration) *Scenario {
+		return &Scenario{
+			Interval: interval,
+			Stats:    baseStats(),
+			Delay: func(tick int) time.Duration {
+				if tick%10 == 9 {
+					return 3 * interval
+				}
+				return 0
+			},
+			MemoryQuota: 512000000,
+		}
+	},
+
+	// Rebalance running from the tenth to the twentieth chunk
+	"rebalance": func(interval time.Duration) *Scenario {
+		return &Scenario{
+			Interval: interval,
+			Stats:    baseStats(),
+			Rebalance: func(tick int) bool {
+				return tick >= 10 && tick < 20
+			},
+			MemoryQuota: 512000000,
+		}
+	},
+
+	// Older node without the streaming endpoint
+	"legacy": func(interval time.Duration) *Scenario {
+		return &Scenario{
+			Interval:    interval,
+			Stats:       baseStats(),
+			MemoryQuota: 512000000,
+			NoStream:    true,
+		}
+	},
+
+	// Index level stats appearing and disappearing as indexes come and go
+	"churn": func(interval time.Duration) *Scenario {
+		stats := baseStats()
+		stats["travel:idx1:doc_count"] = Window(Ramp(0, 100), 5, 0)
+		stats["travel:idx2:doc_count"] = Window(Ramp(0, 50), 10, 30)
+		stats["tot_rollback_full"] = Window(Constant(0), 0, 20)
+		return &Scenario{
+			Interval:    interval,
+			Stats:       stats,
+			MemoryQuota: 512000000,
+		}
+	},
+}
+
+// Names of the available scenarios in sorted order
+func ScenarioNames() []string {
+
+	names := make([]string, 0, len(Scenarios))
+	for name := range Scenarios {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
@@ -6,6 +6,7 @@ require (
 	github.com/couchbase/clog v0.1.0
 	github.com/couchbase/gocb/v2 v2.6.2
 	github.com/gizak/termui/v3 v3.1.0
+	golang.org/x/term v0.10.0
 )
 
 require (
@@ -15,4 +16,5 @@ require (
 	github.com/mattn/go-runewidth v0.0.2 // indirect
 	github.com/mitchellh/go-wordwrap v0.0.0-20150314170334-ad45545899c7 // indirect
 	github.com/nsf/termbox-go v0.0.0-20190121233118-02980233997d // indirect
+	golang.org/x/sys v0.10.0 // indirect
 )
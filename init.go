@@ -9,6 +9,7 @@
 package main
 
 import (
+	"crypto/tls"
 	"encoding/json"
 	"fmt"
 	"math"
@@ -31,53 +32,140 @@ var logNum = 1
 var maxLogSize = 5000000
 var logFile *os.File
 
+// Window of data kept for each stat when -history is not given
+var defaultHistory = time.Minute * time.Duration(5)
+
 // Holds all the input from the user given as command line arguments
 type config struct {
-	username   *string
-	password   *string
-	ip         *string
-	reportPath *string
-	stats      map[string]*configStatInfo
-	alerts     map[string]*int
+	username     *string
+	password     *string
+	passwordFile *string
+	connStrings  *stringList
+	clusters     *string
+	nodes        *string
+	caCert       *string
+	cert         *string
+	key          *string
+	skipVerify   *bool
+	reportPath   *string
+	snapFormat   *string
+	record       *string
+	replay       *string
+	replaySpeed  *string
+	replaySeek   *time.Duration
+	interval     *time.Duration
+	history      *time.Duration
+	dataDir      *string
+	prometheus   *string
+	promFilter   *string
+	derived      *stringList
+	derivedFile  *string
+	rulesFile    *string
+	anomaly      *float64
+	anomalyWin   *time.Duration
+	anomalyMeth  *string
+	silenceFile  *string
+	stats        map[string]*configStatInfo
+	alerts       map[string]*int
 }
 
 // Holds all alert related thresholds for a particular stat
 type configStatInfo struct {
-	MinVal        float64
-	MaxVal        float64
-	MaxChange     float64
+	MinVal    float64
+	MaxVal    float64
+	MaxChange float64
+
+	// Seconds the change thresholds are measured over, rounded to the
+	// stream interval
 	MaxChangeTime int
+
+	// Thresholds on the change over MaxChangeTime, 0 or NaN if unset
+	// MaxDelta is absolute, MaxIncrease and MaxDecrease are relative like
+	// MaxChange but one way, MaxRate is the absolute change per second
+	MaxDelta    float64
+	MaxIncrease float64
+	MaxDecrease float64
+	MaxRate     float64
+
+	// Seconds a threshold has to be crossed for before alerting
+	For int
+
+	// Values an alert above or below the thresholds lasts until,
+	// NaN to end it as soon as the threshold is no longer crossed
+	MaxClear float64
+	MinClear float64
+
+	// Anomaly detection of the stat, NaN, 0 and "" for the defaults
+	Anomaly       float64
+	AnomalyWindow int
+	AnomalyMethod string
+
+	// Factor a node can be away from the median of the nodes
+	Outlier float64
 }
 
 // Holds all incoming stat data from the server
 type stats struct {
 
-	// The main map holding the stat data (map[node][stat][300][float64])
-	statBuffers map[string]map[string][]float64
+	// Stat data and arrival times of each node
+	nodes map[string]*nodeSeries
+
+	// Lock for the nodes map, the data of each node has its own lock
+	nodesLock sync.RWMutex
 
 	// List of stats to monitor
 	statsList []string
 
-	// Arrival time of messages from each node (map[node][300][time.Time])
-	arrivalTimes map[string][]time.Time
-
 	// A copy of stat alert information
 	statInfo map[string]*configStatInfo
 
 	// Lock for statInfo
 	statInfoLock sync.RWMutex
 
-	// Lock for statBuffers
-	bufferLock sync.RWMutex
-
-	// Lock for arrivalTimes
-	timeLock sync.RWMutex
-
 	// Lock for the list of stats
 	statsListLock sync.RWMutex
 
-	// Flag for first updation
-	updated bool
+	// Lock held by a poll while it changes the list of stats
+	updateLock sync.Mutex
+
+	// Thresholds being crossed by each node, see analyzer.go
+	breaches   map[breachKey]*breach
+	breachLock sync.Mutex
+
+	// Alerts whose condition held at the latest check, see analyzer.go
+	active     map[alertKey]bool
+	activeLock sync.Mutex
+
+	// Clusters whose first chunk was handled, keyed by the name of the
+	// cluster, empty until the first chunk of any poll
+	initialized map[string]bool
+
+	// Thresholds of a cluster that differ from the flags because they were
+	// read from its server, keyed by the name of the cluster and the stat
+	serverInfo map[string]map[string]*configStatInfo
+
+	// Expected time between two chunks, each buffer entry covers one interval
+	interval time.Duration
+
+	// Number of entries in every buffer, covers the -history window
+	historyLen int
+
+	// Stats computed from the others in every chunk, set before the
+	// polls start and never changed
+	derived []*derivedStat
+
+	// Series of the row of each cluster, kept under stats.nodes like any
+	// node
+	cluster clusterState
+
+	// Rules of the rules file, set before the polls start
+	rules []*rule
+
+	// Anomaly detection of the stats without their own flags
+	anomaly anomalyConfig
+
+	// Alerts hidden from the UI, nil if none can be set
+	silences *silences
 }
 
 // Define and parse flags
@@ -89,16 +177,117 @@ func flagsInit() *config {
 		"username", "Administrator", "Provide the username for the cluster",
 	)
 	config.password = flag.String(
-		"password", "123456", "Provide the password for the cluster",
+		"password", "", "Provide the password for the cluster "+
+			"(visible to other users, prefer -password_file or "+passwordEnv+")",
+	)
+	config.passwordFile = flag.String(
+		"password_file", "", "Provide a file holding the password for the cluster",
+	)
+	config.connStrings = &stringList{}
+	flag.Var(
+		config.connStrings, "connection_string",
+		"Provide the ip address for one of the search nodes, repeat to "+
+			"monitor more than one cluster (default "+defaultConnectionString+")",
+	)
+	config.clusters = flag.String(
+		"clusters", "",
+		"Provide a JSON file listing the clusters to monitor",
+	)
+	config.caCert = flag.String(
+		"cacert", "", "Provide a CA certificate to verify the cluster with",
+	)
+	config.cert = flag.String(
+		"cert", "", "Provide a client certificate to present to the cluster",
+	)
+	config.key = flag.String(
+		"key", "", "Provide the private key of the client certificate",
+	)
+	config.skipVerify = flag.Bool(
+		"insecure_skip_verify", false,
+		"Skip verification of the certificates presented by the cluster",
 	)
-	config.ip = flag.String(
-		"connection_string",
-		"couchbase://127.0.0.1:12000",
-		"Provide the ip address for one of the search nodes",
+	config.nodes = flag.String(
+		"nodes", "",
+		"Provide a comma separated list of search node addresses to poll "+
+			"directly instead of discovering them through the connection string",
 	)
 	config.reportPath = flag.String(
 		"report", "./", "Provide path to print reports",
 	)
+	config.snapFormat = flag.String(
+		"snapshot_format", "json",
+		"Provide the format of the snapshots taken with 'e' or SIGUSR1 "+
+			"(json or csv)",
+	)
+	config.record = flag.String(
+		"record", "", "Provide a file to record the stats stream to",
+	)
+	config.replay = flag.String(
+		"replay", "", "Provide a recording to replay instead of connecting to a cluster",
+	)
+	config.replaySpeed = flag.String(
+		"replay_speed", "1x", "Provide the replay speed (1x, 10x or max)",
+	)
+	config.replaySeek = flag.Duration(
+		"replay_seek", 0, "Provide an offset from the start of the recording to skip to",
+	)
+	config.interval = flag.Duration(
+		"stream_interval", time.Second,
+		"Provide the expected time between two chunks of the stats stream",
+	)
+	config.history = flag.Duration(
+		"history", defaultHistory,
+		"Provide how far back the graphs and alerts can look, e.g. 30m",
+	)
+	config.dataDir = flag.String(
+		"data_dir", "",
+		"Provide a directory to keep the collected stats in, "+
+			"reloaded when chronos restarts",
+	)
+	config.prometheus = flag.String(
+		"prometheus", "",
+		"Provide the port of the Prometheus endpoint to scrape on every node, "+
+			"e.g. 8091",
+	)
+	config.promFilter = flag.String(
+		"prometheus_filter", "",
+		"Provide a comma separated list of globs for the Prometheus stats to keep, "+
+			"e.g. kv_ops*,index_*",
+	)
+	config.derived = &stringList{}
+	flag.Var(
+		config.derived, "derived",
+		"Provide a stat computed from the others as name=expression, e.g. "+
+			"gc_rate=rate(total_gc), repeat to add more",
+	)
+	config.derivedFile = flag.String(
+		"derived_file", "",
+		"Provide a file of derived stats, one name = expression per line",
+	)
+	config.rulesFile = flag.String(
+		"rules", "",
+		"Provide a JSON file of alert rules with conditions such as "+
+			"avg(pct_cpu_gc, 30s) > 0.2",
+	)
+	config.anomaly = flag.Float64(
+		"anomaly", 0,
+		"Provide the number of deviations from its recent values that makes "+
+			"a value of any stat an anomaly, 0 to only check the stats "+
+			"given a <stat>_anomaly flag",
+	)
+	config.anomalyWin = flag.Duration(
+		"anomaly_window", time.Minute,
+		"Provide how far back the recent values of a stat go for anomalies",
+	)
+	config.anomalyMeth = flag.String(
+		"anomaly_method", anomalyZScore,
+		"Provide how anomalies are detected, zscore or ewma",
+	)
+	config.silenceFile = flag.String(
+		"silence_file", "",
+		"Provide a file to keep the alerts silenced from the UI in across "+
+			"restarts, silences.json under -data_dir by default",
+	)
 	config.stats = make(map[string]*configStatInfo)
 	config.alerts = make(map[string]*int)
 
@@ -213,14 +402,12 @@ func loggerFunc(level, format string, args ...interface{}) string {
 }
 
 // Starting a connection to the server
-func clusterInit(connectionString string, username string,
-	password string) (*gocb.Cluster, error) {
+func clusterInit(connectionString string, creds *credentials,
+	tlsConfig *tls.Config) (*gocb.Cluster, error) {
 
 	cluster, err := gocb.Connect(connectionString, gocb.ClusterOptions{
-		Authenticator: gocb.PasswordAuthenticator{
-			Username: username,
-			Password: password,
-		},
+		Authenticator:  creds.authenticator(),
+		SecurityConfig: securityConfig(tlsConfig),
 	})
 
 	if err != nil {
@@ -256,25 +443,45 @@ func nodesListInit(cluster *gocb.Cluster) ([]string, error) {
 	return nodesList, nil
 }
 
-// Adding additional threshold values derived from the server
-func addThresholds(node string, username string, password string, stats *stats) {
+// Lists the search nodes of a cluster using the go sdk
+type gocbNodes struct {
+	cluster *gocb.Cluster
+}
+
+func (nodes *gocbNodes) SearchNodes() ([]string, error) {
+	return nodesListInit(nodes.cluster)
+}
+
+// Fixed list of search nodes given by the user
+type staticNodes []string
+
+func (nodes staticNodes) SearchNodes() ([]string, error) {
+	return nodes, nil
+}
+
+// Adding additional threshold values derived from the server of the
+// cluster node is in, they only apply to the nodes of that cluster
+func addThresholds(node string, cluster string, creds *credentials,
+	client *http.Client, stats *stats) {
 
 	url := node + "/api/manager"
 
 	req, err := http.NewRequest("GET", url, nil)
-	req.SetBasicAuth(username, password)
 
 	if err != nil {
 		log.Warnf("init: /api/manager request creation failed %v", err)
 		return
 	}
 
-	resp, err := http.DefaultClient.Do(req)
+	creds.authorize(req)
+
+	resp, err := client.Do(req)
 
 	if err != nil {
 		log.Warnf("init: /api/manager request failed %v", err)
 		return
 	}
+	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
 		log.Warnf("init: /api/manager response status not ok %v", err)
@@ -317,35 +524,77 @@ func addThresholds(node string, username string, password string, stats *stats)
 			"num_bytes_used_ram failed")
 	} else {
 		stats.statInfoLock.Lock()
-		if math.IsNaN(stats.statInfo["num_bytes_used_ram"].MaxVal) {
-			stats.statInfo["num_bytes_used_ram"].MaxVal = num_bytes_used_ram_max_val
+		statInfo, ok := stats.statInfo["num_bytes_used_ram"]
+		if ok && math.IsNaN(statInfo.MaxVal) {
+			own := *statInfo
+			own.MaxVal = num_bytes_used_ram_max_val
+
+			if stats.serverInfo[cluster] == nil {
+				stats.serverInfo[cluster] = make(map[string]*configStatInfo)
+			}
+			stats.serverInfo[cluster]["num_bytes_used_ram"] = &own
 		}
 		stats.statInfoLock.Unlock()
 	}
 }
 
+// Thresholds of a stat for the nodes of cluster
+// Called with the statInfo lock held
+func (stats *stats) thresholds(cluster string, stat string) *configStatInfo {
+	if statInfo, ok := stats.serverInfo[cluster][stat]; ok {
+		return statInfo
+	}
+	return stats.statInfo[stat]
+}
+
 // Initialize the stats struct with empty slices
 func statsInit(config *config, nodesList []string) *stats {
 
-	statBuffers := make(map[string]map[string][]float64)
-	arrivalTimes := make(map[string][]time.Time)
+	interval := time.Second
+	if config.interval != nil && *config.interval > 0 {
+		interval = *config.interval
+	}
 
-	for _, node := range nodesList {
-		statBuffers[node] = make(map[string][]float64)
-		arrivalTimes[node] = make([]time.Time, 300)
+	history := defaultHistory
+	if config.history != nil && *config.history > 0 {
+		history = *config.history
+	}
+
+	// Keep at least two samples so a change can be seen
+	historyLen := int(history / interval)
+	if historyLen < 2 {
+		historyLen = 2
 	}
 
-	return &stats{
-		statBuffers:   statBuffers,
+	stats := &stats{
+		nodes:         make(map[string]*nodeSeries),
+		nodesLock:     sync.RWMutex{},
 		statsList:     make([]string, 0),
 		statInfo:      config.stats,
-		arrivalTimes:  arrivalTimes,
 		statInfoLock:  sync.RWMutex{},
-		bufferLock:    sync.RWMutex{},
-		timeLock:      sync.RWMutex{},
 		statsListLock: sync.RWMutex{},
-		updated:       false,
+		initialized:   make(map[string]bool),
+		serverInfo:    make(map[string]map[string]*configStatInfo),
+		interval:      interval,
+		historyLen:    historyLen,
+	}
+
+	stats.anomaly.method = anomalyZScore
+	stats.anomaly.window = time.Minute
+	if config.anomaly != nil {
+		stats.anomaly.sensitivity = *config.anomaly
+		stats.anomaly.window = *config.anomalyWin
+		stats.anomaly.method = *config.anomalyMeth
+	}
+
+	for _, node := range nodesList {
+		stats.addNode(node, nil)
 	}
+	for _, cluster := range clusterNames(nodesList) {
+		stats.clusterAggregates(cluster)
+	}
+
+	return stats
 }
 
 // Setting up the widgets in a grid with relative ratios and positions
@@ -9,6 +9,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"time"
@@ -26,6 +27,9 @@ var (
 	lineChart2   *widgets.LineGraph
 )
 
+// Time given to the polls to stop when exiting
+const shutdownTimeout = 5 * time.Second
+
 // This variable is used to track which table is currently selected
 const (
 	leftTable   = 1
@@ -41,6 +45,11 @@ const (
 
 func main() {
 
+	// Serve fake search nodes instead of monitoring a cluster
+	if len(os.Args) > 1 && os.Args[1] == "fakenode" {
+		os.Exit(runFakeNode(os.Args[2:]))
+	}
+
 	// Parse all the flags into a config struct
 	config := flagsInit()
 
@@ -51,43 +60,210 @@ func main() {
 		return
 	}
 
-	// Connect to cluster using the go sdk connector
-	cluster, err := clusterInit(
-		*config.ip, *config.username, *config.password,
+	// Certificates for the connections to the cluster
+	tlsConfig, err := tlsInit(
+		*config.caCert, *config.cert, *config.key, *config.skipVerify,
 	)
 	if err != nil {
-		log.Fatalf("main: unable to connect to cluster: %v", err)
+		log.Fatalf("main: invalid certificate options: %v", err)
 	}
 
-	// Get a list of search node hostnames
-	nodesList, err := nodesListInit(cluster)
-	if err != nil {
-		log.Fatalf(
-			"main: unable to get node configuration from the server: %v", err,
+	var conns []*clusterConn
+	var nodesList []string
+	var replay *replayer
+
+	if *config.replay != "" {
+
+		// Replay a recording instead of connecting to a cluster
+		replay, err = newReplayer(
+			*config.replay, *config.replaySpeed, *config.replaySeek,
 		)
-	}
+		if err != nil {
+			log.Fatalf("main: unable to replay recording: %v", err)
+		}
+
+		// Get the list of nodes present in the recording
+		nodesList, err = replay.nodesList()
+		if err != nil {
+			log.Fatalf("main: unable to replay recording: %v", err)
+		}
 
-	// If the cluster has no search nodes
-	if len(nodesList) == 0 {
-		log.Fatalf(
-			"main: unable to detect any active search nodes in the cluster",
+		if len(nodesList) == 0 {
+			log.Fatalf("main: recording %s has no chunks", *config.replay)
+		}
+
+		useReplayClock(replay)
+	} else {
+
+		// Get the clusters to monitor
+		specs, err := clustersInit(
+			*config.connStrings, *config.nodes, *config.clusters,
 		)
+		if err != nil {
+			log.Fatalf("main: invalid cluster options: %v", err)
+		}
+
+		// Credentials from the flags, shared by the clusters that do not
+		// override them
+		var flagCreds *credentials
+
+		for _, spec := range specs {
+
+			// Get the password from one of the sources
+			var creds *credentials
+			if spec.Username == "" && spec.PasswordFile == "" {
+				if flagCreds == nil {
+					flagCreds, err = credentialsInit(
+						*config.username, *config.password,
+						*config.passwordFile, tlsConfig,
+					)
+				}
+				creds = flagCreds
+			} else {
+				username, password, passwordFile :=
+					*config.username, *config.password, *config.passwordFile
+				if spec.Username != "" {
+					username = spec.Username
+				}
+				if spec.PasswordFile != "" {
+					password, passwordFile = "", spec.PasswordFile
+				}
+				creds, err = credentialsInit(
+					username, password, passwordFile, tlsConfig,
+				)
+			}
+			if err != nil {
+				log.Fatalf("main: unable to get credentials: %v", err)
+			}
+
+			conn, err := connectCluster(spec, creds, tlsConfig)
+			if err != nil {
+				log.Fatalf("main: cluster %s: %v", spec.Name, err)
+			}
+			conns = append(conns, conn)
+
+			for _, url := range conn.nodesList {
+				nodesList = append(nodesList, nodeKey(spec.Name, url))
+			}
+		}
+	}
+
+	err = checkSnapshotFormat(*config.snapFormat)
+	if err != nil {
+		log.Fatalf("main: %v", err)
+	}
+
+	err = checkAnomalyMethod(*config.anomalyMeth)
+	if err != nil {
+		log.Fatalf("main: %v", err)
+	}
+
+	// Stats computed from the others, from the flags and the file
+	derivedDefs := []string(*config.derived)
+	if *config.derivedFile != "" {
+		fileDefs, err := readDerivedFile(*config.derivedFile)
+		if err != nil {
+			log.Fatalf("main: unable to read derived stats: %v", err)
+		}
+		derivedDefs = append(derivedDefs, fileDefs...)
+	}
+	derived, err := parseDerivedStats(derivedDefs)
+	if err != nil {
+		log.Fatalf("main: %v", err)
+	}
+
+	var rules []*rule
+	if *config.rulesFile != "" {
+		rules, err = readRulesFile(*config.rulesFile)
+		if err != nil {
+			log.Fatalf("main: %v", err)
+		}
+	}
+
+	// Silences set in earlier sessions
+	silences, err := loadSilences(
+		silencePath(*config.silenceFile, *config.dataDir), time.Now(),
+	)
+	if err != nil {
+		log.Warnf("main: unable to read silences: %v", err)
 	}
 
 	// Initialize the stats struct with empty values
 	stats := statsInit(config, nodesList)
+	stats.derived = derived
+	stats.rules = rules
+	stats.silences = silences
+	widgets.SampleInterval = stats.interval
+
+	// Shared by the managers of all the clusters
+	channels := newChannels()
+	client := httpClientInit(tlsConfig)
+
+	// Scrape the Prometheus endpoint of every node if requested
+	prometheus, err := prometheusInit(
+		*config.prometheus, *config.promFilter,
+	)
+	if err != nil {
+		log.Fatalf("main: invalid prometheus options: %v", err)
+	}
+
+	// Record all incoming chunks if requested
+	var rec *recorder
+	if *config.record != "" {
+		rec, err = newRecorder(*config.record)
+		if err != nil {
+			log.Fatalf("main: unable to create recording: %v", err)
+		}
+	}
 
-	// Create a manager instance with all the
+	// Reload the stats kept by earlier sessions and keep the new ones
+	// Recordings are not kept since they can be replayed again
+	var persist *persister
+	if *config.dataDir != "" && replay == nil {
+		loaded, err := restoreHistory(*config.dataDir, stats)
+		if err != nil {
+			log.Warnf("main: unable to reload stats from %s: %v",
+				*config.dataDir, err)
+		} else {
+			log.Printf("main: reloaded %d chunks from %s", loaded, *config.dataDir)
+		}
+
+		persist, err = newPersister(*config.dataDir)
+		if err != nil {
+			log.Fatalf("main: unable to use data directory: %v", err)
+		}
+	}
+
+	// Create a manager instance for each cluster with all the
 	// parameters necessary to spawn new polls
-	manager := newManager(
-		nodesList, stats, *config.username, *config.password, cluster,
-	)
+	managers := make([]*manager, 0, len(conns))
+
+	if replay != nil {
+		manager := newManager(
+			context.Background(), "", nil, stats, nil, nil, nil, channels,
+		)
+		managers = append(managers, manager)
+
+		// Start feeding the recording to the stats struct
+		go replayRecording(manager, replay)
+	}
 
-	// Start the manager routine
-	// This starts all the polls and enters an infinite
-	// loop to check the list of search nodes for any
-	// changes using the go sdk
-	go monitorCluster(manager)
+	for _, conn := range conns {
+		manager := newManager(
+			context.Background(), conn.spec.Name, conn.nodesList, stats,
+			conn.creds, conn.lister, client, channels,
+		)
+		manager.recorder = rec
+		manager.persister = persist
+		manager.prometheus = prometheus
+		managers = append(managers, manager)
+
+		// Start the manager routine
+		// This starts all the polls and enters an infinite
+		// loop to check the list of search nodes for any
+		// changes using the go sdk
+		go monitorCluster(manager)
+	}
 
 	// Initialize termui
 	err2 := ui.Init()
@@ -104,15 +280,21 @@ func main() {
 
 	// Initializing all widgets
 	statsTable = widgets.NewStatsTable()
+	// The row of each cluster comes before its nodes, showing the sum
+	// until switched
+	clusterAgg := aggSum
+	clusters := clusterNames(nodesList)
+	nodesList = withClusterRows(nodesList, clusterAgg)
+
 	nodesTable = widgets.NewNodesTable(nodesList)
-	lineChart1 = widgets.NewLineGraph(nodesList, 1)
-	lineChart2 = widgets.NewLineGraph(nodesList, 2)
+	lineChart1 = widgets.NewLineGraph(nodesList, 1, stats.resolutions())
+	lineChart2 = widgets.NewLineGraph(nodesList, 2, stats.resolutions())
 	eventDisplay = widgets.NewEventDisplay()
 	popupManager := widgets.NewPopupManager()
 
 	// Starting the routine to check and accept incoming events
 	go eventCreateHandler(
-		manager.eventChannel, eventDisplay, stats, config.alerts,
+		channels.eventChannel, eventDisplay, stats, config.alerts,
 	)
 
 	// Starting the routine to track and update event data
@@ -124,6 +306,9 @@ func main() {
 		eventDisplay, popupManager,
 	)
 
+	// Snapshots can also be asked for from outside with SIGUSR1
+	snapshotSignal := snapshotSignals()
+
 	// Used to determine the table currently in use
 	tableSelect := leftTable
 
@@ -153,6 +338,7 @@ func main() {
 
 			// Exit out of the program
 			case "q", "Q", "<C-c>":
+				shutdown(managers, rec, persist, eventDisplay)
 				return
 
 			// Scroll up
@@ -199,7 +385,8 @@ func main() {
 			// Select stat for the left line chart
 			case "a", "A":
 				if tableSelect == leftTable &&
-					statsTable.SelectedRow != statsTable.Stat2 {
+					statsTable.SelectedStat() != "" &&
+					statsTable.SelectedStat() != statsTable.Stat2 {
 
 					graphNum = leftGraph
 					lineChart1.SelectGraph()
@@ -207,13 +394,13 @@ func main() {
 
 					statsTable.SelectGraph(graphNum)
 					nodesTable.SelectStat(
-						statsTable.Rows[statsTable.Stat1],
+						statsTable.Stat1,
 						lineChart1.Nodes, lineChart1.Stat,
 					)
 
-					if lineChart1.Stat != statsTable.Rows[statsTable.Stat1] {
+					if lineChart1.Stat != statsTable.Stat1 {
 						updateGraph(
-							statsTable.Rows[statsTable.Stat1], stats, nodesList,
+							statsTable.Stat1, stats, nodesList,
 							lineChart1, graphNum,
 						)
 					}
@@ -227,7 +414,8 @@ func main() {
 			// Select stat for the right line chart
 			case "d", "D":
 				if tableSelect == leftTable &&
-					statsTable.SelectedRow != statsTable.Stat1 {
+					statsTable.SelectedStat() != "" &&
+					statsTable.SelectedStat() != statsTable.Stat1 {
 
 					graphNum = rightGraph
 					lineChart2.SelectGraph()
@@ -235,13 +423,13 @@ func main() {
 
 					statsTable.SelectGraph(graphNum)
 					nodesTable.SelectStat(
-						statsTable.Rows[statsTable.Stat2],
+						statsTable.Stat2,
 						lineChart2.Nodes, lineChart2.Stat,
 					)
 
-					if lineChart2.Stat != statsTable.Rows[statsTable.Stat2] {
+					if lineChart2.Stat != statsTable.Stat2 {
 						updateGraph(
-							statsTable.Rows[statsTable.Stat2], stats, nodesList,
+							statsTable.Stat2, stats, nodesList,
 							lineChart2, graphNum,
 						)
 					}
@@ -254,6 +442,10 @@ func main() {
 			// Interact with a table
 			case "<Enter>":
 				switch tableSelect {
+				case leftTable:
+					statsTable.ToggleGroup()
+					ui.Render(statsTable)
+					popupManager.Render()
 				case middleTable:
 					nodesTable.SelectNode()
 					lineChart := getSelectedGraph(graphNum)
@@ -265,11 +457,37 @@ func main() {
 				case rightTable:
 					eventDisplay.ReportEvent(*config.reportPath)
 				}
+			// Expand the bucket or index in the stats table
+			case "+", "=":
+				if tableSelect == leftTable {
+					statsTable.Expand()
+					ui.Render(statsTable)
+					popupManager.Render()
+				}
+			// Collapse the bucket or index in the stats table
+			case "-", "_":
+				if tableSelect == leftTable {
+					statsTable.Collapse()
+					ui.Render(statsTable)
+					popupManager.Render()
+				}
 			// Toggle legend for the selected graph
 			case "p", "P":
 				lineChart := getSelectedGraph(graphNum)
 				lineChart.ToggleLegend()
 				ui.Render(lineChart)
+			// Zoom the selected graph out to show more of the history
+			case "o", "O":
+				lineChart := getSelectedGraph(graphNum)
+				lineChart.ZoomOut()
+				updateUI(stats, lineChart)
+				ui.Render(lineChart)
+			// Zoom the selected graph back in
+			case "i", "I":
+				lineChart := getSelectedGraph(graphNum)
+				lineChart.ZoomIn()
+				updateUI(stats, lineChart)
+				ui.Render(lineChart)
 			// Scroll down on the hovered table
 			case "<MouseWheelDown>":
 
@@ -369,10 +587,144 @@ func main() {
 					statsTable, nodesTable, lineChart1, lineChart2,
 					eventDisplay, popupManager, grid,
 				)
+			// Change the speed of a replay
+			case ">", "<":
+				if replay != nil {
+					step := 1
+					if e.ID == "<" {
+						step = -1
+					}
+
+					speed := replay.cycleSpeed(step)
+					popupManager.NewPopup(
+						"Replay speed "+speed, "replay",
+						time.Now().Add(time.Millisecond*time.Duration(1500)),
+					)
+					popupManager.Render()
+				}
+			// Skip forward or go back in a replay
+			case "]", "[":
+				if replay != nil {
+					offset := replaySeekStep
+					text := "Skipping ahead "
+					if e.ID == "[" {
+						offset = -replaySeekStep
+						text = "Going back "
+					}
+
+					replay.seek(offset)
+					popupManager.NewPopup(
+						text+replaySeekStep.String(), "replay",
+						time.Now().Add(time.Millisecond*time.Duration(1500)),
+					)
+					popupManager.Render()
+				}
+			// Write a snapshot of the whole session
+			case "e", "E":
+				path := exportSnapshot(
+					stats, eventDisplay, *config.reportPath, *config.snapFormat,
+				)
+				popupManager.NewPopup(
+					"Writing snapshot to "+path, "snapshot",
+					time.Now().Add(time.Second*time.Duration(3)),
+				)
+				popupManager.Render()
+			case "g", "G":
+				// Switch the aggregation shown in the cluster rows
+				prevAgg := clusterAgg
+				clusterAgg = clusterAgg.next()
+
+				for _, cluster := range clusters {
+					prevNode := nodeKey(cluster, clusterNode(prevAgg))
+					node := nodeKey(cluster, clusterNode(clusterAgg))
+
+					nodesTable.RenameNode(prevNode, node)
+					lineChart1.RenameNode(prevNode, node)
+					lineChart2.RenameNode(prevNode, node)
+				}
+				nodesList = nodesTable.Rows
+
+				updateUI(stats, lineChart1)
+				updateUI(stats, lineChart2)
+
+				popupManager.NewPopup(
+					"Cluster rows show the "+clusterAgg.String()+
+						" of their nodes", "cluster",
+					time.Now().Add(time.Second*time.Duration(3)),
+				)
+				refreshUI(
+					statsTable, nodesTable, lineChart1, lineChart2,
+					eventDisplay, popupManager, grid,
+				)
+			// Acknowledge the selected alert
+			case "c", "C":
+				if tableSelect == rightTable && eventDisplay.AcknowledgeEvent() {
+					ui.Render(eventDisplay)
+					popupManager.NewPopup(
+						"Alert acknowledged", "acknowledge",
+						time.Now().Add(time.Millisecond*time.Duration(1500)),
+					)
+					popupManager.Render()
+				}
+			// Silence the alerts of the selected stat, node or alert, each
+			// press moves to a longer silence until it is lifted
+			case "s", "S":
+				var node, stat string
+				switch tableSelect {
+				case leftTable:
+					stat = statsTable.SelectedStat()
+				case middleTable:
+					node = nodesTable.Rows[nodesTable.SelectedRow]
+				case rightTable:
+					node, stat = eventDisplay.SelectedAlert()
+				}
+				if node != "" || stat != "" {
+					popupManager.NewPopup(
+						toggleSilence(silences, eventDisplay, node, stat),
+						"silence", time.Now().Add(time.Second*time.Duration(3)),
+					)
+					popupManager.Render()
+				}
+			// Silence the node or the stat of the selected alert
+			case "n", "N", "m", "M":
+				if tableSelect == rightTable {
+					node, stat := eventDisplay.SelectedAlert()
+					if e.ID == "n" || e.ID == "N" {
+						stat = ""
+					} else {
+						node = ""
+					}
+					if node != "" || stat != "" {
+						popupManager.NewPopup(
+							toggleSilence(silences, eventDisplay, node, stat),
+							"silence",
+							time.Now().Add(time.Second*time.Duration(3)),
+						)
+						popupManager.Render()
+					}
+				}
+			// List the silenced alerts
+			case "v", "V":
+				popupManager.NewPopup(
+					silencesText(silences, widgets.Now()), "silences",
+					time.Now().Add(time.Second*time.Duration(5)),
+				)
+				popupManager.Render()
 			case "t", "T": // To simulate a rebalance
-				manager.popupChannel <- "rebalance"
+				channels.popupChannel <- "rebalance"
 			}
 
+		// Write a snapshot when asked for by a signal
+		case <-snapshotSignal:
+			path := exportSnapshot(
+				stats, eventDisplay, *config.reportPath, *config.snapFormat,
+			)
+			popupManager.NewPopup(
+				"Writing snapshot to "+path, "snapshot",
+				time.Now().Add(time.Second*time.Duration(3)),
+			)
+			popupManager.Render()
+
 		// Update line charts and re-render UI
 		case <-updateTicker:
 			updateUI(stats, lineChart1)
@@ -383,7 +735,7 @@ func main() {
 			)
 
 		// Handle errors from the update_stats routine
-		case errorMsg := <-manager.errChannel:
+		case errorMsg := <-channels.errChannel:
 			if errorMsg.terminate {
 				log.Fatalf(errorMsg.description)
 				return
@@ -391,7 +743,7 @@ func main() {
 				log.Warnf(errorMsg.description)
 			}
 		// Handle warnings from the update_stats routine
-		case msg := <-manager.popupChannel:
+		case msg := <-channels.popupChannel:
 
 			if msg == "rebalance" {
 				popupManager.NewPopup(
@@ -399,6 +751,11 @@ func main() {
 					time.Now().Add(time.Millisecond*time.Duration(1500)),
 				)
 				log.Warnf("Cluster undergoing rebalance")
+			} else if msg == "replayEnd" {
+				popupManager.NewPopup(
+					"Replay finished", "replay",
+					time.Now().Add(time.Second*time.Duration(5)),
+				)
 			} else {
 				popupManager.NewPopup(
 					"Slow response from "+msg, "warning",
@@ -412,7 +769,7 @@ func main() {
 				eventDisplay, popupManager, grid,
 			)
 		// Handle node changes from the manager routine
-		case info := <-manager.updateChannel:
+		case info := <-channels.updateChannel:
 			if info.node != "" {
 				if info.add {
 					nodesTable.AddNode(info.node)
@@ -442,6 +799,42 @@ func main() {
 	}
 }
 
+// Stop all the polls and flush everything still being written before exiting
+func shutdown(managers []*manager, rec *recorder, persist *persister,
+	eventDisplay *widgets.EventDisplay) {
+
+	// Cancel every cluster before waiting so they stop together
+	for _, manager := range managers {
+		manager.cancel()
+	}
+
+	for _, manager := range managers {
+		if !manager.stop(shutdownTimeout) {
+			log.Warnf("main: polls did not stop within %v", shutdownTimeout)
+		}
+	}
+
+	eventDisplay.WaitReports()
+	snapshotWrites.Wait()
+
+	if rec != nil {
+		err := rec.close()
+		if err != nil {
+			log.Warnf("main: unable to close recording: %v", err)
+		}
+	}
+
+	if persist != nil {
+		err := persist.close()
+		if err != nil {
+			log.Warnf("main: unable to close data directory: %v", err)
+		}
+	}
+
+	log.Printf("main: exiting")
+	logFile.Close()
+}
+
 // Re-render UI without updating line charts
 func refreshUI(statsTable *widgets.StatsTable, nodesTable *widgets.NodesTable,
 	lineChart1 *widgets.LineGraph, lineChart2 *widgets.LineGraph,
@@ -9,33 +9,85 @@
 package main
 
 import (
+	"context"
+	"net/http"
+	"sync"
 	"time"
 
-	"github.com/couchbase/gocb/v2"
 	"github.com/couchbaselabs/chronos/widgets"
 )
 
+// Source of the list of search nodes in a cluster
+type nodeLister interface {
+	SearchNodes() ([]string, error)
+}
+
 // Structure to hold all the necessary parameters to monitor the cluster for
 // nodes being added or removed and create polls for them appropriately
 type manager struct {
 	stats *stats
 
-	// Holds the kill switch channels to all the polling routines
-	nodes map[string]chan bool
+	// Name of the cluster, empty when monitoring a single cluster
+	name string
+
+	// Holds the cancellable contexts of all the polling routines
+	nodes map[string]*poll
 
 	// To track of nodes currently being polled
 	polledNodes map[string]bool
 
+	// Shared with the managers of the other clusters
+	*channels
+
+	creds  *credentials
+	lister nodeLister
+
+	// Client shared by all the polls
+	client *http.Client
+
+	// Shared by all the polls to record incoming chunks, nil if not recording
+	recorder *recorder
+
+	// Shared by all the polls to keep the stats on disk, nil if not kept
+	persister *persister
+
+	// Prometheus endpoint scraped by all the polls, nil if not scraping
+	prometheus *prometheusConfig
+
+	// Parent of every poll, cancelling it stops the manager and all the polls
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// Tracks the running polls so shutdown can wait for them
+	wg sync.WaitGroup
+}
+
+// Channels from the managers and polls to the main routine
+type channels struct {
 	errChannel   chan *errorMsg
 	eventChannel chan *widgets.Event
 	popupChannel chan string
 
 	// Used to signal the addition or removal of any node or stat to the main routine
 	updateChannel chan updateMessage
+}
 
-	username string
-	password string
-	cluster  *gocb.Cluster
+func newChannels() *channels {
+	return &channels{
+		errChannel:    make(chan *errorMsg),
+		eventChannel:  make(chan *widgets.Event),
+		popupChannel:  make(chan string),
+		updateChannel: make(chan updateMessage),
+	}
+}
+
+// Context of a single polling routine, cancelled to stop it
+type poll struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// Address of the node being polled
+	url string
 }
 
 // Struct to indicate the addition or removal of any node or stat
@@ -45,36 +97,101 @@ type updateMessage struct {
 	stat string
 }
 
-// Create and initialize a new manager
-func newManager(nodesList []string, stats *stats,
-	username string, password string, cluster *gocb.Cluster) *manager {
+// Create and initialize a new manager for the cluster called name
+// nodesList holds the addresses of the search nodes in the cluster
+func newManager(ctx context.Context, name string, nodesList []string,
+	stats *stats, creds *credentials, lister nodeLister,
+	client *http.Client, channels *channels) *manager {
 
 	manager := &manager{
-		stats:         stats,
-		nodes:         make(map[string]chan bool),
-		polledNodes:   make(map[string]bool),
-		errChannel:    make(chan *errorMsg),
-		eventChannel:  make(chan *widgets.Event),
-		popupChannel:  make(chan string),
-		updateChannel: make(chan updateMessage),
-		username:      username,
-		password:      password,
-		cluster:       cluster,
+		stats:       stats,
+		name:        name,
+		nodes:       make(map[string]*poll),
+		polledNodes: make(map[string]bool),
+		channels:    channels,
+		creds:       creds,
+		lister:      lister,
+		client:      client,
 	}
+	manager.ctx, manager.cancel = context.WithCancel(ctx)
 
-	for _, node := range nodesList {
-		manager.nodes[node] = make(chan bool)
+	for _, url := range nodesList {
+		manager.nodes[nodeKey(name, url)] = manager.newPoll(url)
 	}
 
 	return manager
 }
 
+// Name a node is known by across chronos, prefixed with its cluster when
+// monitoring more than one, eg. east/http://10.0.0.1:8094
+func nodeKey(cluster string, url string) string {
+	if cluster == "" {
+		return url
+	}
+	return cluster + "/" + url
+}
+
+// Create the context for a new poll of the node at url under the manager
+func (manager *manager) newPoll(url string) *poll {
+	ctx, cancel := context.WithCancel(manager.ctx)
+	return &poll{
+		ctx:    ctx,
+		cancel: cancel,
+		url:    url,
+	}
+}
+
+// Cancel all the polls and wait for them to exit
+// Returns false if they did not exit within the timeout
+func (manager *manager) stop(timeout time.Duration) bool {
+
+	manager.cancel()
+
+	done := make(chan struct{})
+	go func() {
+		manager.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+// Name of the cluster to add to messages, empty for a single cluster
+func (manager *manager) describe() string {
+	if manager.name == "" {
+		return ""
+	}
+	return " (" + manager.name + ")"
+}
+
+// Send an error to the main routine unless the manager is stopped first
+func (manager *manager) sendError(msg *errorMsg) {
+	select {
+	case manager.errChannel <- msg:
+	case <-manager.ctx.Done():
+	}
+}
+
+// Send a node change to the main routine unless the manager is stopped first
+func (manager *manager) sendUpdate(msg updateMessage) {
+	select {
+	case manager.updateChannel <- msg:
+	case <-manager.ctx.Done():
+	}
+}
+
 // Manages all the polling routines, starting new ones and closing old ones
 // in response to changes in the search nodes of the cluster
 func monitorCluster(manager *manager) {
 
 	// Frequency of checking the server for cluster changes
-	monitorTicker := time.NewTicker(time.Second).C
+	monitorTicker := time.NewTicker(time.Second)
+	defer monitorTicker.Stop()
 
 	// Start the polling routines for the first time
 	startPolls(manager)
@@ -82,7 +199,11 @@ func monitorCluster(manager *manager) {
 	// Main loop of the routine
 	for {
 
-		<-monitorTicker
+		select {
+		case <-manager.ctx.Done():
+			return
+		case <-monitorTicker.C:
+		}
 
 		// Set all existing nodes to false
 		for node := range manager.polledNodes {
@@ -90,36 +211,38 @@ func monitorCluster(manager *manager) {
 		}
 
 		// Get new set of nodes from the cluster
-		nodes, err := nodesListInit(manager.cluster)
+		nodes, err := manager.lister.SearchNodes()
 		if err != nil {
-			manager.errChannel <- newErrorMsg(
+			manager.sendError(newErrorMsg(
 				err,
-				"manager: unable to get node configuration from the server: "+
-					err.Error(), true,
-			)
+				"manager: unable to get node configuration from the server"+
+					manager.describe()+": "+err.Error(), true,
+			))
 			return
 		}
 		if len(nodes) == 0 {
-			manager.errChannel <- newErrorMsg(
+			manager.sendError(newErrorMsg(
 				err,
-				"manager: unable to detect any active search nodes in the cluster",
+				"manager: unable to detect any active search nodes in the cluster"+
+					manager.describe(),
 				true,
-			)
+			))
 			return
 		}
 
 		// Set nodes in both lists to true
 		// Create new polls for nodes not in the current list
-		for _, node := range nodes {
+		for _, url := range nodes {
+			node := nodeKey(manager.name, url)
 			if _, ok := manager.polledNodes[node]; ok {
 				manager.polledNodes[node] = true
 			} else {
-				createPoll(manager, node)
-				manager.updateChannel <- updateMessage{
+				createPoll(manager, node, url)
+				manager.sendUpdate(updateMessage{
 					add:  true,
 					node: node,
 					stat: "",
-				}
+				})
 			}
 		}
 
@@ -127,11 +250,11 @@ func monitorCluster(manager *manager) {
 		for node, status := range manager.polledNodes {
 			if !status {
 				deletePoll(manager, node)
-				manager.updateChannel <- updateMessage{
+				manager.sendUpdate(updateMessage{
 					add:  false,
 					node: node,
 					stat: "",
-				}
+				})
 			}
 		}
 	}
@@ -140,65 +263,53 @@ func monitorCluster(manager *manager) {
 // Start polls for all the nodes
 func startPolls(manager *manager) {
 
-	for node, killSwitch := range manager.nodes {
-		updateStatsParams := newUpdateStatsParams(
-			manager.username, manager.password, manager.stats, node,
-			manager.errChannel, manager.eventChannel,
-			manager.popupChannel, manager.updateChannel, killSwitch,
-		)
-
-		go updateStatsExponentialBackoff(updateStatsParams)
-
+	for node, poll := range manager.nodes {
+		manager.runPoll(node, poll)
 		manager.polledNodes[node] = true
 	}
 }
 
-// Start poll for a new node while creating slices to hold its information
-func createPoll(manager *manager, node string) {
-
-	manager.polledNodes[node] = true
-	manager.nodes[node] = make(chan bool)
-
-	statsList := getStatsList(manager.stats)
-	manager.stats.bufferLock.Lock()
-	manager.stats.statBuffers[node] = make(map[string][]float64)
-	for _, stat := range statsList {
-		manager.stats.statBuffers[node][stat] = make([]float64, 300)
-	}
-	manager.stats.bufferLock.Unlock()
-
-	manager.stats.timeLock.Lock()
-	manager.stats.arrivalTimes[node] = make([]time.Time, 300)
-	manager.stats.timeLock.Unlock()
+// Run the polling routine for a node, tracked by the manager's wait group
+func (manager *manager) runPoll(node string, poll *poll) {
 
 	updateStatsParams := newUpdateStatsParams(
-		manager.username, manager.password, manager.stats, node,
+		manager.creds, manager.stats, node,
 		manager.errChannel, manager.eventChannel,
-		manager.popupChannel, manager.updateChannel, manager.nodes[node],
+		manager.popupChannel, manager.updateChannel, poll.ctx,
+		manager.client,
 	)
+	updateStatsParams.nodeURL = poll.url
+	updateStatsParams.recorder = manager.recorder
+	updateStatsParams.persister = manager.persister
+	updateStatsParams.prometheus = manager.prometheus
+
+	manager.wg.Add(1)
+	go func() {
+		defer manager.wg.Done()
+		updateStatsExponentialBackoff(updateStatsParams)
+	}()
+}
+
+// Start poll for a new node while creating slices to hold its information
+func createPoll(manager *manager, node string, url string) {
+
+	manager.polledNodes[node] = true
+	manager.nodes[node] = manager.newPoll(url)
+
+	manager.stats.addNode(node, getStatsList(manager.stats))
 
-	go updateStatsExponentialBackoff(updateStatsParams)
+	manager.runPoll(node, manager.nodes[node])
 }
 
 // Remove an exisitng poll and delete all the data related to that node
 func deletePoll(manager *manager, node string) {
 
-	manager.nodes[node] <- true
+	// Cancelling never blocks, even if the poll is stuck sending on a channel
+	manager.nodes[node].cancel()
 	delete(manager.nodes, node)
 	delete(manager.polledNodes, node)
 
-	manager.stats.bufferLock.Lock()
-
-	for stat := range manager.stats.statBuffers[node] {
-		delete(manager.stats.statBuffers[node], stat)
-	}
-	delete(manager.stats.statBuffers, node)
-
-	manager.stats.bufferLock.Unlock()
-
-	manager.stats.timeLock.Lock()
-	delete(manager.stats.arrivalTimes, node)
-	manager.stats.timeLock.Unlock()
+	manager.stats.removeNode(node)
 }
 
 // Copies the stats list to reduce amount of time each routine holds the lock
@@ -0,0 +1,202 @@
+//  Copyright 2023-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included
+//  in the file licenses/BSL-Couchbase.txt.  As of the Change Date specified
+//  in that file, in accordance with the Business Source License, use of this
+//  software will be governed by the Apache License, Version 2.0, included in
+//  the file licenses/APL2.txt.
+
+package main
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	flag "github.com/couchbaselabs/chronos/cflag"
+	"github.com/couchbaselabs/chronos/fakenode"
+	"github.com/couchbaselabs/chronos/widgets"
+)
+
+func TestMonitorCluster(t *testing.T) {
+
+	scenario := &fakenode.Scenario{
+		Interval: time.Millisecond * time.Duration(100),
+		Stats: map[string]fakenode.Series{
+			"num_bytes_used_ram": fakenode.Constant(100),
+			"pct_cpu_gc":         fakenode.Spike(0.01, 0.5, 1, 1000),
+			"total_gc":           fakenode.Window(fakenode.Ramp(0, 1), 0, 4),
+		},
+		MemoryQuota: 2048,
+	}
+
+	cluster, err := fakenode.NewCluster(scenario, 2, 0, "user", "pass")
+	if err != nil {
+		t.Fatalf("Unable to start cluster %v", err)
+	}
+	defer cluster.Close()
+
+	// Threshold given as a flag for one of the stats
+	flag.CommandLine.Additional["pct_cpu_gc_max_val"] = "0.2"
+
+	nodesList, _ := cluster.SearchNodes()
+	stats := statsInit(&config{stats: make(map[string]*configStatInfo)}, nodesList)
+	manager := newManager(
+		context.Background(), "", nodesList, stats,
+		&credentials{username: "user", password: "pass"},
+		cluster, httpClientInit(nil), newChannels(),
+	)
+
+	go monitorCluster(manager)
+
+	addedStats := make(map[string]bool)
+	removedStats := make(map[string]bool)
+	removedNode := ""
+	alerted := false
+
+	timeout := time.After(time.Second * time.Duration(20))
+
+	for !alerted || !removedStats["total_gc"] || removedNode == "" {
+		select {
+		case info := <-manager.updateChannel:
+			if info.node != "" {
+				if !info.add {
+					removedNode = info.node
+				}
+			} else if info.add {
+				addedStats[info.stat] = true
+			} else {
+				removedStats[info.stat] = true
+			}
+		case event := <-manager.eventChannel:
+			if event.Stat == "pct_cpu_gc" && event.EventType == "Above Threshold" &&
+				!alerted {
+				alerted = true
+
+				// Remove a node once stats are being analyzed
+				cluster.RemoveNode(nodesList[1])
+			}
+		case errorMsg := <-manager.errChannel:
+			if errorMsg.terminate {
+				t.Fatalf("Unexpected termination %v", errorMsg.description)
+			}
+		case <-manager.popupChannel:
+		case <-timeout:
+			t.Fatalf("Timed out, alerted %v, removed stats %v, removed node %v",
+				alerted, removedStats, removedNode)
+		}
+	}
+
+	if len(addedStats) != 3 {
+		t.Errorf("Expected %v got %v", 3, addedStats)
+	}
+
+	if removedNode != nodesList[1] {
+		t.Errorf("Expected %v got %v", nodesList[1], removedNode)
+	}
+
+	if len(flag.CommandLine.Additional) != 0 {
+		t.Errorf("Expected %v got %v", 0, flag.CommandLine.Additional)
+	}
+
+	stats.statInfoLock.RLock()
+	maxRAM := stats.thresholds("", "num_bytes_used_ram").MaxVal
+	maxGC := stats.statInfo["pct_cpu_gc"].MaxVal
+	stats.statInfoLock.RUnlock()
+
+	// Threshold from /api/manager
+	if maxRAM != 2048 {
+		t.Errorf("Expected %v got %v", 2048, maxRAM)
+	}
+
+	// Threshold from the flags
+	if maxGC != 0.2 {
+		t.Errorf("Expected %v got %v", 0.2, maxGC)
+	}
+
+	ok := stats.series(nodesList[1]) != nil
+
+	if ok {
+		t.Errorf("Expected buffers of %v to be deleted", nodesList[1])
+	}
+
+	// Events are always drained by eventCreateHandler, polls blocked
+	// sending to the other channels must still stop
+	go func() {
+		for range manager.eventChannel {
+		}
+	}()
+
+	if !manager.stop(time.Second * time.Duration(5)) {
+		t.Errorf("Expected polls to stop got still running")
+	}
+}
+
+func TestServerThresholds(t *testing.T) {
+
+	quotas := map[string]float64{"east": 1024, "west": 4096}
+
+	urls := make(map[string]string)
+	nodesList := make([]string, 0)
+	for cluster, quota := range quotas {
+		node, err := fakenode.NewNode(&fakenode.Scenario{
+			Interval:    time.Second,
+			Stats:       map[string]fakenode.Series{},
+			MemoryQuota: quota,
+		}, "127.0.0.1:0", "user", "pass")
+		if err != nil {
+			t.Fatalf("Unable to start node %v", err)
+		}
+		defer node.Close()
+
+		urls[cluster] = node.URL()
+		nodesList = append(nodesList, nodeKey(cluster, node.URL()))
+	}
+
+	stats := statsInit(&config{stats: make(map[string]*configStatInfo)},
+		nodesList)
+	stats.initialized[""] = true
+	stats.statsList = []string{"num_bytes_used_ram"}
+	stats.addStat("num_bytes_used_ram")
+	stats.statInfo["num_bytes_used_ram"] = newStatInfo()
+
+	eventChannel := make(chan *widgets.Event, 10)
+	creds := &credentials{username: "user", password: "pass"}
+
+	for _, cluster := range []string{"east", "west"} {
+		params := newUpdateStatsParams(
+			creds, stats, nodeKey(cluster, urls[cluster]), nil, eventChannel,
+			nil, nil, context.Background(), httpClientInit(nil),
+		)
+		params.nodeURL = urls[cluster]
+
+		processMessage(params, &message{
+			Stats: map[string]float64{"num_bytes_used_ram": 2048},
+		}, time.Now())
+	}
+
+	stats.statInfoLock.RLock()
+	for cluster, quota := range quotas {
+		maxRAM := stats.thresholds(cluster, "num_bytes_used_ram").MaxVal
+		if maxRAM != quota {
+			t.Errorf("Expected %v got %v %s", quota, maxRAM, cluster)
+		}
+	}
+	maxRAM := stats.statInfo["num_bytes_used_ram"].MaxVal
+	stats.statInfoLock.RUnlock()
+
+	// The flags are left as they were for the other clusters
+	if !math.IsNaN(maxRAM) {
+		t.Errorf("Expected %v got %v", math.NaN(), maxRAM)
+	}
+
+	// Only over the quota of its own cluster
+	if len(eventChannel) != 1 {
+		t.Fatalf("Expected %v got %v", 1, len(eventChannel))
+	}
+	event := <-eventChannel
+	if cluster, _ := widgets.SplitNodeKey(event.Node); cluster != "east" {
+		t.Errorf("Expected %v got %v", "east", cluster)
+	}
+}
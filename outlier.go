@@ -0,0 +1,133 @@
+//  Copyright 2023-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included
+//  in the file licenses/BSL-Couchbase.txt.  As of the Change Date specified
+//  in that file, in accordance with the Business Source License, use of this
+//  software will be governed by the Apache License, Version 2.0, included in
+//  the file licenses/APL2.txt.
+
+package main
+
+import (
+	"math"
+	"sort"
+
+	"github.com/couchbaselabs/chronos/widgets"
+)
+
+// Fewest nodes with a value for them to be compared, with two neither
+// stands out
+const minOutlierNodes = 3
+
+// Node whose value of a stat is far from the median of the nodes
+type outlier struct {
+	node   string
+	val    float64
+	median float64
+}
+
+// Compare the latest value of each node against the other nodes of its
+// cluster for the stats with an _outlier factor
+// nodeVals holds the samples of every node of the cluster from the same
+// interval
+func analyzeOutliers(stats *stats, cluster string,
+	nodeVals map[string]map[string]float64, statsList []string,
+	eventChannel chan *widgets.Event) {
+
+	stats.statInfoLock.RLock()
+	factors := make(map[string]float64)
+	for _, stat := range statsList {
+		if info := stats.thresholds(cluster, stat); info != nil && info.Outlier > 1 {
+			factors[stat] = info.Outlier
+		}
+	}
+	stats.statInfoLock.RUnlock()
+
+	for stat, factor := range factors {
+		outliers := findOutliers(nodeVals, stat, factor)
+
+		// Too few nodes to tell whether the others are back in line
+		if outliers == nil {
+			continue
+		}
+
+		flagged := make(map[string]bool)
+		for _, o := range outliers {
+			flagged[o.node] = true
+
+			event := widgets.NewEvent(
+				o.node, stat, "Node Outlier", o.val, factor,
+			)
+			event.Expected = o.median
+			event.ThresholdChange = o.val / o.median
+			event.Description = makeDescription(event)
+
+			triggerEvent(event, eventChannel, stats)
+		}
+
+		for node, vals := range nodeVals {
+			if _, ok := vals[stat]; ok && !flagged[node] {
+				stats.resolve(
+					alertKey{node, stat, "Node Outlier", ""}, eventChannel,
+				)
+			}
+		}
+	}
+}
+
+// Nodes whose value of a stat is over factor times the median of all the
+// nodes, or under the median divided by factor
+// The median is barely moved by the node that stands out, unlike the mean
+// Negative values are left out since their ratios mean nothing
+// Returns nil if too few nodes have a value or the median is 0, which
+// nothing has a ratio to
+func findOutliers(nodeVals map[string]map[string]float64, stat string,
+	factor float64) []outlier {
+
+	nodes := make([]string, 0, len(nodeVals))
+	for node, vals := range nodeVals {
+		if val, ok := vals[stat]; ok && val >= 0 {
+			nodes = append(nodes, node)
+		}
+	}
+	if len(nodes) < minOutlierNodes {
+		return nil
+	}
+	sort.Strings(nodes)
+
+	vals := make([]float64, 0, len(nodes))
+	for _, node := range nodes {
+		vals = append(vals, nodeVals[node][stat])
+	}
+	median := medianOf(vals)
+	if median == 0 {
+		return nil
+	}
+
+	outliers := make([]outlier, 0)
+
+	for _, node := range nodes {
+		val := nodeVals[node][stat]
+		if val > median*factor || val < median/factor {
+			outliers = append(outliers, outlier{node, val, median})
+		}
+	}
+
+	return outliers
+}
+
+// Median of vals, which are sorted in place
+func medianOf(vals []float64) float64 {
+
+	if len(vals) == 0 {
+		return math.NaN()
+	}
+
+	sort.Float64s(vals)
+
+	mid := len(vals) / 2
+	if len(vals)%2 == 0 {
+		return (vals[mid-1] + vals[mid]) / 2
+	}
+	return vals[mid]
+}
@@ -0,0 +1,207 @@
+//  Copyright 2023-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included
+//  in the file licenses/BSL-Couchbase.txt.  As of the Change Date specified
+//  in that file, in accordance with the Business Source License, use of this
+//  software will be governed by the Apache License, Version 2.0, included in
+//  the file licenses/APL2.txt.
+
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/couchbaselabs/chronos/widgets"
+)
+
+func TestFindOutliers(t *testing.T) {
+
+	tests := []struct {
+		vals     map[string]float64
+		factor   float64
+		expected []outlier
+	}{
+		// One hot node
+		{
+			map[string]float64{"node1": 10, "node2": 12, "node3": 40},
+			2,
+			[]outlier{{"node3", 40, 12}},
+		},
+		// One idle node
+		{
+			map[string]float64{"node1": 10, "node2": 12, "node3": 11, "node4": 2},
+			2,
+			[]outlier{{"node4", 2, 10.5}},
+		},
+		{
+			map[string]float64{"node1": 10, "node2": 12, "node3": 19},
+			2,
+			[]outlier{},
+		},
+		// Too few nodes to tell which one stands out
+		{
+			map[string]float64{"node1": 10, "node2": 100},
+			2,
+			[]outlier{},
+		},
+		// No ratio to a median of 0
+		{
+			map[string]float64{"node1": 0, "node2": 0, "node3": 0, "node4": 5},
+			3,
+			[]outlier{},
+		},
+		{
+			map[string]float64{"node1": 0, "node2": 0, "node3": 4},
+			2,
+			[]outlier{},
+		},
+	}
+
+	for i, test := range tests {
+		nodeVals := make(map[string]map[string]float64)
+		for node, val := range test.vals {
+			nodeVals[node] = map[string]float64{"stat1": val}
+		}
+
+		outliers := findOutliers(nodeVals, "stat1", test.factor)
+		if len(outliers) != len(test.expected) {
+			t.Errorf("Expected %v got %v %d", test.expected, outliers, i)
+			continue
+		}
+		for j := range outliers {
+			if outliers[j] != test.expected[j] {
+				t.Errorf("Expected %v got %v %d", test.expected[j],
+					outliers[j], i)
+			}
+		}
+	}
+}
+
+func TestAnalyzeOutliers(t *testing.T) {
+
+	interval := time.Second
+	nodes := []string{"node1", "node2", "node3"}
+
+	stats := statsInit(&config{
+		stats:    make(map[string]*configStatInfo),
+		interval: &interval,
+	}, nodes)
+	stats.initialized[""] = true
+	stats.statsList = []string{"stat1"}
+	stats.addStat("stat1")
+	stats.statInfo["stat1"] = newStatInfo()
+	stats.statInfo["stat1"].Outlier = 2
+
+	eventChannel := make(chan *widgets.Event, 10)
+	start := time.UnixMilli(1690000000000)
+
+	// Compared once the next interval starts
+	vals := []float64{100, 110, 400, 100}
+	for i, val := range vals {
+		params := newUpdateStatsParams(
+			nil, stats, nodes[i%len(nodes)], nil, eventChannel, nil, nil,
+			context.Background(), nil,
+		)
+		m := &message{Stats: map[string]float64{"stat1": val}}
+		processMessage(params, m, start.Add(interval*time.Duration(i/3)))
+	}
+
+	if len(eventChannel) != 1 {
+		t.Fatalf("Expected %v got %v events", 1, len(eventChannel))
+	}
+	event := <-eventChannel
+	if event.Node != "node3" || event.EventType != "Node Outlier" ||
+		event.Expected != 110 {
+		t.Errorf("Expected %v got %v", "node3", event.Description)
+	}
+}
+
+func TestAnalyzeOutliersClusters(t *testing.T) {
+
+	interval := time.Second
+	nodes := []string{
+		"east/http://node1", "east/http://node2", "east/http://node3",
+		"west/http://node4", "west/http://node5", "west/http://node6",
+	}
+
+	stats := statsInit(&config{
+		stats:    make(map[string]*configStatInfo),
+		interval: &interval,
+	}, nodes)
+	stats.initialized["east"] = true
+	stats.initialized["west"] = true
+	stats.statsList = []string{"stat1"}
+	stats.addStat("stat1")
+	stats.statInfo["stat1"] = newStatInfo()
+	stats.statInfo["stat1"].Outlier = 2
+
+	eventChannel := make(chan *widgets.Event, 10)
+	start := time.UnixMilli(1690000000000)
+
+	// Far apart across the clusters but close within each of them
+	vals := []float64{100, 110, 120, 1000, 1100, 1200}
+	for offset := 0; offset < 2; offset++ {
+		for i, node := range nodes {
+			params := newUpdateStatsParams(
+				nil, stats, node, nil, eventChannel, nil, nil,
+				context.Background(), nil,
+			)
+			m := &message{Stats: map[string]float64{"stat1": vals[i]}}
+			processMessage(params, m, start.Add(interval*time.Duration(offset)))
+		}
+	}
+
+	if len(eventChannel) != 0 {
+		event := <-eventChannel
+		t.Errorf("Expected %v got %v", 0, event.Description)
+	}
+}
+
+func TestAnalyzeOutliersServerThresholds(t *testing.T) {
+
+	interval := time.Second
+	nodes := []string{
+		"east/http://node1", "east/http://node2", "east/http://node3",
+		"west/http://node4", "west/http://node5", "west/http://node6",
+	}
+
+	stats := statsInit(&config{
+		stats:    make(map[string]*configStatInfo),
+		interval: &interval,
+	}, nodes)
+	stats.initialized["east"] = true
+	stats.initialized["west"] = true
+	stats.statsList = []string{"stat1"}
+	stats.addStat("stat1")
+	stats.statInfo["stat1"] = newStatInfo()
+
+	// Only the thresholds of west compare its nodes
+	westInfo := newStatInfo()
+	westInfo.Outlier = 2
+	stats.serverInfo["west"] = map[string]*configStatInfo{"stat1": westInfo}
+
+	eventChannel := make(chan *widgets.Event, 10)
+	start := time.UnixMilli(1690000000000)
+
+	vals := []float64{100, 110, 400, 1000, 1100, 4000}
+	for offset := 0; offset < 2; offset++ {
+		for i, node := range nodes {
+			params := newUpdateStatsParams(
+				nil, stats, node, nil, eventChannel, nil, nil,
+				context.Background(), nil,
+			)
+			m := &message{Stats: map[string]float64{"stat1": vals[i]}}
+			processMessage(params, m, start.Add(interval*time.Duration(offset)))
+		}
+	}
+
+	if len(eventChannel) != 1 {
+		t.Fatalf("Expected %v got %v events", 1, len(eventChannel))
+	}
+	event := <-eventChannel
+	if event.Node != "west/http://node6" || event.Expected != 1100 {
+		t.Errorf("Expected %v got %v", "west/http://node6", event.Description)
+	}
+}
@@ -0,0 +1,489 @@
+//  Copyright 2023-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included
+//  in the file licenses/BSL-Couchbase.txt.  As of the Change Date specified
+//  in that file, in accordance with the Business Source License, use of this
+//  software will be governed by the Apache License, Version 2.0, included in
+//  the file licenses/APL2.txt.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/couchbase/clog"
+)
+
+// The data directory holds segments, each covering up to segmentSpan of
+// chunks. A segment starts with segmentMagic and is followed by records:
+//
+//	name:  recordName, uvarint length, bytes
+//	chunk: recordChunk, uvarint node id, varint unix milliseconds,
+//	       uvarint count, count * (uvarint stat id delta, uvarint xor),
+//	       uvarint count, count * uvarint removed stat id delta
+//
+// Names get ids in order of appearance within the segment. Only the stats
+// that changed since the previous chunk of the node are written, as the
+// xor of their bits with the previous value
+
+const (
+	segmentMagic  = "CHRONOS1"
+	segmentSuffix = ".seg"
+	segmentSpan   = time.Hour
+
+	recordName  = byte(1)
+	recordChunk = byte(2)
+)
+
+// Segments older than the coarsest rollup are of no use after a restart
+var historyRetention = rollupTiers[len(rollupTiers)-1].span
+
+// Appends every chunk stored by the polls to the data directory
+type persister struct {
+	dir string
+
+	// Segment being written and the time it was started
+	file  *os.File
+	start time.Time
+
+	// Ids of the names defined in the segment
+	ids map[string]uint64
+
+	// Last values written for each node, missing stats were removed
+	prev map[string]map[string]float64
+
+	// Reused to write each chunk with a single call
+	buf bytes.Buffer
+
+	// Lock for everything above since all polls share the persister
+	lock sync.Mutex
+}
+
+// Create the data directory if needed and remove expired segments
+func newPersister(dir string) (*persister, error) {
+
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		return nil, err
+	}
+
+	removeExpiredSegments(dir, time.Now())
+
+	return &persister{
+		dir: dir,
+	}, nil
+}
+
+// Append a chunk of a node to the current segment
+func (p *persister) persist(node string, sampleTime time.Time,
+	vals map[string]float64) {
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if p.file == nil || sampleTime.Sub(p.start) >= segmentSpan {
+		err := p.rotate(sampleTime)
+		if err != nil {
+			log.Warnf("persist: unable to start a segment: %v", err)
+			return
+		}
+	}
+
+	p.buf.Reset()
+
+	nodeID := p.id(node)
+	prev, ok := p.prev[node]
+	if !ok {
+		prev = make(map[string]float64)
+		p.prev[node] = prev
+	}
+
+	changed := make([]uint64, 0)
+	xors := make(map[uint64]uint64)
+	for stat, val := range vals {
+		old, ok := prev[stat]
+		if ok && math.Float64bits(old) == math.Float64bits(val) {
+			continue
+		}
+		id := p.id(stat)
+		changed = append(changed, id)
+		xors[id] = math.Float64bits(old) ^ math.Float64bits(val)
+		prev[stat] = val
+	}
+
+	removed := make([]uint64, 0)
+	for stat := range prev {
+		if _, ok := vals[stat]; !ok {
+			removed = append(removed, p.id(stat))
+			delete(prev, stat)
+		}
+	}
+
+	p.buf.WriteByte(recordChunk)
+	writeUvarint(&p.buf, nodeID)
+	writeVarint(&p.buf, sampleTime.UnixMilli())
+	writeIDs(&p.buf, changed, xors)
+	writeIDs(&p.buf, removed, nil)
+
+	_, err := p.file.Write(p.buf.Bytes())
+	if err != nil {
+		log.Warnf("persist: unable to write chunk from %s: %v", node, err)
+
+		// Later chunks could refer to names that were not written
+		p.file.Close()
+		p.file = nil
+	}
+}
+
+// Id of a name in the current segment, defining it first if needed
+// Definitions are written to buf, so every id of a chunk is taken before
+// the chunk itself is written
+func (p *persister) id(name string) uint64 {
+
+	id, ok := p.ids[name]
+	if !ok {
+		id = uint64(len(p.ids))
+		p.ids[name] = id
+
+		p.buf.WriteByte(recordName)
+		writeUvarint(&p.buf, uint64(len(name)))
+		p.buf.WriteString(name)
+	}
+
+	return id
+}
+
+// Close the current segment and start a new one at start
+func (p *persister) rotate(start time.Time) error {
+
+	if p.file != nil {
+		p.file.Close()
+		p.file = nil
+	}
+
+	removeExpiredSegments(p.dir, start)
+
+	path := filepath.Join(
+		p.dir, strconv.FormatInt(start.UnixMilli(), 10)+segmentSuffix,
+	)
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+
+	_, err = file.WriteString(segmentMagic)
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	p.file = file
+	p.start = start
+	p.ids = make(map[string]uint64)
+	p.prev = make(map[string]map[string]float64)
+
+	return nil
+}
+
+// Close the current segment
+func (p *persister) close() error {
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if p.file == nil {
+		return nil
+	}
+	return p.file.Close()
+}
+
+// Write ids in increasing order as deltas, each followed by its value
+// if vals is given
+func writeIDs(buf *bytes.Buffer, ids []uint64, vals map[uint64]uint64) {
+
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	writeUvarint(buf, uint64(len(ids)))
+
+	var last uint64
+	for _, id := range ids {
+		writeUvarint(buf, id-last)
+		last = id
+		if vals != nil {
+			writeUvarint(buf, vals[id])
+		}
+	}
+}
+
+func writeUvarint(buf *bytes.Buffer, val uint64) {
+	var scratch [binary.MaxVarintLen64]byte
+	buf.Write(scratch[:binary.PutUvarint(scratch[:], val)])
+}
+
+func writeVarint(buf *bytes.Buffer, val int64) {
+	var scratch [binary.MaxVarintLen64]byte
+	buf.Write(scratch[:binary.PutVarint(scratch[:], val)])
+}
+
+// A segment file of the data directory
+type segment struct {
+	path  string
+	start time.Time
+}
+
+// Segments of the data directory, oldest first
+func listSegments(dir string) ([]segment, error) {
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	segments := make([]segment, 0)
+
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, segmentSuffix) {
+			continue
+		}
+
+		ms, err := strconv.ParseInt(
+			strings.TrimSuffix(name, segmentSuffix), 10, 64,
+		)
+		if err != nil {
+			continue
+		}
+
+		segments = append(segments, segment{
+			path:  filepath.Join(dir, name),
+			start: time.UnixMilli(ms),
+		})
+	}
+
+	sort.Slice(segments, func(i, j int) bool {
+		return segments[i].start.Before(segments[j].start)
+	})
+
+	return segments, nil
+}
+
+// Remove the segments whose chunks are all older than historyRetention
+// A segment ends where the next one starts
+func removeExpiredSegments(dir string, now time.Time) {
+
+	segments, err := listSegments(dir)
+	if err != nil {
+		log.Warnf("persist: unable to list %s: %v", dir, err)
+		return
+	}
+
+	for i := 0; i+1 < len(segments); i++ {
+		if now.Sub(segments[i+1].start) > historyRetention {
+			err := os.Remove(segments[i].path)
+			if err != nil {
+				log.Warnf("persist: unable to remove %s: %v",
+					segments[i].path, err)
+			}
+		}
+	}
+}
+
+// Read the chunks of a segment in order
+// vals holds every stat of the node and is reused between calls
+func readSegment(path string,
+	fn func(node string, sampleTime time.Time, vals map[string]float64)) error {
+
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	r := bufio.NewReader(file)
+
+	magic := make([]byte, len(segmentMagic))
+	_, err = io.ReadFull(r, magic)
+	if err != nil || string(magic) != segmentMagic {
+		return fmt.Errorf("%s is not a segment", path)
+	}
+
+	names := make([]string, 0)
+	nodes := make(map[string]map[string]float64)
+
+	name := func(id uint64) (string, error) {
+		if id >= uint64(len(names)) {
+			return "", fmt.Errorf("undefined name %d", id)
+		}
+		return names[id], nil
+	}
+
+	for {
+		kind, err := r.ReadByte()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		switch kind {
+		case recordName:
+			length, err := binary.ReadUvarint(r)
+			if err != nil {
+				return truncated(path, err)
+			}
+			buf := make([]byte, length)
+			_, err = io.ReadFull(r, buf)
+			if err != nil {
+				return truncated(path, err)
+			}
+			names = append(names, string(buf))
+
+		case recordChunk:
+			nodeID, err := binary.ReadUvarint(r)
+			if err != nil {
+				return truncated(path, err)
+			}
+			node, err := name(nodeID)
+			if err != nil {
+				return err
+			}
+			ms, err := binary.ReadVarint(r)
+			if err != nil {
+				return truncated(path, err)
+			}
+
+			vals, ok := nodes[node]
+			if !ok {
+				vals = make(map[string]float64)
+				nodes[node] = vals
+			}
+
+			// Changed stats
+			count, err := binary.ReadUvarint(r)
+			if err != nil {
+				return truncated(path, err)
+			}
+			var id uint64
+			for i := uint64(0); i < count; i++ {
+				delta, err := binary.ReadUvarint(r)
+				if err != nil {
+					return truncated(path, err)
+				}
+				xor, err := binary.ReadUvarint(r)
+				if err != nil {
+					return truncated(path, err)
+				}
+				id += delta
+				stat, err := name(id)
+				if err != nil {
+					return err
+				}
+				vals[stat] = math.Float64frombits(
+					math.Float64bits(vals[stat]) ^ xor,
+				)
+			}
+
+			// Removed stats
+			count, err = binary.ReadUvarint(r)
+			if err != nil {
+				return truncated(path, err)
+			}
+			id = 0
+			for i := uint64(0); i < count; i++ {
+				delta, err := binary.ReadUvarint(r)
+				if err != nil {
+					return truncated(path, err)
+				}
+				id += delta
+				stat, err := name(id)
+				if err != nil {
+					return err
+				}
+				delete(vals, stat)
+			}
+
+			fn(node, time.UnixMilli(ms), vals)
+
+		default:
+			return fmt.Errorf("invalid record %d in %s", kind, path)
+		}
+	}
+}
+
+// A segment cut short by a crash, everything before the cut is kept
+func truncated(path string, err error) error {
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return fmt.Errorf("%s ends with a partial record: %v", path, err)
+}
+
+// Load the history kept in the data directory into the nodes being
+// monitored, returns the number of chunks loaded
+// Runs before the polls start, the first live chunk of each node follows
+// the restored ones like any other
+func restoreHistory(dir string, stats *stats) (int, error) {
+
+	segments, err := listSegments(dir)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	loaded := 0
+	timeDiffs := make(map[string]*float64)
+	cutoff := time.Now().Add(-historyRetention)
+
+	for _, segment := range segments {
+		err := readSegment(segment.path, func(node string, sampleTime time.Time,
+			vals map[string]float64) {
+
+			series := stats.series(node)
+			if series == nil || sampleTime.Before(cutoff) {
+				return
+			}
+
+			statsList := make([]string, 0, len(vals))
+			for stat := range vals {
+				statsList = append(statsList, stat)
+			}
+
+			timeDiff, ok := timeDiffs[node]
+			if !ok {
+				timeDiff = new(float64)
+				timeDiffs[node] = timeDiff
+			}
+
+			series.lock.Lock()
+			for _, stat := range statsList {
+				series.addStat(stat)
+			}
+			series.store(sampleTime, vals, statsList, stats.interval, timeDiff)
+			series.lock.Unlock()
+
+			loaded++
+		})
+
+		// Keep what was read before a partial record
+		if err != nil {
+			log.Warnf("persist: %v", err)
+		}
+	}
+
+	return loaded, nil
+}
@@ -0,0 +1,168 @@
+//  Copyright 2023-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included
+//  in the file licenses/BSL-Couchbase.txt.  As of the Change Date specified
+//  in that file, in accordance with the Business Source License, use of this
+//  software will be governed by the Apache License, Version 2.0, included in
+//  the file licenses/APL2.txt.
+
+package main
+
+import (
+	"math"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestPersistRoundTrip(t *testing.T) {
+
+	dir := t.TempDir()
+	start := time.Now().Add(-time.Minute).Truncate(time.Second)
+
+	chunks := []struct {
+		node   string
+		offset time.Duration
+		vals   map[string]float64
+	}{
+		{"node1", 0, map[string]float64{"stat1": 1, "stat2": 0.5}},
+		{"node2", 0, map[string]float64{"stat1": 7}},
+		{"node1", time.Second, map[string]float64{"stat1": 1, "stat2": -3}},
+		// Removed stat
+		{"node1", time.Second * 2, map[string]float64{"stat1": 2}},
+		{"node2", time.Second * 2, map[string]float64{"stat1": math.Inf(1)}},
+		// Starts a new segment
+		{"node1", segmentSpan, map[string]float64{"stat1": 3, "stat3": 1e12}},
+	}
+
+	persist, err := newPersister(dir)
+	if err != nil {
+		t.Fatalf("Unable to create persister %v", err)
+	}
+	for _, chunk := range chunks {
+		persist.persist(chunk.node, start.Add(chunk.offset), chunk.vals)
+	}
+	if err := persist.close(); err != nil {
+		t.Fatalf("Unable to close persister %v", err)
+	}
+
+	segments, err := listSegments(dir)
+	if err != nil || len(segments) != 2 {
+		t.Fatalf("Expected %v got %v %v", 2, len(segments), err)
+	}
+
+	read := 0
+	for _, segment := range segments {
+		err := readSegment(segment.path, func(node string, sampleTime time.Time,
+			vals map[string]float64) {
+
+			expected := chunks[read]
+			if node != expected.node ||
+				!sampleTime.Equal(start.Add(expected.offset)) ||
+				!reflect.DeepEqual(vals, expected.vals) {
+				t.Errorf("Expected %v got %v %v %v %d", expected,
+					node, sampleTime, vals, read)
+			}
+			read++
+		})
+		if err != nil {
+			t.Errorf("Unexpected error %v", err)
+		}
+	}
+
+	if read != len(chunks) {
+		t.Errorf("Expected %v got %v", len(chunks), read)
+	}
+
+	// A partial record at the end keeps the chunks before it
+	contents, _ := os.ReadFile(segments[0].path)
+	os.WriteFile(segments[0].path, contents[:len(contents)-3], 0600)
+
+	read = 0
+	err = readSegment(segments[0].path, func(string, time.Time, map[string]float64) {
+		read++
+	})
+	if err == nil || read != 4 {
+		t.Errorf("Expected %v got %v %v", 4, read, err)
+	}
+}
+
+func TestRestoreHistory(t *testing.T) {
+
+	dir := t.TempDir()
+	start := time.Now().Add(-time.Minute).Truncate(time.Second)
+
+	persist, err := newPersister(dir)
+	if err != nil {
+		t.Fatalf("Unable to create persister %v", err)
+	}
+	for i := 0; i < 5; i++ {
+		// One interval is missing
+		if i == 3 {
+			continue
+		}
+		persist.persist("node1", start.Add(time.Second*time.Duration(i)),
+			map[string]float64{"stat1": float64(i)})
+		persist.persist("gone", start.Add(time.Second*time.Duration(i)),
+			map[string]float64{"stat1": float64(i)})
+	}
+	persist.close()
+
+	stats := statsInit(&config{stats: make(map[string]*configStatInfo)},
+		[]string{"node1", "node2"})
+
+	loaded, err := restoreHistory(dir, stats)
+	if err != nil || loaded != 4 {
+		t.Errorf("Expected %v got %v %v", 4, loaded, err)
+	}
+
+	line := stats.snapshot("node1", "stat1")
+	expected := []float64{0, 1, 2, math.NaN(), 4}
+	for i, val := range line[len(line)-len(expected):] {
+		if !sameValue(val, expected[i]) {
+			t.Errorf("Expected %v got %v %d", expected[i], val, i)
+		}
+	}
+
+	times := stats.series("node1").times.snapshot()
+	if !times[len(times)-2].IsZero() ||
+		!times[len(times)-1].Equal(start.Add(time.Second*time.Duration(4))) {
+		t.Errorf("Expected %v got %v", start.Add(time.Second*time.Duration(4)),
+			times[len(times)-2:])
+	}
+
+	// Nodes without history are left empty
+	if line := stats.snapshot("node2", "stat1"); line != nil {
+		t.Errorf("Expected %v got %v", nil, line)
+	}
+}
+
+func TestRemoveExpiredSegments(t *testing.T) {
+
+	dir := t.TempDir()
+	now := time.Now()
+
+	starts := []time.Time{
+		now.Add(-historyRetention - time.Hour*time.Duration(2)),
+		now.Add(-historyRetention - time.Hour),
+		// Covers the start of the retention
+		now.Add(-historyRetention + time.Hour),
+		now.Add(-time.Hour),
+	}
+
+	persist := &persister{dir: dir}
+	for _, start := range starts {
+		if err := persist.rotate(start); err != nil {
+			t.Fatalf("Unable to start segment %v", err)
+		}
+	}
+	persist.close()
+
+	removeExpiredSegments(dir, now)
+
+	segments, _ := listSegments(dir)
+	if len(segments) != 3 || !segments[0].start.Equal(starts[1].Truncate(time.Millisecond)) {
+		t.Errorf("Expected %v got %v", starts[1:], segments)
+	}
+}
@@ -0,0 +1,349 @@
+//  Copyright 2023-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included
+//  in the file licenses/BSL-Couchbase.txt.  As of the Change Date specified
+//  in that file, in accordance with the Business Source License, use of this
+//  software will be governed by the Apache License, Version 2.0, included in
+//  the file licenses/APL2.txt.
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/couchbase/clog"
+)
+
+// Paths of the Prometheus endpoint in the order they are tried
+var prometheusPaths = []string{"/metrics", "/_prometheusMetrics"}
+
+// Settings for scraping the Prometheus endpoint of every node
+type prometheusConfig struct {
+	// Port the endpoint is served on, eg. 8091
+	port string
+
+	// Globs matched against the stat keys, all metrics are kept if empty
+	filters []string
+}
+
+// Read the Prometheus settings from the flags, nil if not scraping
+func prometheusInit(port string, filter string) (*prometheusConfig, error) {
+
+	if port == "" {
+		return nil, nil
+	}
+
+	if _, err := strconv.Atoi(port); err != nil {
+		return nil, fmt.Errorf("invalid prometheus port %s", port)
+	}
+
+	config := &prometheusConfig{
+		port:    port,
+		filters: make([]string, 0),
+	}
+
+	for _, glob := range strings.Split(filter, ",") {
+		glob = strings.TrimSpace(glob)
+		if glob == "" {
+			continue
+		}
+		if _, err := path.Match(glob, ""); err != nil {
+			return nil, fmt.Errorf("invalid prometheus filter %s: %v", glob, err)
+		}
+		config.filters = append(config.filters, glob)
+	}
+
+	return config, nil
+}
+
+// Check if a stat key passes the filters
+func (config *prometheusConfig) keep(key string) bool {
+
+	if len(config.filters) == 0 {
+		return true
+	}
+
+	for _, glob := range config.filters {
+		if ok, _ := path.Match(glob, key); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Address of the Prometheus endpoint of a node, on the same host as the
+// search service
+func (config *prometheusConfig) nodeURL(node string) (string, error) {
+
+	u, err := url.Parse(node)
+	if err != nil {
+		return "", err
+	}
+
+	u.Host = net.JoinHostPort(u.Hostname(), config.port)
+	u.Path = ""
+
+	return u.String(), nil
+}
+
+// Parse the Prometheus text exposition format into stats
+// Each sample is keyed by its name followed by its labels in sorted order,
+// eg. kv_ops{bucket="travel",op="get"}
+func parsePrometheus(r io.Reader,
+	keep func(string) bool) (map[string]float64, error) {
+
+	stats := make(map[string]float64)
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSpace(scanner.Text())
+
+		// Comments, HELP and TYPE lines
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		key, rest, err := parseSampleKey(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", lineNum, err)
+		}
+
+		// Value followed by an optional timestamp
+		fields := strings.Fields(rest)
+		if len(fields) == 0 || len(fields) > 2 {
+			return nil, fmt.Errorf("line %d: invalid sample %s", lineNum, line)
+		}
+
+		val, err := strconv.ParseFloat(fields[0], 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid value %s", lineNum, fields[0])
+		}
+
+		// NaN and Inf are valid in the format but no stat can be checked
+		// or recorded with them
+		if math.IsNaN(val) || math.IsInf(val, 0) {
+			continue
+		}
+
+		if keep == nil || keep(key) {
+			stats[key] = val
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return stats, nil
+}
+
+// Read the name and labels at the start of a sample line
+// Returns the stat key and the rest of the line
+func parseSampleKey(line string) (string, string, error) {
+
+	end := strings.IndexAny(line, "{ \t")
+	if end <= 0 {
+		return "", "", fmt.Errorf("invalid sample %s", line)
+	}
+
+	name := line[:end]
+	if line[end] != '{' {
+		return name, line[end:], nil
+	}
+
+	labels := make([]string, 0)
+	i := end + 1
+
+	for {
+		// Skip separators between labels
+		for i < len(line) && (line[i] == ',' || line[i] == ' ') {
+			i++
+		}
+		if i >= len(line) {
+			return "", "", fmt.Errorf("unterminated labels in %s", line)
+		}
+		if line[i] == '}' {
+			i++
+			break
+		}
+
+		eq := strings.IndexByte(line[i:], '=')
+		if eq <= 0 || i+eq+1 >= len(line) || line[i+eq+1] != '"' {
+			return "", "", fmt.Errorf("invalid label in %s", line)
+		}
+		labelName := strings.TrimSpace(line[i : i+eq])
+		i += eq + 2
+
+		// Label value with escaped backslashes, quotes and newlines
+		var value strings.Builder
+		for ; i < len(line) && line[i] != '"'; i++ {
+			if line[i] == '\\' && i+1 < len(line) {
+				i++
+				if line[i] == 'n' {
+					value.WriteByte('\n')
+					continue
+				}
+			}
+			value.WriteByte(line[i])
+		}
+		if i >= len(line) {
+			return "", "", fmt.Errorf("unterminated label value in %s", line)
+		}
+		i++
+
+		labels = append(labels, labelName+"="+strconv.Quote(value.String()))
+	}
+
+	sort.Strings(labels)
+
+	return name + "{" + strings.Join(labels, ",") + "}", line[i:], nil
+}
+
+// Wraps the source of a node, adding the latest values scraped from
+// the Prometheus endpoint of the node to every chunk
+type prometheusSource struct {
+	StatSource
+
+	config   *prometheusConfig
+	node     string
+	creds    *credentials
+	client   *http.Client
+	interval time.Duration
+
+	// Stops the scraping routine
+	cancel context.CancelFunc
+
+	// Values from the latest successful scrape
+	latest map[string]float64
+
+	// Lock for latest
+	lock sync.Mutex
+}
+
+func newPrometheusSource(source StatSource,
+	params *updateStatsParams) *prometheusSource {
+
+	return &prometheusSource{
+		StatSource: source,
+		config:     params.prometheus,
+		node:       params.nodeURL,
+		creds:      params.creds,
+		client:     params.client,
+		interval:   params.stats.interval,
+	}
+}
+
+func (source *prometheusSource) Open(ctx context.Context) error {
+
+	err := source.StatSource.Open(ctx)
+	if err != nil {
+		return err
+	}
+
+	base, err := source.config.nodeURL(source.node)
+	if err != nil {
+		source.StatSource.Close()
+		return err
+	}
+
+	scrapeCtx, cancel := context.WithCancel(ctx)
+	source.cancel = cancel
+
+	go source.scrape(scrapeCtx, base)
+
+	return nil
+}
+
+func (source *prometheusSource) Next() (*message, error) {
+
+	m, err := source.StatSource.Next()
+	if err != nil {
+		return nil, err
+	}
+
+	source.lock.Lock()
+	if len(source.latest) != 0 && m.Stats == nil {
+		m.Stats = make(map[string]float64)
+	}
+	for key, val := range source.latest {
+		m.Stats[key] = val
+	}
+	source.lock.Unlock()
+
+	return m, nil
+}
+
+func (source *prometheusSource) Close() error {
+	if source.cancel != nil {
+		source.cancel()
+	}
+	return source.StatSource.Close()
+}
+
+// Scrape the endpoint every interval until the source is closed
+// Failed scrapes keep the values of the last successful one
+func (source *prometheusSource) scrape(ctx context.Context, base string) {
+
+	ticker := time.NewTicker(source.interval)
+	defer ticker.Stop()
+
+	pathIndex := 0
+	failing := false
+
+	for {
+		resp, err := statsRequest(
+			ctx, source.client, source.creds,
+			base+prometheusPaths[pathIndex],
+		)
+
+		// Try the other path if the endpoint is missing
+		if err == errNotSupported {
+			pathIndex = (pathIndex + 1) % len(prometheusPaths)
+		}
+
+		var stats map[string]float64
+		if err == nil {
+			stats, err = parsePrometheus(resp.Body, source.config.keep)
+			resp.Body.Close()
+		}
+
+		if ctx.Err() != nil {
+			return
+		}
+
+		if err != nil {
+			// Only log the first of a run of failures
+			if !failing {
+				log.Warnf("prometheus: Unable to scrape %s: %v", base, err)
+			}
+			failing = true
+		} else {
+			failing = false
+			source.lock.Lock()
+			source.latest = stats
+			source.lock.Unlock()
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
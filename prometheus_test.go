@@ -0,0 +1,191 @@
+//  Copyright 2023-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included
+//  in the file licenses/BSL-Couchbase.txt.  As of the Change Date specified
+//  in that file, in accordance with the Business Source License, use of this
+//  software will be governed by the Apache License, Version 2.0, included in
+//  the file licenses/APL2.txt.
+
+package main
+
+import (
+	"context"
+	"math"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/couchbaselabs/chronos/fakenode"
+)
+
+func TestParsePrometheus(t *testing.T) {
+
+	testCases := []struct {
+		input    string
+		filter   string
+		expected map[string]float64
+		err      bool
+	}{
+		{
+			input: "# HELP kv_ops Number of operations\n" +
+				"# TYPE kv_ops counter\n" +
+				"kv_ops{op=\"get\",bucket=\"travel\"} 10\n" +
+				"kv_ops{bucket=\"travel\",op=\"set\"} 4 1690000000000\n" +
+				"\n" +
+				"index_memory_used 2.5e+06\n",
+			expected: map[string]float64{
+				"kv_ops{bucket=\"travel\",op=\"get\"}": 10,
+				"kv_ops{bucket=\"travel\",op=\"set\"}": 4,
+				"index_memory_used":                    2500000,
+			},
+		},
+		// Escaped label values
+		{
+			input: "cm_up{path=\"a\\\\b\",desc=\"say \\\"hi\\\"\"} 1\n",
+			expected: map[string]float64{
+				"cm_up{desc=\"say \\\"hi\\\"\",path=\"a\\\\b\"}": 1,
+			},
+		},
+		// Special values are skipped
+		{
+			input: "cm_up{} +Inf\n" +
+				"cm_down{} -Inf\n" +
+				"cm_rate{} NaN\n" +
+				"cm_count{} 3\n",
+			expected: map[string]float64{
+				"cm_count{}": 3,
+			},
+		},
+		// Filters match against the labels as well
+		{
+			input: "kv_ops{bucket=\"travel\"} 1\n" +
+				"kv_ops{bucket=\"beer\"} 2\n" +
+				"index_memory_used 3\n",
+			filter: "kv_ops{bucket=\"travel\"*",
+			expected: map[string]float64{
+				"kv_ops{bucket=\"travel\"}": 1,
+			},
+		},
+		{
+			input: "kv_ops{bucket=\"travel\" 1\n",
+			err:   true,
+		},
+		{
+			input: "kv_ops one\n",
+			err:   true,
+		},
+	}
+
+	for i, testCase := range testCases {
+
+		config, err := prometheusInit("8091", testCase.filter)
+		if err != nil {
+			t.Fatalf("Invalid config %v %d", err, i)
+		}
+
+		stats, err := parsePrometheus(
+			strings.NewReader(testCase.input), config.keep,
+		)
+		if (err != nil) != testCase.err {
+			t.Errorf("Expected error %v got %v %d", testCase.err, err, i)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+
+		if len(stats) != len(testCase.expected) {
+			t.Errorf("Expected %v got %v %d", testCase.expected, stats, i)
+			continue
+		}
+
+		for key, val := range testCase.expected {
+			got, ok := stats[key]
+			if !ok || (got != val && !(math.IsNaN(got) && math.IsNaN(val))) {
+				t.Errorf("Expected %v got %v %d", testCase.expected, stats, i)
+				break
+			}
+		}
+	}
+}
+
+func TestPrometheusSource(t *testing.T) {
+
+	interval := time.Millisecond * time.Duration(10)
+
+	node, err := fakenode.NewNode(&fakenode.Scenario{
+		Interval: interval,
+		Stats:    map[string]fakenode.Series{"stat1": fakenode.Constant(1)},
+	}, "127.0.0.1:0", "user", "pass")
+	if err != nil {
+		t.Fatalf("Unable to start node %v", err)
+	}
+	defer node.Close()
+
+	// Only serving the older path
+	metrics := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, req *http.Request) {
+			if req.URL.Path != "/_prometheusMetrics" {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Write([]byte("kv_ops{bucket=\"travel\"} 7\nsys_cpu 3\n"))
+		},
+	))
+	defer metrics.Close()
+
+	metricsURL, _ := url.Parse(metrics.URL)
+	_, port, _ := net.SplitHostPort(metricsURL.Host)
+
+	promConfig, err := prometheusInit(port, "kv_*")
+	if err != nil {
+		t.Fatalf("Invalid config %v", err)
+	}
+
+	stats := statsInit(&config{
+		stats:    make(map[string]*configStatInfo),
+		interval: &interval,
+	}, []string{node.URL()})
+
+	params := newUpdateStatsParams(
+		&credentials{username: "user", password: "pass"}, stats,
+		node.URL(), nil, nil, nil, nil, context.Background(),
+		httpClientInit(nil),
+	)
+	params.prometheus = promConfig
+
+	source, err := openStatSource(params)
+	if err != nil {
+		t.Fatalf("Unable to open source %v", err)
+	}
+	defer source.Close()
+
+	timeout := time.After(time.Second * time.Duration(5))
+
+	for {
+		m, err := source.Next()
+		if err != nil {
+			t.Fatalf("Unable to read chunk %v", err)
+		}
+
+		if val, ok := m.Stats["kv_ops{bucket=\"travel\"}"]; ok {
+			if val != 7 || m.Stats["stat1"] != 1 {
+				t.Errorf("Expected %v got %v", 7, m.Stats)
+			}
+			if _, ok := m.Stats["sys_cpu"]; ok {
+				t.Errorf("Expected sys_cpu to be filtered got %v", m.Stats)
+			}
+			break
+		}
+
+		select {
+		case <-timeout:
+			t.Fatalf("Timed out waiting for scraped stats, got %v", m.Stats)
+		default:
+		}
+	}
+}
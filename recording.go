@@ -0,0 +1,395 @@
+//  Copyright 2023-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included
+//  in the file licenses/BSL-Couchbase.txt.  As of the Change Date specified
+//  in that file, in accordance with the Business Source License, use of this
+//  software will be governed by the Apache License, Version 2.0, included in
+//  the file licenses/APL2.txt.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	log "github.com/couchbase/clog"
+	"github.com/couchbaselabs/chronos/widgets"
+)
+
+// Replay speeds that can be cycled through from the UI
+// A speed of 0 replays the recording as fast as possible
+var replaySpeeds = []float64{1, 10, 0}
+
+// Amount of time skipped by a single seek from the UI
+const replaySeekStep = time.Minute
+
+// One chunk of a recording, stored as a single line of JSON
+type recordEntry struct {
+	Node    string    `json:"node"`
+	Time    time.Time `json:"time"`
+	Message message   `json:"message"`
+}
+
+// Writes every chunk received from the nodes to a recording file
+type recorder struct {
+	file *os.File
+	enc  *json.Encoder
+
+	// Lock for the file since all polls share the recorder
+	lock sync.Mutex
+}
+
+// Create a new recording file, truncating any existing file
+func newRecorder(path string) (*recorder, error) {
+
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return &recorder{
+		file: file,
+		enc:  json.NewEncoder(file),
+	}, nil
+}
+
+// Append a chunk along with its arrival time to the recording
+func (rec *recorder) record(node string, arrival time.Time, m *message) {
+
+	rec.lock.Lock()
+	defer rec.lock.Unlock()
+
+	err := rec.enc.Encode(&recordEntry{
+		Node:    node,
+		Time:    arrival,
+		Message: *m,
+	})
+	if err != nil {
+		log.Warnf("recording: unable to write chunk from %s: %v", node, err)
+	}
+}
+
+// Flush and close the recording file
+func (rec *recorder) close() error {
+
+	rec.lock.Lock()
+	defer rec.lock.Unlock()
+
+	return rec.file.Close()
+}
+
+// Feeds the chunks of a recording to the stats struct in place of the polls
+type replayer struct {
+	path string
+
+	// Index into replaySpeeds
+	speed int
+
+	// Recording time before which chunks are fed without any delay
+	seekTime time.Time
+
+	// Recording time of the chunk fed last, used as the clock during replay
+	curTime time.Time
+
+	// Time of the first chunk of the recording
+	start time.Time
+
+	// Lock for speed, seekTime and curTime
+	lock sync.RWMutex
+
+	// Signalled when a seek goes back, the recording is then fed again
+	// from the start
+	rewind chan struct{}
+}
+
+// Create a new replayer for the recording at path
+// speed is one of "1x", "10x" or "max", seek is an offset from the start
+// of the recording to skip to
+func newReplayer(path string, speed string, seek time.Duration) (*replayer,
+	error) {
+
+	replay := &replayer{
+		path:   path,
+		rewind: make(chan struct{}, 1),
+	}
+
+	switch speed {
+	case "1x":
+		replay.speed = 0
+	case "10x":
+		replay.speed = 1
+	case "max":
+		replay.speed = 2
+	default:
+		return nil, fmt.Errorf("invalid replay speed %q", speed)
+	}
+
+	start, err := replay.startTime()
+	if err != nil {
+		return nil, err
+	}
+
+	replay.seekTime = start.Add(seek)
+	replay.curTime = start
+	replay.start = start
+
+	return replay, nil
+}
+
+// Read the time of the first chunk of the recording
+func (replay *replayer) startTime() (time.Time, error) {
+
+	file, err := os.Open(replay.path)
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer file.Close()
+
+	var entry recordEntry
+	err = json.NewDecoder(file).Decode(&entry)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("unable to read recording: %v", err)
+	}
+
+	return entry.Time, nil
+}
+
+// Get the list of nodes present in the recording in order of appearance
+func (replay *replayer) nodesList() ([]string, error) {
+
+	file, err := os.Open(replay.path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	dec := json.NewDecoder(file)
+	seen := make(map[string]bool)
+	nodesList := make([]string, 0)
+
+	for {
+		var entry struct {
+			Node string `json:"node"`
+		}
+
+		err := dec.Decode(&entry)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("unable to read recording: %v", err)
+		}
+
+		if !seen[entry.Node] {
+			seen[entry.Node] = true
+			nodesList = append(nodesList, entry.Node)
+		}
+	}
+
+	return nodesList, nil
+}
+
+// Current time of the replay
+func (replay *replayer) now() time.Time {
+
+	replay.lock.RLock()
+	defer replay.lock.RUnlock()
+
+	return replay.curTime
+}
+
+// Move to the next replay speed, returns its name
+func (replay *replayer) cycleSpeed(step int) string {
+
+	replay.lock.Lock()
+	defer replay.lock.Unlock()
+
+	replay.speed = replay.speed + step
+	if replay.speed < 0 {
+		replay.speed = 0
+	} else if replay.speed >= len(replaySpeeds) {
+		replay.speed = len(replaySpeeds) - 1
+	}
+
+	return speedName(replaySpeeds[replay.speed])
+}
+
+// Move the replay by the given duration from where it is or is skipping
+// to, going back no further than the start of the recording
+func (replay *replayer) seek(offset time.Duration) {
+
+	replay.lock.Lock()
+	defer replay.lock.Unlock()
+
+	from := replay.curTime
+	if replay.seekTime.After(from) {
+		from = replay.seekTime
+	}
+	replay.seekTime = from.Add(offset)
+
+	if offset >= 0 {
+		return
+	}
+
+	if replay.seekTime.Before(replay.start) {
+		replay.seekTime = replay.start
+	}
+
+	// The buffers only move forward, so they are filled again from the
+	// start up to the new position
+	select {
+	case replay.rewind <- struct{}{}:
+	default:
+	}
+}
+
+// Move the replay clock back to the start of the recording
+func (replay *replayer) restart() {
+
+	replay.lock.Lock()
+	defer replay.lock.Unlock()
+
+	replay.curTime = replay.start
+}
+
+// Returns the time to wait before feeding a chunk recorded at entryTime
+// Also advances the replay clock
+func (replay *replayer) advance(entryTime time.Time) time.Duration {
+
+	replay.lock.Lock()
+	defer replay.lock.Unlock()
+
+	var delay time.Duration
+	speed := replaySpeeds[replay.speed]
+
+	if speed != 0 && !entryTime.Before(replay.seekTime) {
+		delay = time.Duration(float64(entryTime.Sub(replay.curTime)) / speed)
+	}
+
+	if entryTime.After(replay.curTime) {
+		replay.curTime = entryTime
+	}
+
+	return delay
+}
+
+// Name of a replay speed to be displayed
+func speedName(speed float64) string {
+	if speed == 0 {
+		return "max"
+	}
+	return fmt.Sprintf("%gx", speed)
+}
+
+// Replays the recording through the same path the polls use
+// Runs in place of monitorCluster
+func replayRecording(manager *manager, replay *replayer) {
+
+	file, err := os.Open(replay.path)
+	if err != nil {
+		manager.sendError(newErrorMsg(
+			err, "replay: unable to open recording: "+err.Error(), true,
+		))
+		return
+	}
+	defer file.Close()
+
+	// Parameters for each node, which also hold the rounding state
+	paramsList := make(map[string]*updateStatsParams)
+
+	dec := json.NewDecoder(file)
+
+	// Feed the recording again from the start after a seek back
+	rewind := func() bool {
+		_, err := file.Seek(0, io.SeekStart)
+		if err != nil {
+			manager.sendError(newErrorMsg(
+				err, "replay: unable to rewind recording: "+err.Error(), true,
+			))
+			return false
+		}
+
+		dec = json.NewDecoder(file)
+		paramsList = make(map[string]*updateStatsParams)
+		manager.stats.clearData()
+		replay.restart()
+
+		log.Printf("replay: going back in %s", replay.path)
+		return true
+	}
+
+	for {
+		select {
+		case <-replay.rewind:
+			if !rewind() {
+				return
+			}
+		default:
+		}
+
+		var entry recordEntry
+
+		err := dec.Decode(&entry)
+		if err == io.EOF {
+			log.Printf("replay: reached the end of %s", replay.path)
+			select {
+			case manager.popupChannel <- "replayEnd":
+			case <-manager.ctx.Done():
+				return
+			}
+
+			// Wait in case the replay is moved back
+			select {
+			case <-replay.rewind:
+				if !rewind() {
+					return
+				}
+				continue
+			case <-manager.ctx.Done():
+				return
+			}
+		}
+		if err != nil {
+			manager.sendError(newErrorMsg(
+				err, "replay: invalid chunk in recording: "+err.Error(), true,
+			))
+			return
+		}
+
+		params, ok := paramsList[entry.Node]
+		if !ok {
+			params = newUpdateStatsParams(
+				manager.creds, manager.stats,
+				entry.Node, manager.errChannel, manager.eventChannel,
+				manager.popupChannel, manager.updateChannel, manager.ctx, nil,
+			)
+			params.replaying = true
+			paramsList[entry.Node] = params
+		}
+
+		// Stop the replay early if chronos is shutting down
+		select {
+		case <-time.After(replay.advance(entry.Time)):
+		case <-replay.rewind:
+			if !rewind() {
+				return
+			}
+			continue
+		case <-manager.ctx.Done():
+			return
+		}
+
+		if processMessage(params, &entry.Message, entry.Time) < 0 {
+			return
+		}
+	}
+}
+
+// Use the replay clock for alerts instead of the wall clock
+func useReplayClock(replay *replayer) {
+	widgets.Now = replay.now
+}
@@ -0,0 +1,200 @@
+//  Copyright 2023-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included
+//  in the file licenses/BSL-Couchbase.txt.  As of the Change Date specified
+//  in that file, in accordance with the Business Source License, use of this
+//  software will be governed by the Apache License, Version 2.0, included in
+//  the file licenses/APL2.txt.
+
+package main
+
+import (
+	"context"
+	"math"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/couchbaselabs/chronos/widgets"
+)
+
+func TestRecordReplay(t *testing.T) {
+
+	curTime, _ := time.Parse("2006-01-02 15:04:05", "2001-01-01 01:01:30")
+	path := filepath.Join(t.TempDir(), "session.rec")
+
+	rec, err := newRecorder(path)
+	if err != nil {
+		t.Fatalf("Unable to create recorder %v", err)
+	}
+
+	rec.record("node1", curTime, &message{Stats: map[string]float64{"stat1": 1}})
+	rec.record("node2", curTime.Add(time.Second), &message{Stats: map[string]float64{"stat1": 2}})
+	rec.record("node1", curTime.Add(time.Second*time.Duration(2)), &message{Stats: map[string]float64{"stat1": 3}})
+	rec.record("node1", curTime.Add(time.Second*time.Duration(4)), &message{Stats: map[string]float64{"stat1": 4}})
+
+	err = rec.close()
+	if err != nil {
+		t.Fatalf("Unable to close recorder %v", err)
+	}
+
+	replay, err := newReplayer(path, "10x", time.Second*time.Duration(2))
+	if err != nil {
+		t.Fatalf("Unable to create replayer %v", err)
+	}
+
+	nodesList, err := replay.nodesList()
+	if err != nil {
+		t.Fatalf("Unable to read nodes %v", err)
+	}
+
+	if len(nodesList) != 2 || nodesList[0] != "node1" || nodesList[1] != "node2" {
+		t.Errorf("Expected %v got %v", []string{"node1", "node2"}, nodesList)
+	}
+
+	testCases := []struct {
+		entryTime time.Time
+		delay     time.Duration
+	}{
+		// Chunks before the seek time are fed without any delay
+		{
+			entryTime: curTime,
+			delay:     0,
+		},
+		{
+			entryTime: curTime.Add(time.Second),
+			delay:     0,
+		},
+		// Chunks after the seek time are scaled by the speed
+		{
+			entryTime: curTime.Add(time.Second * time.Duration(2)),
+			delay:     time.Millisecond * time.Duration(100),
+		},
+		{
+			entryTime: curTime.Add(time.Second * time.Duration(4)),
+			delay:     time.Millisecond * time.Duration(200),
+		},
+	}
+
+	for i, testCase := range testCases {
+
+		delay := replay.advance(testCase.entryTime)
+
+		if delay != testCase.delay {
+			t.Errorf("Expected %v got %v %d", testCase.delay, delay, i)
+		}
+
+		if !replay.now().Equal(testCase.entryTime) {
+			t.Errorf("Expected %v got %v %d", testCase.entryTime, replay.now(), i)
+		}
+	}
+
+	if speed := replay.cycleSpeed(1); speed != "max" {
+		t.Errorf("Expected %v got %v", "max", speed)
+	}
+
+	if speed := replay.cycleSpeed(1); speed != "max" {
+		t.Errorf("Expected %v got %v", "max", speed)
+	}
+
+	if speed := replay.cycleSpeed(-2); speed != "1x" {
+		t.Errorf("Expected %v got %v", "1x", speed)
+	}
+}
+
+func TestReplaySeekBack(t *testing.T) {
+
+	curTime, _ := time.Parse("2006-01-02 15:04:05", "2001-01-01 01:01:30")
+	path := filepath.Join(t.TempDir(), "session.rec")
+
+	rec, err := newRecorder(path)
+	if err != nil {
+		t.Fatalf("Unable to create recorder %v", err)
+	}
+	for i := 0; i < 5; i++ {
+		rec.record(
+			"node1", curTime.Add(time.Second*time.Duration(i)),
+			&message{Stats: map[string]float64{"stat1": float64(i)}},
+		)
+	}
+	err = rec.close()
+	if err != nil {
+		t.Fatalf("Unable to close recorder %v", err)
+	}
+
+	replay, err := newReplayer(path, "max", 0)
+	if err != nil {
+		t.Fatalf("Unable to create replayer %v", err)
+	}
+
+	interval := time.Second
+	stats := statsInit(&config{
+		stats:    make(map[string]*configStatInfo),
+		interval: &interval,
+	}, []string{"node1"})
+	stats.initialized[""] = true
+	stats.statsList = []string{"stat1"}
+	stats.addStat("stat1")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	manager := &manager{
+		stats: stats,
+		channels: &channels{
+			errChannel:    make(chan *errorMsg, 10),
+			eventChannel:  make(chan *widgets.Event, 100),
+			popupChannel:  make(chan string, 100),
+			updateChannel: make(chan updateMessage, 100),
+		},
+		ctx:    ctx,
+		cancel: cancel,
+	}
+
+	go replayRecording(manager, replay)
+
+	waitEnd := func() {
+		for popup := range manager.popupChannel {
+			if popup == "replayEnd" {
+				return
+			}
+		}
+	}
+
+	// Check that every chunk is in the buffer once
+	checkBuffer := func(pass int) {
+		series := stats.series("node1")
+		series.lock.RLock()
+		defer series.lock.RUnlock()
+
+		buffer := series.buffers["stat1"]
+		last := buffer.len() - 1
+		for i := 0; i < 5; i++ {
+			if val := buffer.at(last - 4 + i); val != float64(i) {
+				t.Errorf("Expected %v got %v %d %d", float64(i), val, i, pass)
+			}
+		}
+		if !math.IsNaN(buffer.at(last - 5)) {
+			t.Errorf("Expected %v got %v %d", math.NaN(), buffer.at(last-5), pass)
+		}
+	}
+
+	waitEnd()
+	checkBuffer(0)
+
+	// Going back further than the start stops at the start
+	replay.seek(-time.Hour)
+	waitEnd()
+	checkBuffer(1)
+
+	replay.lock.RLock()
+	seekTime := replay.seekTime
+	replay.lock.RUnlock()
+	if !seekTime.Equal(curTime) {
+		t.Errorf("Expected %v got %v", curTime, seekTime)
+	}
+	if !replay.now().Equal(curTime.Add(time.Second * time.Duration(4))) {
+		t.Errorf("Expected %v got %v", curTime.Add(time.Second*time.Duration(4)),
+			replay.now())
+	}
+}
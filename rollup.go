@@ -0,0 +1,196 @@
+//  Copyright 2023-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included
+//  in the file licenses/BSL-Couchbase.txt.  As of the Change Date specified
+//  in that file, in accordance with the Business Source License, use of this
+//  software will be governed by the Apache License, Version 2.0, included in
+//  the file licenses/APL2.txt.
+
+package main
+
+import (
+	"math"
+	"time"
+)
+
+// Coarser resolutions kept after the raw samples, finest first
+// Together they hold a day of history in a fixed amount of memory
+var rollupTiers = []struct {
+	width time.Duration
+	span  time.Duration
+}{
+	{width: time.Second * time.Duration(10), span: time.Hour},
+	{width: time.Minute, span: time.Hour * time.Duration(24)},
+}
+
+// Summary of the samples of a stat that fall within one bucket
+type rollup struct {
+	Min  float64
+	Max  float64
+	Avg  float64
+	Last float64
+
+	// Number of known samples in the bucket, 0 if none arrived in which
+	// case the values are NaN
+	Count int
+}
+
+// Bucket of a gap in the samples
+func gapRollup() rollup {
+	nan := math.NaN()
+	return rollup{Min: nan, Max: nan, Avg: nan, Last: nan}
+}
+
+// Add a sample to the bucket, missing samples are left out
+func (bucket *rollup) add(val float64) {
+
+	if math.IsNaN(val) {
+		return
+	}
+
+	if bucket.Count == 0 {
+		bucket.Min = val
+		bucket.Max = val
+		bucket.Avg = val
+	} else {
+		bucket.Min = math.Min(bucket.Min, val)
+		bucket.Max = math.Max(bucket.Max, val)
+		bucket.Avg += (val - bucket.Avg) / float64(bucket.Count+1)
+	}
+
+	bucket.Last = val
+	bucket.Count++
+}
+
+// Buckets of one width for all the stats of a node
+type tier struct {
+	width time.Duration
+
+	// Start time of each closed bucket, zero if it is unknown
+	times *ring[time.Time]
+
+	// Closed buckets of each stat, one per start time
+	buffers map[string]*ring[rollup]
+
+	// Start time of the bucket being filled
+	start time.Time
+
+	// Bucket being filled for each stat
+	open map[string]rollup
+}
+
+// Initialize the tiers of a node with empty buffers for the given stats
+func newTiers(statsList []string) []*tier {
+
+	tiers := make([]*tier, 0, len(rollupTiers))
+
+	for _, tierInfo := range rollupTiers {
+		tier := &tier{
+			width:   tierInfo.width,
+			times:   newRing[time.Time](int(tierInfo.span / tierInfo.width)),
+			buffers: make(map[string]*ring[rollup]),
+			open:    make(map[string]rollup),
+		}
+		for _, stat := range statsList {
+			tier.addStat(stat)
+		}
+		tiers = append(tiers, tier)
+	}
+
+	return tiers
+}
+
+// Add an empty buffer for the stat if the tier does not have one
+func (tier *tier) addStat(stat string) {
+	if _, ok := tier.buffers[stat]; !ok {
+		tier.buffers[stat] = filledRing(tier.times.len(), gapRollup())
+	}
+}
+
+// Remove the buffers of the stat
+func (tier *tier) removeStat(stat string) {
+	delete(tier.buffers, stat)
+	delete(tier.open, stat)
+}
+
+// Add the values of a chunk sampled at sampleTime
+// Stats missing from the chunk and NaN values are left out, a bucket is
+// only a gap if none of its samples are known
+func (tier *tier) add(sampleTime time.Time, vals map[string]float64) {
+
+	start := sampleTime.Truncate(tier.width)
+
+	// Samples older than the open bucket cannot be placed anymore
+	if start.Before(tier.start) {
+		return
+	}
+
+	if start.After(tier.start) {
+		if !tier.start.IsZero() {
+			tier.close()
+
+			// Buckets that got no samples are gaps
+			missing := int(start.Sub(tier.start)/tier.width) - 1
+			if missing > tier.times.len() {
+				missing = tier.times.len()
+			}
+			for i := 0; i < missing; i++ {
+				tier.times.push(time.Time{})
+				for _, buffer := range tier.buffers {
+					buffer.push(gapRollup())
+				}
+			}
+		}
+
+		tier.start = start
+		tier.open = make(map[string]rollup, len(tier.buffers))
+	}
+
+	for stat := range tier.buffers {
+		bucket, ok := tier.open[stat]
+		if !ok {
+			bucket = gapRollup()
+		}
+		if val, ok := vals[stat]; ok {
+			bucket.add(val)
+		}
+		tier.open[stat] = bucket
+	}
+}
+
+// Move the open buckets into the buffers
+func (tier *tier) close() {
+
+	tier.times.push(tier.start)
+
+	for stat, buffer := range tier.buffers {
+		bucket, ok := tier.open[stat]
+		if !ok {
+			// Stat added while the bucket was open
+			bucket = gapRollup()
+		}
+		buffer.push(bucket)
+	}
+}
+
+// Largest value of each bucket of a stat including the open one, oldest
+// first, NaN for gaps, nil if the tier has no buffer for it
+// The largest value is graphed so that spikes stay visible
+func (tier *tier) maxLine(stat string) []float64 {
+
+	buffer, ok := tier.buffers[stat]
+	if !ok {
+		return nil
+	}
+
+	line := make([]float64, 0, buffer.len()+1)
+	for i := 0; i < buffer.len(); i++ {
+		line = append(line, buffer.at(i).Max)
+	}
+
+	if bucket, ok := tier.open[stat]; ok && bucket.Count > 0 {
+		line = append(line, bucket.Max)
+	}
+
+	return line
+}
@@ -0,0 +1,133 @@
+//  Copyright 2023-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included
+//  in the file licenses/BSL-Couchbase.txt.  As of the Change Date specified
+//  in that file, in accordance with the Business Source License, use of this
+//  software will be governed by the Apache License, Version 2.0, included in
+//  the file licenses/APL2.txt.
+
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestTierRollup(t *testing.T) {
+
+	tier := newTiers([]string{"stat1"})[0]
+	width := tier.width
+	start := time.UnixMilli(1690000000000).Truncate(width)
+
+	// Offsets of the samples from start in seconds and their values
+	samples := []struct {
+		offset int
+		val    float64
+	}{
+		{0, 4}, {1, 2}, {2, 9}, {3, 5},
+		{10, 1}, {11, 3},
+		// Late sample of the closed bucket is dropped
+		{5, 100},
+		// No samples for two buckets
+		{40, 7},
+	}
+
+	for _, sample := range samples {
+		tier.add(
+			start.Add(time.Second*time.Duration(sample.offset)),
+			map[string]float64{"stat1": sample.val},
+		)
+	}
+
+	buffer := tier.buffers["stat1"]
+	last := buffer.len() - 1
+
+	expectedBuckets := []rollup{
+		{Min: 2, Max: 9, Avg: 5, Last: 5, Count: 4},
+		{Min: 1, Max: 3, Avg: 2, Last: 3, Count: 2},
+		gapRollup(),
+		gapRollup(),
+	}
+	expectedTimes := []time.Time{start, start.Add(width), {}, {}}
+
+	for i, expected := range expectedBuckets {
+		index := last - len(expectedBuckets) + 1 + i
+
+		bucket := buffer.at(index)
+		if !sameValue(bucket.Min, expected.Min) ||
+			!sameValue(bucket.Max, expected.Max) ||
+			!sameValue(bucket.Avg, expected.Avg) ||
+			!sameValue(bucket.Last, expected.Last) ||
+			bucket.Count != expected.Count {
+			t.Errorf("Expected %+v got %+v %d", expected, bucket, i)
+		}
+		if !tier.times.at(index).Equal(expectedTimes[i]) {
+			t.Errorf("Expected %v got %v %d", expectedTimes[i], tier.times.at(index), i)
+		}
+	}
+
+	// The open bucket is graphed after the closed ones
+	line := tier.maxLine("stat1")
+	if len(line) != buffer.len()+1 || line[len(line)-1] != 7 ||
+		line[len(line)-4] != 3 || !math.IsNaN(line[len(line)-2]) {
+		t.Errorf("Expected %v got %v", []float64{3, math.NaN(), math.NaN(), 7},
+			line[len(line)-4:])
+	}
+
+	// Stats added later start with empty buckets
+	tier.addStat("stat2")
+	tier.add(start.Add(time.Second*time.Duration(50)), map[string]float64{"stat1": 1})
+
+	if bucket := tier.buffers["stat2"].last(); bucket.Count != 0 {
+		t.Errorf("Expected %v got %v", 0, bucket.Count)
+	}
+	if bucket := tier.buffers["stat1"].last(); bucket.Max != 7 || bucket.Count != 1 {
+		t.Errorf("Expected %v got %+v", 7, bucket)
+	}
+}
+
+func TestTierRollupMissing(t *testing.T) {
+
+	tier := newTiers([]string{"stat1", "stat2"})[0]
+	width := tier.width
+	start := time.UnixMilli(1690000000000).Truncate(width)
+	nan := math.NaN()
+
+	// stat1 misses a sample in the first bucket and all of them in the
+	// second, stat2 is missing from the chunks of the second bucket
+	chunks := []struct {
+		offset int
+		vals   map[string]float64
+	}{
+		{0, map[string]float64{"stat1": 4, "stat2": 1}},
+		{1, map[string]float64{"stat1": nan, "stat2": 2}},
+		{2, map[string]float64{"stat1": 8, "stat2": 3}},
+		{10, map[string]float64{"stat1": nan}},
+		{11, map[string]float64{"stat1": nan}},
+		{20, map[string]float64{"stat1": 1, "stat2": 1}},
+	}
+
+	for _, chunk := range chunks {
+		tier.add(start.Add(time.Second*time.Duration(chunk.offset)), chunk.vals)
+	}
+
+	expectedBuckets := map[string][]rollup{
+		"stat1": {{Min: 4, Max: 8, Avg: 6, Last: 8, Count: 2}, gapRollup()},
+		"stat2": {{Min: 1, Max: 3, Avg: 2, Last: 3, Count: 3}, gapRollup()},
+	}
+
+	for stat, expectedList := range expectedBuckets {
+		buffer := tier.buffers[stat]
+		for i, expected := range expectedList {
+			bucket := buffer.at(buffer.len() - len(expectedList) + i)
+			if !sameValue(bucket.Min, expected.Min) ||
+				!sameValue(bucket.Max, expected.Max) ||
+				!sameValue(bucket.Avg, expected.Avg) ||
+				!sameValue(bucket.Last, expected.Last) ||
+				bucket.Count != expected.Count {
+				t.Errorf("Expected %+v got %+v %s %d", expected, bucket, stat, i)
+			}
+		}
+	}
+}
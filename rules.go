@@ -0,0 +1,569 @@
+//  Copyright 2023-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included
+//  in the file licenses/BSL-Couchbase.txt.  As of the Change Date specified
+//  in that file, in accordance with the Business Source License, use of this
+//  software will be governed by the Apache License, Version 2.0, included in
+//  the file licenses/APL2.txt.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/couchbaselabs/chronos/widgets"
+)
+
+// Rules alert on a condition over the recent samples of a node, such as
+//
+//	avg(pct_cpu_gc, 30s) > 0.2
+//	rate(tot_rollback_full) > 0
+//	max($stat, 1m) - min($stat, 1m) > 1000
+//
+// Conditions compare two expressions of expr.go, where a stat is its latest
+// sample and the window functions are
+//
+//	avg(stat, window), min(stat, window), max(stat, window): over the
+//	                   samples of the last window, only the latest without one
+//	rate(stat, window): change per second since the start of the window, or
+//	                    since the previous sample without one
+//
+// $stat is the stat the rule is being checked for, picked by its stats globs
+
+// Stands for the stat a rule is checked for
+const thisStat = "$stat"
+
+// Severities a rule can give its alerts, the first being the default
+var severities = []string{
+	widgets.SeverityWarning, widgets.SeverityInfo, widgets.SeverityCritical,
+}
+
+// A rule as given in the rules file
+type ruleSpec struct {
+	Name      string `json:"name"`
+	Condition string `json:"condition"`
+
+	// How long the condition has to hold before alerting, e.g. 20s
+	For string `json:"for,omitempty"`
+
+	Severity string `json:"severity,omitempty"`
+
+	// Globs of the nodes and stats the rule is checked for, every node
+	// and the stats in the condition by default
+	Nodes []string `json:"nodes,omitempty"`
+	Stats []string `json:"stats,omitempty"`
+}
+
+// Node and stat a rule is checked for
+type ruleKey struct {
+	node string
+	stat string
+}
+
+// Compiled rule
+type rule struct {
+	name      string
+	condition *condition
+	duration  time.Duration
+	severity  string
+	nodes     []string
+
+	// Globs of the stats the rule is checked for one at a time, empty to
+	// check it once for the stats the condition uses, which are in uses
+	// and alerted under the first of them, stat
+	stats []string
+	uses  []string
+	stat  string
+
+	// Time of the first sample of every node and stat the condition has
+	// been holding since
+	lock  sync.Mutex
+	since map[ruleKey]time.Time
+}
+
+// Comparison of two expressions
+type condition struct {
+	source      string
+	op          string
+	left, right expr
+}
+
+// Comparison operators, the longer ones first so they are matched first
+var comparisons = []string{">=", "<=", "==", "!=", ">", "<"}
+
+// Function of the samples of a stat over a window
+type windowExpr struct {
+	fn     string
+	stat   string
+	window time.Duration
+}
+
+// Read and compile the rules file
+func readRulesFile(path string) ([]*rule, error) {
+
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read rules file: %v", err)
+	}
+
+	var specs []*ruleSpec
+	err = json.Unmarshal(contents, &specs)
+	if err != nil {
+		return nil, fmt.Errorf("invalid rules file: %v", err)
+	}
+
+	return compileRules(specs)
+}
+
+// Check the rule specs and parse their conditions
+func compileRules(specs []*ruleSpec) ([]*rule, error) {
+
+	rules := make([]*rule, 0, len(specs))
+	names := make(map[string]bool)
+
+	for i, spec := range specs {
+		if spec.Name == "" {
+			return nil, fmt.Errorf("rule %d has no name", i)
+		}
+		if names[spec.Name] {
+			return nil, fmt.Errorf("rule %s defined twice", spec.Name)
+		}
+		names[spec.Name] = true
+
+		cond, err := parseCondition(spec.Condition)
+		if err != nil {
+			return nil, fmt.Errorf("rule %s: %v", spec.Name, err)
+		}
+
+		r := &rule{
+			name:      spec.Name,
+			condition: cond,
+			severity:  severities[0],
+			nodes:     spec.Nodes,
+			stats:     spec.Stats,
+			since:     make(map[ruleKey]time.Time),
+		}
+
+		if spec.For != "" {
+			r.duration, err = time.ParseDuration(spec.For)
+			if err != nil || r.duration < 0 {
+				return nil, fmt.Errorf("rule %s: invalid for %q",
+					spec.Name, spec.For)
+			}
+		}
+
+		if spec.Severity != "" {
+			r.severity = ""
+			for _, severity := range severities {
+				if spec.Severity == severity {
+					r.severity = severity
+				}
+			}
+			if r.severity == "" {
+				return nil, fmt.Errorf("rule %s: severity must be one of %s",
+					spec.Name, strings.Join(severities, ", "))
+			}
+		}
+
+		if len(r.nodes) == 0 {
+			r.nodes = []string{"*"}
+		}
+
+		// Without globs the rule is checked once for the stats it uses
+		if len(r.stats) == 0 {
+			used := uniqueStats(
+				append(exprStats(cond.left), exprStats(cond.right)...),
+			)
+			if len(used) == 0 {
+				return nil, fmt.Errorf("rule %s uses no stat", spec.Name)
+			}
+			r.uses = used
+			r.stat = used[0]
+		}
+
+		for _, glob := range append(r.nodes, r.stats...) {
+			if _, err := path.Match(glob, ""); err != nil {
+				return nil, fmt.Errorf("rule %s: invalid glob %q",
+					spec.Name, glob)
+			}
+		}
+
+		rules = append(rules, r)
+	}
+
+	return rules, nil
+}
+
+// Parse a condition of the form expression op expression
+func parseCondition(source string) (*condition, error) {
+
+	parser := &exprParser{source: source, rule: true}
+
+	left, err := parser.sum()
+	if err != nil {
+		return nil, err
+	}
+
+	cond := &condition{source: strings.TrimSpace(source), left: left}
+
+	parser.peek()
+	for _, op := range comparisons {
+		if strings.HasPrefix(parser.source[parser.pos:], op) {
+			cond.op = op
+			parser.pos += len(op)
+			break
+		}
+	}
+	if cond.op == "" {
+		return nil, parser.errorf("expected one of %s",
+			strings.Join(comparisons, " "))
+	}
+
+	cond.right, err = parser.sum()
+	if err != nil {
+		return nil, err
+	}
+
+	if parser.peek() != 0 {
+		return nil, parser.errorf("unexpected %q", parser.peek())
+	}
+
+	return cond, nil
+}
+
+// Evaluate the condition, returning whether it holds and both sides
+// A side that has no value never holds
+func (cond *condition) eval(env *exprEnv) (bool, float64, float64) {
+
+	left, right := cond.left.eval(env), cond.right.eval(env)
+
+	if math.IsNaN(left) || math.IsNaN(right) {
+		return false, left, right
+	}
+
+	switch cond.op {
+	case ">=":
+		return left >= right, left, right
+	case "<=":
+		return left <= right, left, right
+	case "==":
+		return left == right, left, right
+	case "!=":
+		return left != right, left, right
+	case ">":
+		return left > right, left, right
+	default:
+		return left < right, left, right
+	}
+}
+
+// $stat, after the $ was peeked
+func (p *exprParser) thisStat() (expr, error) {
+	if !strings.HasPrefix(p.source[p.pos:], thisStat) {
+		return nil, p.errorf("expected %s", thisStat)
+	}
+	p.pos += len(thisStat)
+	return statExpr(thisStat), nil
+}
+
+// window := fn '(' stat [',' duration] ')', after fn was read
+func (p *exprParser) window(fn string) (expr, error) {
+
+	switch fn {
+	case "avg", "min", "max", "rate":
+	default:
+		return nil, p.errorf("unknown function %s", fn)
+	}
+	p.pos++
+
+	var stat expr
+	var err error
+
+	switch c := p.peek(); {
+	case c == '$':
+		stat, err = p.thisStat()
+	case c == '"' || isStatChar(c):
+		stat, err = p.primary()
+	default:
+		return nil, p.errorf("expected a stat")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	name, ok := stat.(statExpr)
+	if !ok {
+		return nil, p.errorf("expected a stat")
+	}
+
+	window := &windowExpr{fn: fn, stat: string(name)}
+
+	if p.peek() == ',' {
+		p.pos++
+		p.peek()
+
+		start := p.pos
+		for p.pos < len(p.source) && isStatChar(p.source[p.pos]) {
+			p.pos++
+		}
+
+		window.window, err = time.ParseDuration(p.source[start:p.pos])
+		if err != nil || window.window <= 0 {
+			return nil, p.errorf("invalid window %q", p.source[start:p.pos])
+		}
+	}
+
+	return window, p.expect(')')
+}
+
+func (e *windowExpr) eval(env *exprEnv) float64 {
+
+	if env.series == nil {
+		return math.NaN()
+	}
+
+	buffer, ok := env.series.buffers[env.statName(e.stat)]
+	times := env.series.times
+	if !ok || times.len() == 0 || times.last().IsZero() {
+		return math.NaN()
+	}
+
+	latest := times.last()
+	start := latest.Add(-e.window)
+
+	count, sum := 0, 0.0
+	min, max := math.Inf(1), math.Inf(-1)
+
+	// Oldest known sample used
+	var firstVal float64
+	var firstTime time.Time
+
+	for i := times.len() - 1; i >= 0; i-- {
+		t := times.at(i)
+		if t.IsZero() {
+			continue
+		}
+
+		val := buffer.at(i)
+
+		// A rate starts from the sample at the start of the window, the
+		// others only use the samples after it
+		if t.Before(start) ||
+			(e.fn != "rate" && e.window > 0 && t.Equal(start)) {
+			// Without a window a rate is the change since the previous sample
+			if e.fn == "rate" && e.window == 0 && !math.IsNaN(val) {
+				firstVal, firstTime = val, t
+			}
+			break
+		}
+
+		if math.IsNaN(val) {
+			continue
+		}
+
+		count++
+		sum += val
+		min = math.Min(min, val)
+		max = math.Max(max, val)
+		firstVal, firstTime = val, t
+	}
+
+	if count == 0 {
+		return math.NaN()
+	}
+
+	switch e.fn {
+	case "avg":
+		return sum / float64(count)
+	case "min":
+		return min
+	case "max":
+		return max
+	}
+
+	// Counters only go down when reset
+	lastVal := buffer.last()
+	elapsed := latest.Sub(firstTime).Seconds()
+	if math.IsNaN(lastVal) || elapsed <= 0 || lastVal < firstVal {
+		return math.NaN()
+	}
+
+	return (lastVal - firstVal) / elapsed
+}
+
+// Stats without the repeated ones, in the order they first appear
+func uniqueStats(statsList []string) []string {
+	seen := make(map[string]bool)
+	unique := make([]string, 0, len(statsList))
+	for _, stat := range statsList {
+		if !seen[stat] {
+			seen[stat] = true
+			unique = append(unique, stat)
+		}
+	}
+	return unique
+}
+
+// Stats used by an expression
+func exprStats(e expr) []string {
+
+	switch e := e.(type) {
+	case statExpr:
+		if string(e) != thisStat {
+			return []string{string(e)}
+		}
+	case *windowExpr:
+		if e.stat != thisStat {
+			return []string{e.stat}
+		}
+	case *negExpr:
+		return exprStats(e.operand)
+	case *binaryExpr:
+		return append(exprStats(e.left), exprStats(e.right)...)
+	}
+
+	return nil
+}
+
+// Check whether a glob matches, * matching any characters including the
+// slashes of node addresses
+func matchGlob(glob string, name string) bool {
+	ok, _ := path.Match(
+		strings.ReplaceAll(glob, "/", "\x00"),
+		strings.ReplaceAll(name, "/", "\x00"),
+	)
+	return ok
+}
+
+// Check if the rule is checked for a node
+// The cluster row is only checked by globs naming it, such as cluster* or
+// east/cluster*
+func (r *rule) matchNode(node string) bool {
+	for _, glob := range r.nodes {
+		_, globAddr := widgets.SplitNodeKey(glob)
+		if isClusterNode(node) && !strings.HasPrefix(globAddr, "cluster") {
+			continue
+		}
+		if matchGlob(glob, node) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *rule) matchStat(stat string) bool {
+	for _, glob := range r.stats {
+		if matchGlob(glob, stat) {
+			return true
+		}
+	}
+	return false
+}
+
+// Check the rules against the latest sample of the stats of a node
+func analyzeRules(stats *stats, node string, statsList []string,
+	eventChannel chan *widgets.Event) {
+
+	if len(stats.rules) == 0 {
+		return
+	}
+
+	// Node removed while its chunk was being analysed
+	series := stats.series(node)
+	if series == nil {
+		return
+	}
+
+	type result struct {
+		rule        *rule
+		stat        string
+		holds       bool
+		left, right float64
+	}
+	results := make([]result, 0)
+
+	series.lock.RLock()
+
+	sampleTime := series.times.last()
+	env := &exprEnv{series: series}
+
+	for _, r := range stats.rules {
+		if !r.matchNode(node) {
+			continue
+		}
+
+		// Checked once, the stats it uses are named in the condition
+		if len(r.stats) == 0 {
+			env.stat = ""
+			holds, left, right := r.condition.eval(env)
+			results = append(results, result{r, r.stat, holds, left, right})
+			continue
+		}
+
+		for _, stat := range statsList {
+			if !r.matchStat(stat) {
+				continue
+			}
+			env.stat = stat
+			holds, left, right := r.condition.eval(env)
+			results = append(results, result{r, stat, holds, left, right})
+		}
+	}
+
+	series.lock.RUnlock()
+
+	// Missing samples neither start nor end a condition
+	if sampleTime.IsZero() {
+		return
+	}
+
+	for _, res := range results {
+		if !res.rule.held(ruleKey{node, res.stat}, sampleTime, res.holds) {
+			stats.resolve(
+				alertKey{node, res.stat, "Rule", res.rule.name}, eventChannel,
+			)
+			continue
+		}
+
+		event := widgets.NewEvent(
+			node, res.stat, "Rule", res.left, res.right,
+		)
+		event.Rule = res.rule.name
+		event.Condition = res.rule.condition.source
+		event.Severity = res.rule.severity
+		if len(res.rule.stats) == 0 {
+			event.RuleStats = res.rule.uses
+		}
+		event.Description = makeDescription(event)
+
+		triggerEvent(event, eventChannel, stats)
+	}
+}
+
+// Record whether the condition holds at sampleTime, returning whether it
+// has held for the duration of the rule
+func (r *rule) held(key ruleKey, sampleTime time.Time, holds bool) bool {
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if !holds {
+		delete(r.since, key)
+		return false
+	}
+
+	since, ok := r.since[key]
+	if !ok || sampleTime.Before(since) {
+		since = sampleTime
+		r.since[key] = since
+	}
+
+	return sampleTime.Sub(since) >= r.duration
+}
@@ -0,0 +1,297 @@
+//  Copyright 2023-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included
+//  in the file licenses/BSL-Couchbase.txt.  As of the Change Date specified
+//  in that file, in accordance with the Business Source License, use of this
+//  software will be governed by the Apache License, Version 2.0, included in
+//  the file licenses/APL2.txt.
+
+package main
+
+import (
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/couchbaselabs/chronos/widgets"
+)
+
+// Node with samples of stat1 a second apart, NaN being a missed sample
+func ruleSeries(vals []float64) *nodeSeries {
+
+	interval := time.Second
+	stats := statsInit(&config{
+		stats:    make(map[string]*configStatInfo),
+		interval: &interval,
+	}, []string{"node1"})
+	stats.addStat("stat1")
+
+	series := stats.series("node1")
+	start := time.UnixMilli(1690000000000)
+
+	var timeDiff float64
+	for i, val := range vals {
+		if math.IsNaN(val) {
+			continue
+		}
+		series.store(start.Add(interval*time.Duration(i)),
+			map[string]float64{"stat1": val}, []string{"stat1"},
+			interval, &timeDiff)
+	}
+
+	return series
+}
+
+func TestParseCondition(t *testing.T) {
+
+	series := ruleSeries([]float64{1, 4, 2, math.NaN(), 8, 10})
+
+	tests := []struct {
+		source   string
+		holds    bool
+		left     float64
+		valid    bool
+		checkVal bool
+	}{
+		{"stat1 > 5", true, 10, true, true},
+		{"avg(stat1, 3s) >= 9", true, 9, true, true},
+		{"min($stat, 10s) == 1", true, 1, true, true},
+		{"max(stat1, 1m) - min(stat1, 1m) < 9", false, 9, true, true},
+		{"rate(stat1) > 0", true, 2, true, true},
+		{"rate(stat1, 5s) != 0", true, 1.8, true, true},
+		{"rate(stat1, 2s) > 0", true, 2, true, true},
+		{"avg(missing, 3s) > 0", false, math.NaN(), true, true},
+		{"stat1 + 1", false, 0, false, false},
+		{"avg(stat1 + 1, 3s) > 0", false, 0, false, false},
+		{"avg(stat1, 3) > 0", false, 0, false, false},
+		{"median(stat1) > 0", false, 0, false, false},
+		{"stat1 > ", false, 0, false, false},
+		{"stat1 > 1 2", false, 0, false, false},
+	}
+
+	for i, test := range tests {
+		cond, err := parseCondition(test.source)
+		if (err == nil) != test.valid {
+			t.Errorf("Expected %v got %v %d", test.valid, err, i)
+			continue
+		}
+		if !test.valid {
+			continue
+		}
+
+		env := &exprEnv{series: series, stat: "stat1"}
+		holds, left, _ := cond.eval(env)
+		if holds != test.holds {
+			t.Errorf("Expected %v got %v %d", test.holds, holds, i)
+		}
+		if math.Abs(left-test.left) > 1e-9 && !sameValue(left, test.left) {
+			t.Errorf("Expected %v got %v %d", test.left, left, i)
+		}
+	}
+}
+
+func TestCompileRules(t *testing.T) {
+
+	tests := []struct {
+		spec  *ruleSpec
+		stats []string
+		stat  string
+		valid bool
+	}{
+		{&ruleSpec{Name: "gc", Condition: "avg(pct_cpu_gc, 30s) > 0.2"},
+			nil, "pct_cpu_gc", true},
+		{&ruleSpec{Name: "ratio", Condition: "stat1 > 2 * stat2 + stat1"},
+			nil, "stat1", true},
+		{&ruleSpec{Name: "ram", Condition: "$stat > 1", Stats: []string{"num_*"}},
+			[]string{"num_*"}, "", true},
+		{&ruleSpec{Name: "", Condition: "stat1 > 1"}, nil, "", false},
+		{&ruleSpec{Name: "none", Condition: "$stat > 1"}, nil, "", false},
+		{&ruleSpec{Name: "for", Condition: "stat1 > 1", For: "soon"},
+			nil, "", false},
+		{&ruleSpec{Name: "sev", Condition: "stat1 > 1", Severity: "page"},
+			nil, "", false},
+		{&ruleSpec{Name: "glob", Condition: "stat1 > 1", Nodes: []string{"["}},
+			nil, "", false},
+	}
+
+	for i, test := range tests {
+		rules, err := compileRules([]*ruleSpec{test.spec})
+		if (err == nil) != test.valid {
+			t.Errorf("Expected %v got %v %d", test.valid, err, i)
+			continue
+		}
+		if !test.valid {
+			continue
+		}
+
+		if !reflect.DeepEqual(rules[0].stats, test.stats) ||
+			rules[0].stat != test.stat {
+			t.Errorf("Expected %v %v got %v %v %d", test.stats, test.stat,
+				rules[0].stats, rules[0].stat, i)
+		}
+		if rules[0].severity != "warning" {
+			t.Errorf("Expected %v got %v %d", "warning", rules[0].severity, i)
+		}
+	}
+
+	_, err := compileRules([]*ruleSpec{
+		{Name: "gc", Condition: "stat1 > 1"},
+		{Name: "gc", Condition: "stat1 > 2"},
+	})
+	if err == nil {
+		t.Errorf("Expected %v got %v", "error", err)
+	}
+}
+
+func TestRuleMatch(t *testing.T) {
+
+	r := &rule{
+		nodes: []string{"east/*", "cluster (sum)"},
+		stats: []string{"*:*:doc_count"},
+	}
+
+	tests := []struct {
+		node     string
+		stat     string
+		expected bool
+	}{
+		{"east/http://10.0.0.1:8094", "travel:idx:doc_count", true},
+		{"west/http://10.0.0.1:8094", "travel:idx:doc_count", false},
+		{"cluster (sum)", "travel:idx:doc_count", true},
+		{"east/http://10.0.0.1:8094", "doc_count", false},
+	}
+
+	for i, test := range tests {
+		match := r.matchNode(test.node) && r.matchStat(test.stat)
+		if match != test.expected {
+			t.Errorf("Expected %v got %v %d", test.expected, match, i)
+		}
+	}
+
+	// Every node but the cluster row by default
+	r.nodes = []string{"*"}
+	if r.matchNode("cluster (sum)") {
+		t.Errorf("Expected %v got %v", false, true)
+	}
+}
+
+func TestAnalyzeRules(t *testing.T) {
+
+	interval := time.Second
+	stats := statsInit(&config{
+		stats:    make(map[string]*configStatInfo),
+		interval: &interval,
+	}, []string{"node1"})
+	stats.addStat("stat1")
+
+	rules, err := compileRules([]*ruleSpec{{
+		Name:      "high",
+		Condition: "stat1 > 5",
+		For:       "2s",
+		Severity:  "critical",
+	}})
+	if err != nil {
+		t.Fatalf("Expected %v got %v", nil, err)
+	}
+	stats.rules = rules
+
+	eventChannel := make(chan *widgets.Event, 10)
+	series := stats.series("node1")
+	start := time.UnixMilli(1690000000000)
+
+	// Only fires once the condition held for two seconds, restarting when
+	// it stops holding
+	vals := []float64{6, 7, 1, 6, 7, 8, 9}
+	expected := []int{0, 0, 0, 0, 0, 1, 1}
+
+	var timeDiff float64
+	for i, val := range vals {
+		series.lock.Lock()
+		series.store(start.Add(interval*time.Duration(i)),
+			map[string]float64{"stat1": val}, []string{"stat1"},
+			interval, &timeDiff)
+		series.lock.Unlock()
+
+		analyzeRules(stats, "node1", []string{"stat1"}, eventChannel)
+
+		if len(eventChannel) != expected[i] {
+			t.Errorf("Expected %v got %v %d", expected[i], len(eventChannel), i)
+		}
+
+		if len(eventChannel) > 0 {
+			event := <-eventChannel
+			if event.EventType != "Rule" || event.Rule != "high" ||
+				event.Severity != "critical" || event.ThresholdData != val {
+				t.Errorf("Expected %v got %v %d", "high", event.Description, i)
+			}
+		}
+	}
+}
+
+func TestAnalyzeRulesOnce(t *testing.T) {
+
+	interval := time.Second
+	stats := statsInit(&config{
+		stats:    make(map[string]*configStatInfo),
+		interval: &interval,
+	}, []string{"node1"})
+	stats.addStat("stat1")
+	stats.addStat("stat2")
+
+	rules, err := compileRules([]*ruleSpec{{
+		Name:      "ratio",
+		Condition: "stat1 > 2 * stat2",
+	}})
+	if err != nil {
+		t.Fatalf("Expected %v got %v", nil, err)
+	}
+	stats.rules = rules
+
+	eventChannel := make(chan *widgets.Event, 10)
+	series := stats.series("node1")
+	start := time.UnixMilli(1690000000000)
+	statsList := []string{"stat1", "stat2"}
+
+	var timeDiff float64
+	series.lock.Lock()
+	series.store(start, map[string]float64{"stat1": 5, "stat2": 2},
+		statsList, interval, &timeDiff)
+	series.lock.Unlock()
+
+	analyzeRules(stats, "node1", statsList, eventChannel)
+
+	// One alert for the rule, not one for each stat it uses
+	if len(eventChannel) != 1 {
+		t.Fatalf("Expected %v got %v", 1, len(eventChannel))
+	}
+	event := <-eventChannel
+	if event.Stat != "stat1" || event.Rule != "ratio" ||
+		!strings.HasSuffix(event.Description, "Stats - stat1, stat2") {
+		t.Errorf("Expected %v got %v", "stat1", event.Description)
+	}
+
+	// Shown with the samples of the stat it is kept under
+	shown := createEvent(event, stats, map[string]*int{
+		"ttl": intPointer(3), "dataPadding": intPointer(2),
+	})
+	if shown == nil || len(shown.Data) == 0 || shown.Data[0] != 5 {
+		t.Errorf("Expected %v got %v", 5, shown)
+	}
+
+	series.lock.Lock()
+	series.store(start.Add(interval), map[string]float64{"stat1": 3, "stat2": 2},
+		statsList, interval, &timeDiff)
+	series.lock.Unlock()
+
+	analyzeRules(stats, "node1", statsList, eventChannel)
+
+	if len(eventChannel) != 1 {
+		t.Fatalf("Expected %v got %v", 1, len(eventChannel))
+	}
+	event = <-eventChannel
+	if event.State != widgets.StateResolved {
+		t.Errorf("Expected %v got %v", widgets.StateResolved, event.State)
+	}
+}
@@ -0,0 +1,385 @@
+//  Copyright 2023-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included
+//  in the file licenses/BSL-Couchbase.txt.  As of the Change Date specified
+//  in that file, in accordance with the Business Source License, use of this
+//  software will be governed by the Apache License, Version 2.0, included in
+//  the file licenses/APL2.txt.
+
+package main
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/couchbaselabs/chronos/widgets"
+)
+
+// Fixed capacity buffer of the latest values
+// Pushing a value overwrites the oldest one instead of moving the others
+type ring[T any] struct {
+	vals []T
+
+	// Index of the oldest value
+	start int
+}
+
+// Initializes a ring holding capacity zero values
+func newRing[T any](capacity int) *ring[T] {
+	return &ring[T]{
+		vals: make([]T, capacity),
+	}
+}
+
+// Initializes a ring holding capacity copies of val
+func filledRing[T any](capacity int, val T) *ring[T] {
+	r := newRing[T](capacity)
+	for i := range r.vals {
+		r.vals[i] = val
+	}
+	return r
+}
+
+// Initializes a buffer of capacity samples that are all missing
+func newGapRing(capacity int) *ring[float64] {
+	return filledRing(capacity, math.NaN())
+}
+
+// Initializes a ring holding a copy of vals, oldest first
+func ringOf[T any](vals []T) *ring[T] {
+	r := newRing[T](len(vals))
+	copy(r.vals, vals)
+	return r
+}
+
+// Number of values in the ring
+func (r *ring[T]) len() int {
+	return len(r.vals)
+}
+
+// Value at index i, 0 being the oldest
+func (r *ring[T]) at(i int) T {
+	return r.vals[(r.start+i)%len(r.vals)]
+}
+
+// Newest value in the ring
+func (r *ring[T]) last() T {
+	return r.at(len(r.vals) - 1)
+}
+
+// Add a value, dropping the oldest one
+func (r *ring[T]) push(val T) {
+	if len(r.vals) == 0 {
+		return
+	}
+	r.vals[r.start] = val
+	r.start = (r.start + 1) % len(r.vals)
+}
+
+// Append the values from index i onwards to dst, oldest first
+func (r *ring[T]) appendFrom(dst []T, i int) []T {
+	for ; i < len(r.vals); i++ {
+		dst = append(dst, r.at(i))
+	}
+	return dst
+}
+
+// Copy of all the values, oldest first
+func (r *ring[T]) snapshot() []T {
+	return r.appendFrom(make([]T, 0, len(r.vals)), 0)
+}
+
+// All the data held for one node
+// Each node has its own lock so polls of different nodes never wait
+// on each other
+type nodeSeries struct {
+
+	// Lock for times and buffers
+	lock sync.RWMutex
+
+	// Arrival time of each sample, zero if it is unknown
+	times *ring[time.Time]
+
+	// Values of each stat, one per arrival time, NaN if the sample is
+	// missing
+	buffers map[string]*ring[float64]
+
+	// Rollups of the samples at coarser resolutions, finest first
+	tiers []*tier
+}
+
+// Add a chunk sampled at curTime to the buffers of statsList and to the
+// rollups, returns the number of stream intervals it covers
+// Intervals missed since the previous chunk get a zero time and NaN values
+// so they show as gaps, timeDiff carries the rounding error between chunks
+// Called with the lock of the node held
+func (series *nodeSeries) store(curTime time.Time, vals map[string]float64,
+	statsList []string, interval time.Duration, timeDiff *float64) int {
+
+	slots := 1
+
+	// If this is not the first update for the node
+	if lastTime := series.times.last(); !lastTime.IsZero() {
+
+		// Time passed from the last time stats were updated
+		diffTime := curTime.Sub(lastTime)
+		diffSlots := diffTime.Seconds() / interval.Seconds()
+
+		// Number of stream intervals to update
+		slots = int(math.Round(diffSlots + *timeDiff))
+
+		// Excess time ignored in rounding
+		*timeDiff = diffSlots + *timeDiff - float64(slots)
+	}
+
+	// Mark the missed intervals as gaps
+	// Anything beyond the length of the buffers would be overwritten
+	missing := slots - 1
+	if missing > series.times.len() {
+		missing = series.times.len()
+	}
+	for i := 0; i < missing; i++ {
+		series.times.push(time.Time{})
+		for _, stat := range statsList {
+			if buffer, ok := series.buffers[stat]; ok {
+				buffer.push(math.NaN())
+			}
+		}
+	}
+
+	// Update current time
+	series.times.push(curTime)
+
+	// Update current stat buffers
+	// A stat the chunk does not have is a gap like a missed interval
+	for _, stat := range statsList {
+		if buffer, ok := series.buffers[stat]; ok {
+			val, ok := vals[stat]
+			if !ok {
+				val = math.NaN()
+			}
+			buffer.push(val)
+		}
+	}
+
+	// Roll the chunk up into the coarser resolutions
+	for _, tier := range series.tiers {
+		tier.add(curTime, vals)
+	}
+
+	return slots
+}
+
+// Add empty buffers for a stat to the node if it does not have them
+// Called with the lock of the node held
+func (series *nodeSeries) addStat(stat string) {
+	if _, ok := series.buffers[stat]; !ok {
+		series.buffers[stat] = newGapRing(series.times.len())
+	}
+	for _, tier := range series.tiers {
+		tier.addStat(stat)
+	}
+}
+
+// Empty buffers and rollups for the given stats
+func (stats *stats) newSeries(statsList []string) *nodeSeries {
+
+	series := &nodeSeries{
+		times:   newRing[time.Time](stats.historyLen),
+		buffers: make(map[string]*ring[float64]),
+		tiers:   newTiers(statsList),
+	}
+	for _, stat := range statsList {
+		series.buffers[stat] = newGapRing(stats.historyLen)
+	}
+
+	return series
+}
+
+// Add a node with empty buffers for the given stats
+func (stats *stats) addNode(node string, statsList []string) {
+
+	series := stats.newSeries(statsList)
+
+	stats.nodesLock.Lock()
+	stats.nodes[node] = series
+	stats.nodesLock.Unlock()
+}
+
+// Drop the data of every node and cluster row, keeping their stats
+// Used when a replay goes back, the alerts that are active stay so they
+// are resolved if they no longer hold once the data is fed again
+func (stats *stats) clearData() {
+
+	stats.nodesLock.Lock()
+	for node, series := range stats.nodes {
+		series.lock.RLock()
+		statsList := make([]string, 0, len(series.buffers))
+		for stat := range series.buffers {
+			statsList = append(statsList, stat)
+		}
+		series.lock.RUnlock()
+
+		stats.nodes[node] = stats.newSeries(statsList)
+	}
+	stats.nodesLock.Unlock()
+
+	stats.breachLock.Lock()
+	stats.breaches = nil
+	stats.breachLock.Unlock()
+
+	stats.cluster.lock.Lock()
+	for _, state := range stats.cluster.clusters {
+		state.lock.Lock()
+		state.last = time.Time{}
+		for _, timeDiff := range state.timeDiffs {
+			*timeDiff = 0
+		}
+		state.lock.Unlock()
+	}
+	stats.cluster.lock.Unlock()
+}
+
+// Remove a node along with all its data
+func (stats *stats) removeNode(node string) {
+	stats.nodesLock.Lock()
+	delete(stats.nodes, node)
+	stats.nodesLock.Unlock()
+
+	// Thresholds it was crossing start over if it comes back
+	stats.breachLock.Lock()
+	for key := range stats.breaches {
+		if key.node == node {
+			delete(stats.breaches, key)
+		}
+	}
+	stats.breachLock.Unlock()
+
+	stats.activeLock.Lock()
+	for key := range stats.active {
+		if key.node == node {
+			delete(stats.active, key)
+		}
+	}
+	stats.activeLock.Unlock()
+}
+
+// Data of a node, nil if the node is not monitored
+func (stats *stats) series(node string) *nodeSeries {
+	stats.nodesLock.RLock()
+	defer stats.nodesLock.RUnlock()
+	return stats.nodes[node]
+}
+
+// Time covered by each buffer entry, a second if the interval is not set
+func (stats *stats) sampleInterval() time.Duration {
+	if stats.interval <= 0 {
+		return time.Second
+	}
+	return stats.interval
+}
+
+// Add an empty buffer for the stat to every node that does not have one
+func (stats *stats) addStat(stat string) {
+
+	stats.nodesLock.RLock()
+	defer stats.nodesLock.RUnlock()
+
+	for _, series := range stats.nodes {
+		series.lock.Lock()
+		series.addStat(stat)
+		series.lock.Unlock()
+	}
+}
+
+// Remove the buffer of a stat from a node
+func (stats *stats) removeStat(node string, stat string) {
+
+	series := stats.series(node)
+	if series == nil {
+		return
+	}
+
+	series.lock.Lock()
+	delete(series.buffers, stat)
+	for _, tier := range series.tiers {
+		tier.removeStat(stat)
+	}
+	series.lock.Unlock()
+}
+
+// Stats of a chunk the node does not hold a buffer for
+func (stats *stats) missingStats(node string,
+	incomingStats map[string]float64) []string {
+
+	series := stats.series(node)
+	if series == nil {
+		return nil
+	}
+
+	missing := make([]string, 0)
+
+	series.lock.RLock()
+	for stat := range incomingStats {
+		if _, ok := series.buffers[stat]; !ok {
+			missing = append(missing, stat)
+		}
+	}
+	series.lock.RUnlock()
+
+	return missing
+}
+
+// Copy of the buffer of a stat for a node, nil if there is none
+// Used by the graphs so they never share memory with the polls
+func (stats *stats) snapshot(node string, stat string) []float64 {
+
+	series := stats.series(node)
+	if series == nil {
+		return nil
+	}
+
+	series.lock.RLock()
+	defer series.lock.RUnlock()
+
+	if buffer, ok := series.buffers[stat]; ok {
+		return buffer.snapshot()
+	}
+	return nil
+}
+
+// Copy of the line of a stat for a node at one of the resolutions given
+// by resolutions, nil if there is none
+func (stats *stats) line(node string, stat string, resolution int) []float64 {
+
+	if resolution <= 0 {
+		return stats.snapshot(node, stat)
+	}
+
+	series := stats.series(node)
+	if series == nil || resolution > len(series.tiers) {
+		return nil
+	}
+
+	series.lock.RLock()
+	defer series.lock.RUnlock()
+
+	return series.tiers[resolution-1].maxLine(stat)
+}
+
+// Resolutions the lines of every node are kept at, the raw samples first
+func (stats *stats) resolutions() []widgets.Resolution {
+
+	resolutions := []widgets.Resolution{
+		{Width: stats.interval, Len: stats.historyLen},
+	}
+	for _, tierInfo := range rollupTiers {
+		resolutions = append(resolutions, widgets.Resolution{
+			Width: tierInfo.width,
+			Len:   int(tierInfo.span / tierInfo.width),
+		})
+	}
+
+	return resolutions
+}
@@ -0,0 +1,174 @@
+//  Copyright 2023-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included
+//  in the file licenses/BSL-Couchbase.txt.  As of the Change Date specified
+//  in that file, in accordance with the Business Source License, use of this
+//  software will be governed by the Apache License, Version 2.0, included in
+//  the file licenses/APL2.txt.
+
+package main
+
+import (
+	"math"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRing(t *testing.T) {
+
+	r := newRing[float64](4)
+
+	testCases := []struct {
+		push     []float64
+		expected []float64
+		last     float64
+	}{
+		{
+			expected: []float64{0, 0, 0, 0},
+			last:     0,
+		},
+		{
+			push:     []float64{1, 2},
+			expected: []float64{0, 0, 1, 2},
+			last:     2,
+		},
+		{
+			push:     []float64{3, 4, 5},
+			expected: []float64{2, 3, 4, 5},
+			last:     5,
+		},
+		{
+			push:     []float64{6, 7, 8, 9, 10},
+			expected: []float64{7, 8, 9, 10},
+			last:     10,
+		},
+	}
+
+	for i, testCase := range testCases {
+
+		for _, val := range testCase.push {
+			r.push(val)
+		}
+
+		if snapshot := r.snapshot(); !reflect.DeepEqual(snapshot, testCase.expected) {
+			t.Errorf("Expected %v got %v %d", testCase.expected, snapshot, i)
+		}
+		if r.last() != testCase.last {
+			t.Errorf("Expected %v got %v %d", testCase.last, r.last(), i)
+		}
+	}
+
+	// Reading from an index keeps the order
+	if vals := r.appendFrom([]float64{1}, 2); !reflect.DeepEqual(vals, []float64{1, 9, 10}) {
+		t.Errorf("Expected %v got %v", []float64{1, 9, 10}, vals)
+	}
+
+	// Snapshots do not change with later pushes
+	snapshot := r.snapshot()
+	r.push(11)
+	if !reflect.DeepEqual(snapshot, []float64{7, 8, 9, 10}) {
+		t.Errorf("Expected %v got %v", []float64{7, 8, 9, 10}, snapshot)
+	}
+}
+
+func TestStatsNodes(t *testing.T) {
+
+	stats := statsInit(&config{stats: make(map[string]*configStatInfo)},
+		[]string{"node1", "node2"})
+
+	stats.addStat("stat1")
+	stats.addNode("node3", []string{"stat1"})
+
+	// Polls of different nodes write at the same time as the graphs read
+	var wg sync.WaitGroup
+	for _, node := range []string{"node1", "node2", "node3"} {
+		wg.Add(2)
+
+		go func(node string) {
+			defer wg.Done()
+			series := stats.series(node)
+			for i := 0; i < 1000; i++ {
+				series.lock.Lock()
+				series.buffers["stat1"].push(float64(i))
+				series.lock.Unlock()
+			}
+		}(node)
+
+		go func(node string) {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				stats.snapshot(node, "stat1")
+			}
+		}(node)
+	}
+	wg.Wait()
+
+	for _, node := range []string{"node1", "node2", "node3"} {
+		line := stats.snapshot(node, "stat1")
+		if len(line) != stats.historyLen || line[len(line)-1] != 999 {
+			t.Errorf("Expected %v got %v", 999, line[len(line)-1])
+		}
+	}
+
+	missing := stats.missingStats("node1", map[string]float64{"stat1": 1, "stat2": 2})
+	if !reflect.DeepEqual(missing, []string{"stat2"}) {
+		t.Errorf("Expected %v got %v", []string{"stat2"}, missing)
+	}
+
+	stats.removeStat("node1", "stat1")
+	stats.removeNode("node2")
+
+	if stats.snapshot("node1", "stat1") != nil || stats.series("node2") != nil {
+		t.Errorf("Expected %v got %v %v", nil,
+			stats.snapshot("node1", "stat1"), stats.series("node2"))
+	}
+}
+
+func TestStoreMissingStat(t *testing.T) {
+
+	interval := time.Second
+	stats := statsInit(&config{
+		stats:    make(map[string]*configStatInfo),
+		interval: &interval,
+	}, []string{"node1"})
+	stats.addStat("stat1")
+	stats.addStat("stat2")
+
+	statsList := []string{"stat1", "stat2"}
+	series := stats.series("node1")
+	start := time.UnixMilli(1690000000000)
+
+	// stat2 is left out of the second chunk
+	chunks := []map[string]float64{
+		{"stat1": 1, "stat2": 2},
+		{"stat1": 3},
+	}
+
+	var timeDiff float64
+	for i, chunk := range chunks {
+		series.lock.Lock()
+		series.store(start.Add(interval*time.Duration(i)), chunk, statsList,
+			interval, &timeDiff)
+		series.lock.Unlock()
+	}
+
+	expected := map[string][]float64{
+		"stat1": {1, 3},
+		"stat2": {2, math.NaN()},
+	}
+	for stat, vals := range expected {
+		line := stats.snapshot("node1", stat)[stats.historyLen-2:]
+		for i := range vals {
+			if !sameValue(line[i], vals[i]) {
+				t.Errorf("Expected %v got %v %s", vals[i], line[i], stat)
+			}
+		}
+	}
+}
+
+// Values are the same if they are equal or both missing
+func sameValue(val float64, expected float64) bool {
+	return val == expected || (math.IsNaN(val) && math.IsNaN(expected))
+}
@@ -0,0 +1,307 @@
+//  Copyright 2023-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included
+//  in the file licenses/BSL-Couchbase.txt.  As of the Change Date specified
+//  in that file, in accordance with the Business Source License, use of this
+//  software will be governed by the Apache License, Version 2.0, included in
+//  the file licenses/APL2.txt.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/couchbase/clog"
+	"github.com/couchbaselabs/chronos/widgets"
+)
+
+// Durations a silence goes through each time it is set again, it is lifted
+// after the last one
+var silenceDurations = []time.Duration{
+	15 * time.Minute, time.Hour, 4 * time.Hour, 24 * time.Hour,
+}
+
+// Alerts of a node and stat hidden until a time
+// An empty node or stat matches all of them
+type silence struct {
+	Node  string    `json:"node,omitempty"`
+	Stat  string    `json:"stat,omitempty"`
+	Since time.Time `json:"since"`
+	Until time.Time `json:"until"`
+}
+
+// Silences set from the UI, kept in a state file so they last across
+// restarts
+type silences struct {
+	list []*silence
+
+	// State file, empty to keep the silences in memory only
+	path string
+
+	lock sync.Mutex
+}
+
+// Name of the state file under the data directory
+const silenceFileName = "silences.json"
+
+// State file the silences are kept in, the one given or the one under the
+// data directory, empty to keep them in memory only
+func silencePath(silenceFile string, dataDir string) string {
+	if silenceFile != "" || dataDir == "" {
+		return silenceFile
+	}
+	return filepath.Join(dataDir, silenceFileName)
+}
+
+// Read the silences kept in path, none if the file does not exist yet
+// Silences that ended while chronos was not running are dropped
+func loadSilences(path string, now time.Time) (*silences, error) {
+
+	s := &silences{
+		list: make([]*silence, 0),
+		path: path,
+	}
+
+	if path == "" {
+		return s, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return s, err
+	}
+
+	var list []*silence
+	err = json.Unmarshal(data, &list)
+	if err != nil {
+		return s, fmt.Errorf("%s: %v", path, err)
+	}
+
+	for _, sil := range list {
+		if sil.Until.After(now) {
+			s.list = append(s.list, sil)
+		}
+	}
+
+	return s, nil
+}
+
+// Silence the alerts of node and stat for the next duration, starting over
+// the list of durations if they were not silenced
+// Returns the duration, 0 if the silence was lifted
+func (s *silences) cycle(node string, stat string,
+	now time.Time) (time.Duration, error) {
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.dropEnded(now)
+
+	next := silenceDurations[0]
+
+	for i, sil := range s.list {
+		if sil.Node != node || sil.Stat != stat {
+			continue
+		}
+
+		// Following the duration it was last set to
+		cur := sil.Until.Sub(sil.Since)
+		next = 0
+		for _, duration := range silenceDurations {
+			if duration > cur {
+				next = duration
+				break
+			}
+		}
+
+		s.list = append(s.list[:i], s.list[i+1:]...)
+		break
+	}
+
+	if next > 0 {
+		s.list = append(s.list, &silence{
+			Node: node, Stat: stat, Since: now, Until: now.Add(next),
+		})
+	}
+
+	return next, s.save()
+}
+
+// Check if the alert is silenced at now
+// Safe to call on nil silences
+func (s *silences) silenced(event *widgets.Event, now time.Time) bool {
+
+	if s == nil {
+		return false
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for _, sil := range s.list {
+		if sil.matches(event.Node, event.Stat) && sil.Until.After(now) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Silences still going at now, ending first first
+func (s *silences) active(now time.Time) []silence {
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.dropEnded(now)
+
+	list := make([]silence, 0, len(s.list))
+	for _, sil := range s.list {
+		list = append(list, *sil)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Until.Before(list[j].Until)
+	})
+
+	return list
+}
+
+// Remove the silences that ended by now
+// Called with the lock held
+func (s *silences) dropEnded(now time.Time) {
+	list := s.list[:0]
+	for _, sil := range s.list {
+		if sil.Until.After(now) {
+			list = append(list, sil)
+		}
+	}
+	s.list = list
+}
+
+// Write the silences to the state file, replacing it in one step so it is
+// never left half written
+// Called with the lock held
+func (s *silences) save() error {
+
+	if s.path == "" {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(s.list, "", "    ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), ".silences-*")
+	if err != nil {
+		return err
+	}
+
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Close()
+	} else {
+		tmp.Close()
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	return os.Rename(tmp.Name(), s.path)
+}
+
+// Check if the silence covers the alerts of node and stat
+func (sil *silence) matches(node string, stat string) bool {
+	return (sil.Node == "" || sil.Node == node) &&
+		(sil.Stat == "" || sil.Stat == stat)
+}
+
+// What the silence covers, e.g. "stat1 on node1"
+func (sil *silence) target() string {
+	switch {
+	case sil.Node == "":
+		return sil.Stat + " on every node"
+	case sil.Stat == "":
+		return "every stat of " + sil.Node
+	default:
+		return sil.Stat + " on " + sil.Node
+	}
+}
+
+// Expire the alerts being displayed that a new silence covers
+func silenceEvents(eventDisplay *widgets.EventDisplay, sil *silence) {
+
+	eventDisplay.EventLock.Lock()
+	defer eventDisplay.EventLock.Unlock()
+
+	for _, event := range eventDisplay.Events {
+		if sil.matches(event.Node, event.Stat) {
+			event.SetState(widgets.StateExpired)
+		}
+	}
+}
+
+// Silence the alerts of node and stat from the UI, or move the silence to
+// the next duration, returning the text of the popup to show
+func toggleSilence(silences *silences, eventDisplay *widgets.EventDisplay,
+	node string, stat string) string {
+
+	sil := &silence{Node: node, Stat: stat}
+
+	duration, err := silences.cycle(node, stat, widgets.Now())
+	if err != nil {
+		log.Warnf("silence: unable to save silences to %s: %v",
+			silences.path, err)
+	}
+
+	if duration == 0 {
+		return "Alerts of " + sil.target() + " no longer silenced"
+	}
+
+	silenceEvents(eventDisplay, sil)
+
+	return "Silenced alerts of " + sil.target() + " for " +
+		shortDuration(duration)
+}
+
+// Text of the popup listing the silences
+func silencesText(silences *silences, now time.Time) string {
+
+	list := silences.active(now)
+	if len(list) == 0 {
+		return "No alerts silenced"
+	}
+
+	lines := make([]string, 0, len(list)+1)
+	lines = append(lines, "Silenced alerts")
+	for _, sil := range list {
+		lines = append(lines, fmt.Sprintf(
+			"%s until %s", sil.target(), sil.Until.Format("2006-01-02 15:04"),
+		))
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// Duration without trailing zero units, e.g. 1h instead of 1h0m0s
+func shortDuration(duration time.Duration) string {
+	text := duration.String()
+	if strings.HasSuffix(text, "m0s") {
+		text = strings.TrimSuffix(text, "0s")
+	}
+	if strings.HasSuffix(text, "h0m") {
+		text = strings.TrimSuffix(text, "0m")
+	}
+	return text
+}
@@ -0,0 +1,181 @@
+//  Copyright 2023-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included
+//  in the file licenses/BSL-Couchbase.txt.  As of the Change Date specified
+//  in that file, in accordance with the Business Source License, use of this
+//  software will be governed by the Apache License, Version 2.0, included in
+//  the file licenses/APL2.txt.
+
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/couchbaselabs/chronos/widgets"
+)
+
+func TestSilenceCycle(t *testing.T) {
+
+	path := filepath.Join(t.TempDir(), "silences.json")
+	now := time.UnixMilli(1690000000000)
+
+	silences, err := loadSilences(path, now)
+	if err != nil {
+		t.Fatalf("Expected %v got %v", nil, err)
+	}
+
+	// Each press moves to the next duration until the silence is lifted
+	expected := []time.Duration{
+		15 * time.Minute, time.Hour, 4 * time.Hour, 24 * time.Hour, 0,
+		15 * time.Minute,
+	}
+	for i, duration := range expected {
+		got, err := silences.cycle("node1", "stat1", now)
+		if err != nil {
+			t.Fatalf("Expected %v got %v %d", nil, err, i)
+		}
+		if got != duration {
+			t.Errorf("Expected %v got %v %d", duration, got, i)
+		}
+	}
+
+	_, err = silences.cycle("node2", "", now)
+	if err != nil {
+		t.Fatalf("Expected %v got %v", nil, err)
+	}
+
+	// Kept across restarts until they end
+	tests := []struct {
+		now      time.Time
+		expected int
+	}{
+		{now.Add(time.Minute), 2},
+		{now.Add(time.Hour), 0},
+	}
+
+	for i, test := range tests {
+		loaded, err := loadSilences(path, test.now)
+		if err != nil {
+			t.Fatalf("Expected %v got %v %d", nil, err, i)
+		}
+		if len(loaded.active(test.now)) != test.expected {
+			t.Errorf("Expected %v got %v %d", test.expected,
+				loaded.active(test.now), i)
+		}
+	}
+}
+
+func TestSilenced(t *testing.T) {
+
+	now := time.UnixMilli(1690000000000)
+
+	silenced, _ := loadSilences("", now)
+	silenced.cycle("node1", "stat1", now)
+	silenced.cycle("node2", "", now)
+	silenced.cycle("", "stat3", now)
+
+	tests := []struct {
+		node     string
+		stat     string
+		now      time.Time
+		expected bool
+	}{
+		{"node1", "stat1", now, true},
+		{"node1", "stat2", now, false},
+		{"node2", "stat2", now, true},
+		{"node3", "stat3", now, true},
+		{"node3", "stat1", now, false},
+		// Silences end on their own
+		{"node1", "stat1", now.Add(15 * time.Minute), false},
+	}
+
+	for i, test := range tests {
+		event := widgets.NewEvent(test.node, test.stat, "Above Threshold", 0, 0)
+		if got := silenced.silenced(event, test.now); got != test.expected {
+			t.Errorf("Expected %v got %v %d", test.expected, got, i)
+		}
+	}
+
+	// Nothing is silenced without silences
+	var none *silences
+	if none.silenced(widgets.NewEvent("node1", "stat1", "Rule", 0, 0), now) {
+		t.Errorf("Expected %v got %v", false, true)
+	}
+}
+
+func TestShortDuration(t *testing.T) {
+
+	tests := []struct {
+		duration time.Duration
+		expected string
+	}{
+		{15 * time.Minute, "15m"},
+		{time.Hour, "1h"},
+		{24 * time.Hour, "24h"},
+		{90 * time.Minute, "1h30m"},
+		{30 * time.Second, "30s"},
+	}
+
+	for i, test := range tests {
+		if got := shortDuration(test.duration); got != test.expected {
+			t.Errorf("Expected %v got %v %d", test.expected, got, i)
+		}
+	}
+}
+
+func TestSilencePath(t *testing.T) {
+
+	tests := []struct {
+		silenceFile string
+		dataDir     string
+		expected    string
+	}{
+		{"", "", ""},
+		{"", "/var/chronos", filepath.Join("/var/chronos", "silences.json")},
+		{"/tmp/silences.json", "/var/chronos", "/tmp/silences.json"},
+		{"/tmp/silences.json", "", "/tmp/silences.json"},
+	}
+
+	for i, test := range tests {
+		path := silencePath(test.silenceFile, test.dataDir)
+		if path != test.expected {
+			t.Errorf("Expected %v got %v %d", test.expected, path, i)
+		}
+	}
+}
+
+func TestSilencedReplayClock(t *testing.T) {
+
+	// Alerts of a replay are checked against the recorded times
+	replayTime := time.UnixMilli(1690000000000)
+	nowOri := widgets.Now
+	widgets.Now = func() time.Time { return replayTime }
+	defer func() { widgets.Now = nowOri }()
+
+	silenced, _ := loadSilences("", replayTime)
+	silenced.cycle("node1", "", widgets.Now())
+
+	stats := statsInit(&config{stats: make(map[string]*configStatInfo)},
+		[]string{"node1"})
+	stats.addStat("stat1")
+	stats.addStat("stat2")
+	stats.silences = silenced
+
+	eventChannel := make(chan *widgets.Event)
+	eventDisplay := &widgets.EventDisplay{}
+	alerts := map[string]*int{"ttl": intPointer(3), "dataPadding": intPointer(2)}
+
+	go eventCreateHandler(eventChannel, eventDisplay, stats, alerts)
+
+	// The second send waits for the first event to be handled
+	eventChannel <- widgets.NewEvent("node1", "stat1", "Above Threshold", 1, 0)
+	eventChannel <- widgets.NewEvent("node1", "stat2", "Above Threshold", 1, 0)
+
+	eventDisplay.EventLock.RLock()
+	defer eventDisplay.EventLock.RUnlock()
+	if len(eventDisplay.Events) != 0 {
+		t.Errorf("Expected %v got %v", 0, len(eventDisplay.Events))
+	}
+}
@@ -0,0 +1,469 @@
+//  Copyright 2023-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included
+//  in the file licenses/BSL-Couchbase.txt.  As of the Change Date specified
+//  in that file, in accordance with the Business Source License, use of this
+//  software will be governed by the Apache License, Version 2.0, included in
+//  the file licenses/APL2.txt.
+
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	log "github.com/couchbase/clog"
+	"github.com/couchbaselabs/chronos/widgets"
+)
+
+// Formats a snapshot can be written in
+var snapshotFormats = []string{"json", "csv"}
+
+// Tracks the snapshots being written so shutdown can wait for them
+var snapshotWrites sync.WaitGroup
+
+// Float written as null in JSON when it is not a number
+type jsonFloat float64
+
+func (val jsonFloat) MarshalJSON() ([]byte, error) {
+	if math.IsNaN(float64(val)) || math.IsInf(float64(val), 0) {
+		return []byte("null"), nil
+	}
+	return json.Marshal(float64(val))
+}
+
+// Everything chronos holds at one moment
+type snapshot struct {
+	Time       time.Time                     `json:"time"`
+	Interval   string                        `json:"interval"`
+	Nodes      map[string]*nodeSnapshot      `json:"nodes"`
+	Thresholds map[string]*thresholdSnapshot `json:"thresholds"`
+	Events     []*eventSnapshot              `json:"events"`
+}
+
+// Buffers of a node, the times being null where they are unknown
+type nodeSnapshot struct {
+	Times   []*time.Time           `json:"times"`
+	Stats   map[string][]jsonFloat `json:"stats"`
+	Rollups []*tierSnapshot        `json:"rollups"`
+}
+
+type tierSnapshot struct {
+	Width  string                      `json:"width"`
+	Starts []*time.Time                `json:"starts"`
+	Stats  map[string][]rollupSnapshot `json:"stats"`
+}
+
+type rollupSnapshot struct {
+	Min   jsonFloat `json:"min"`
+	Max   jsonFloat `json:"max"`
+	Avg   jsonFloat `json:"avg"`
+	Last  jsonFloat `json:"last"`
+	Count int       `json:"count"`
+}
+
+type thresholdSnapshot struct {
+	MinVal        jsonFloat `json:"min_val"`
+	MaxVal        jsonFloat `json:"max_val"`
+	MaxChange     jsonFloat `json:"max_change"`
+	MaxChangeTime int       `json:"max_change_time"`
+	MaxDelta      jsonFloat `json:"max_delta"`
+	MaxIncrease   jsonFloat `json:"max_increase"`
+	MaxDecrease   jsonFloat `json:"max_decrease"`
+	MaxRate       jsonFloat `json:"max_rate"`
+	For           int       `json:"for"`
+	MaxClear      jsonFloat `json:"max_clear"`
+	MinClear      jsonFloat `json:"min_clear"`
+	Anomaly       jsonFloat `json:"anomaly"`
+	AnomalyWindow int       `json:"anomaly_window"`
+	Outlier       jsonFloat `json:"outlier"`
+}
+
+type eventSnapshot struct {
+	Node            string       `json:"node"`
+	Stat            string       `json:"stat"`
+	EventType       string       `json:"type"`
+	Rule            string       `json:"rule,omitempty"`
+	Condition       string       `json:"condition,omitempty"`
+	Severity        string       `json:"severity,omitempty"`
+	State           string       `json:"state"`
+	ResolvedAt      *time.Time   `json:"resolved_at"`
+	Description     string       `json:"description"`
+	Threshold       jsonFloat    `json:"threshold"`
+	ThresholdData   jsonFloat    `json:"threshold_data"`
+	ThresholdChange jsonFloat    `json:"threshold_change"`
+	ThresholdTime   jsonFloat    `json:"threshold_time"`
+	Expected        jsonFloat    `json:"expected"`
+	FirstTriggered  time.Time    `json:"first_triggered"`
+	LastTriggered   time.Time    `json:"last_triggered"`
+	NumTimes        int          `json:"num_times"`
+	AlertTimes      []time.Time  `json:"alert_times"`
+	DataTimes       []*time.Time `json:"data_times"`
+	Data            []jsonFloat  `json:"data"`
+}
+
+// Copy everything held by stats and the alerts being displayed
+// Each node is copied under its own lock so its buffers line up
+func takeSnapshot(stats *stats,
+	eventDisplay *widgets.EventDisplay) *snapshot {
+
+	snap := &snapshot{
+		Time:       time.Now(),
+		Interval:   stats.interval.String(),
+		Nodes:      make(map[string]*nodeSnapshot),
+		Thresholds: make(map[string]*thresholdSnapshot),
+		Events:     make([]*eventSnapshot, 0),
+	}
+
+	stats.nodesLock.RLock()
+	nodes := make(map[string]*nodeSeries, len(stats.nodes))
+	for node, series := range stats.nodes {
+		nodes[node] = series
+	}
+	stats.nodesLock.RUnlock()
+
+	for node, series := range nodes {
+		series.lock.RLock()
+
+		nodeSnap := &nodeSnapshot{
+			Times:   snapshotTimes(series.times.snapshot()),
+			Stats:   make(map[string][]jsonFloat),
+			Rollups: make([]*tierSnapshot, 0, len(series.tiers)),
+		}
+		for stat, buffer := range series.buffers {
+			nodeSnap.Stats[stat] = snapshotFloats(buffer.snapshot())
+		}
+
+		for _, tier := range series.tiers {
+			tierSnap := &tierSnapshot{
+				Width:  tier.width.String(),
+				Starts: snapshotTimes(tier.times.snapshot()),
+				Stats:  make(map[string][]rollupSnapshot),
+			}
+			for stat, buffer := range tier.buffers {
+				buckets := make([]rollupSnapshot, 0, buffer.len())
+				for _, bucket := range buffer.snapshot() {
+					buckets = append(buckets, rollupSnapshot{
+						Min:   jsonFloat(bucket.Min),
+						Max:   jsonFloat(bucket.Max),
+						Avg:   jsonFloat(bucket.Avg),
+						Last:  jsonFloat(bucket.Last),
+						Count: bucket.Count,
+					})
+				}
+				tierSnap.Stats[stat] = buckets
+			}
+			nodeSnap.Rollups = append(nodeSnap.Rollups, tierSnap)
+		}
+
+		series.lock.RUnlock()
+
+		snap.Nodes[node] = nodeSnap
+	}
+
+	stats.statInfoLock.RLock()
+	for stat, statInfo := range stats.statInfo {
+		snap.Thresholds[stat] = &thresholdSnapshot{
+			MinVal:        jsonFloat(statInfo.MinVal),
+			MaxVal:        jsonFloat(statInfo.MaxVal),
+			MaxChange:     jsonFloat(statInfo.MaxChange),
+			MaxChangeTime: statInfo.MaxChangeTime,
+			MaxDelta:      jsonFloat(statInfo.MaxDelta),
+			MaxIncrease:   jsonFloat(statInfo.MaxIncrease),
+			MaxDecrease:   jsonFloat(statInfo.MaxDecrease),
+			MaxRate:       jsonFloat(statInfo.MaxRate),
+			For:           statInfo.For,
+			MaxClear:      jsonFloat(statInfo.MaxClear),
+			MinClear:      jsonFloat(statInfo.MinClear),
+			Anomaly:       jsonFloat(statInfo.Anomaly),
+			AnomalyWindow: statInfo.AnomalyWindow,
+			Outlier:       jsonFloat(statInfo.Outlier),
+		}
+	}
+	stats.statInfoLock.RUnlock()
+
+	eventDisplay.EventLock.RLock()
+	events := make([]*widgets.Event, 0, len(eventDisplay.Events))
+	for _, event := range eventDisplay.Events {
+		events = append(events, widgets.CopyEvent(event))
+	}
+	eventDisplay.EventLock.RUnlock()
+
+	for _, event := range events {
+		snap.Events = append(snap.Events, &eventSnapshot{
+			Node:            event.Node,
+			Stat:            event.Stat,
+			EventType:       event.EventType,
+			Rule:            event.Rule,
+			Condition:       event.Condition,
+			Severity:        event.Severity,
+			State:           event.CurState(),
+			ResolvedAt:      snapshotTimes([]time.Time{event.ResolvedAt})[0],
+			Description:     event.Description,
+			Threshold:       jsonFloat(event.Threshold),
+			ThresholdData:   jsonFloat(event.ThresholdData),
+			ThresholdChange: jsonFloat(event.ThresholdChange),
+			ThresholdTime:   jsonFloat(event.ChangeWindow.Seconds()),
+			Expected:        jsonFloat(event.Expected),
+			FirstTriggered:  event.FirstTriggered,
+			LastTriggered:   event.LastTriggered,
+			NumTimes:        event.NumTimes,
+			AlertTimes:      event.AlertTimes,
+			DataTimes:       snapshotTimes(event.DataTimes),
+			Data:            snapshotFloats(event.Data),
+		})
+	}
+
+	return snap
+}
+
+// Times with the unknown ones as nil
+func snapshotTimes(times []time.Time) []*time.Time {
+	snapTimes := make([]*time.Time, len(times))
+	for i := range times {
+		if !times[i].IsZero() {
+			snapTimes[i] = &times[i]
+		}
+	}
+	return snapTimes
+}
+
+func snapshotFloats(vals []float64) []jsonFloat {
+	snapVals := make([]jsonFloat, len(vals))
+	for i, val := range vals {
+		snapVals[i] = jsonFloat(val)
+	}
+	return snapVals
+}
+
+// Path the snapshot is written to, a file for json and a directory of
+// files for csv
+func snapshotPath(dir string, format string, snapTime time.Time) string {
+
+	name := "chronos-snapshot-" + snapTime.Format("2006-01-02T15-04-05")
+	if format == "json" {
+		name += ".json"
+	}
+
+	return filepath.Join(dir, name)
+}
+
+// Take a snapshot and write it in the background, returns the path
+// it is written to
+func exportSnapshot(stats *stats, eventDisplay *widgets.EventDisplay,
+	dir string, format string) string {
+
+	snap := takeSnapshot(stats, eventDisplay)
+	path := snapshotPath(dir, format, snap.Time)
+
+	snapshotWrites.Add(1)
+	go func() {
+		defer snapshotWrites.Done()
+
+		var err error
+		if format == "csv" {
+			err = writeSnapshotCSV(snap, path)
+		} else {
+			err = writeSnapshotJSON(snap, path)
+		}
+
+		if err != nil {
+			log.Warnf("snapshot: unable to write %s: %v", path, err)
+		} else {
+			log.Printf("snapshot: wrote %s", path)
+		}
+	}()
+
+	return path
+}
+
+func writeSnapshotJSON(snap *snapshot, path string) error {
+
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(file)
+	enc.SetIndent("", " ")
+
+	err = enc.Encode(snap)
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	return file.Close()
+}
+
+// Write the snapshot as a directory of csv files, one per kind of data
+func writeSnapshotCSV(snap *snapshot, dir string) error {
+
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return err
+	}
+
+	nodes := sortedKeys(snap.Nodes)
+
+	err = writeCSV(filepath.Join(dir, "samples.csv"),
+		[]string{"node", "stat", "time", "value"},
+		func(write func(...string)) {
+			for _, node := range nodes {
+				nodeSnap := snap.Nodes[node]
+				for _, stat := range sortedKeys(nodeSnap.Stats) {
+					for i, val := range nodeSnap.Stats[stat] {
+						write(node, stat, csvTime(nodeSnap.Times[i]), csvFloat(val))
+					}
+				}
+			}
+		})
+	if err != nil {
+		return err
+	}
+
+	err = writeCSV(filepath.Join(dir, "rollups.csv"),
+		[]string{"node", "width", "stat", "start",
+			"min", "max", "avg", "last", "count"},
+		func(write func(...string)) {
+			for _, node := range nodes {
+				for _, tierSnap := range snap.Nodes[node].Rollups {
+					for _, stat := range sortedKeys(tierSnap.Stats) {
+						for i, bucket := range tierSnap.Stats[stat] {
+							write(node, tierSnap.Width, stat,
+								csvTime(tierSnap.Starts[i]),
+								csvFloat(bucket.Min), csvFloat(bucket.Max),
+								csvFloat(bucket.Avg), csvFloat(bucket.Last),
+								strconv.Itoa(bucket.Count))
+						}
+					}
+				}
+			}
+		})
+	if err != nil {
+		return err
+	}
+
+	err = writeCSV(filepath.Join(dir, "thresholds.csv"),
+		[]string{"stat", "min_val", "max_val", "max_change", "max_change_time",
+			"max_delta", "max_increase", "max_decrease", "max_rate", "for", "max_clear", "min_clear", "anomaly", "anomaly_window",
+			"outlier"},
+		func(write func(...string)) {
+			for _, stat := range sortedKeys(snap.Thresholds) {
+				threshold := snap.Thresholds[stat]
+				write(stat, csvFloat(threshold.MinVal),
+					csvFloat(threshold.MaxVal), csvFloat(threshold.MaxChange),
+					strconv.Itoa(threshold.MaxChangeTime),
+					csvFloat(threshold.MaxDelta), csvFloat(threshold.MaxIncrease),
+					csvFloat(threshold.MaxDecrease), csvFloat(threshold.MaxRate),
+					strconv.Itoa(threshold.For), csvFloat(threshold.MaxClear),
+					csvFloat(threshold.MinClear), csvFloat(threshold.Anomaly),
+					strconv.Itoa(threshold.AnomalyWindow),
+					csvFloat(threshold.Outlier))
+			}
+		})
+	if err != nil {
+		return err
+	}
+
+	err = writeCSV(filepath.Join(dir, "events.csv"),
+		[]string{"event", "node", "stat", "type", "rule", "severity",
+			"state", "resolved_at", "threshold", "threshold_data", "threshold_change", "threshold_time",
+			"expected",
+			"first_triggered", "last_triggered", "num_times", "description"},
+		func(write func(...string)) {
+			for i, event := range snap.Events {
+				write(strconv.Itoa(i), event.Node, event.Stat, event.EventType,
+					event.Rule, event.Severity, event.State,
+					csvTime(event.ResolvedAt),
+					csvFloat(event.Threshold), csvFloat(event.ThresholdData),
+					csvFloat(event.ThresholdChange),
+					csvFloat(event.ThresholdTime),
+					csvFloat(event.Expected),
+					csvTime(&event.FirstTriggered),
+					csvTime(&event.LastTriggered),
+					strconv.Itoa(event.NumTimes), event.Description)
+			}
+		})
+	if err != nil {
+		return err
+	}
+
+	return writeCSV(filepath.Join(dir, "event_data.csv"),
+		[]string{"event", "time", "value"},
+		func(write func(...string)) {
+			for i, event := range snap.Events {
+				for j, val := range event.Data {
+					write(strconv.Itoa(i), csvTime(event.DataTimes[j]), csvFloat(val))
+				}
+			}
+		})
+}
+
+// Write a csv file with the header followed by the rows given by rows
+func writeCSV(path string, header []string,
+	rows func(write func(...string))) error {
+
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	w := csv.NewWriter(file)
+	w.Write(header)
+	rows(func(record ...string) {
+		w.Write(record)
+	})
+	w.Flush()
+
+	if err := w.Error(); err != nil {
+		file.Close()
+		return err
+	}
+
+	return file.Close()
+}
+
+// Values that are not numbers and unknown times are left empty in csv
+func csvFloat(val jsonFloat) string {
+	if math.IsNaN(float64(val)) || math.IsInf(float64(val), 0) {
+		return ""
+	}
+	return strconv.FormatFloat(float64(val), 'g', -1, 64)
+}
+
+func csvTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.Format(time.RFC3339Nano)
+}
+
+// Keys of a map in order, so snapshots of the same data are identical
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Check the format given to -snapshot_format
+func checkSnapshotFormat(format string) error {
+	for _, valid := range snapshotFormats {
+		if format == valid {
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid snapshot format %q, use one of %v",
+		format, snapshotFormats)
+}
@@ -0,0 +1,20 @@
+//  Copyright 2023-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included
+//  in the file licenses/BSL-Couchbase.txt.  As of the Change Date specified
+//  in that file, in accordance with the Business Source License, use of this
+//  software will be governed by the Apache License, Version 2.0, included in
+//  the file licenses/APL2.txt.
+
+//go:build windows
+
+package main
+
+import (
+	"os"
+)
+
+// Windows has no SIGUSR1, snapshots are only taken from the UI
+func snapshotSignals() <-chan os.Signal {
+	return nil
+}
@@ -0,0 +1,159 @@
+//  Copyright 2023-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included
+//  in the file licenses/BSL-Couchbase.txt.  As of the Change Date specified
+//  in that file, in accordance with the Business Source License, use of this
+//  software will be governed by the Apache License, Version 2.0, included in
+//  the file licenses/APL2.txt.
+
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/couchbaselabs/chronos/widgets"
+)
+
+func snapshotTestData() (*stats, *widgets.EventDisplay, time.Time) {
+
+	stats := statsInit(&config{stats: map[string]*configStatInfo{
+		"stat1": {MinVal: math.NaN(), MaxVal: 10, MaxChange: math.NaN()},
+	}}, []string{"node1"})
+
+	start := time.Now().Truncate(time.Second)
+	timeDiff := new(float64)
+	series := stats.series("node1")
+	series.addStat("stat1")
+	series.store(start, map[string]float64{"stat1": 1},
+		[]string{"stat1"}, stats.interval, timeDiff)
+	series.store(start.Add(stats.interval), map[string]float64{"stat1": math.Inf(1)},
+		[]string{"stat1"}, stats.interval, timeDiff)
+
+	eventDisplay := widgets.NewEventDisplay()
+	eventDisplay.Events = append(eventDisplay.Events, &widgets.Event{
+		Node:      "node1",
+		Stat:      "stat1",
+		EventType: "Max Value",
+		NumTimes:  1,
+		Data:      []float64{1, 12},
+		DataTimes: []time.Time{{}, start},
+	})
+
+	return stats, eventDisplay, start
+}
+
+func TestSnapshotJSON(t *testing.T) {
+
+	stats, eventDisplay, start := snapshotTestData()
+
+	snap := takeSnapshot(stats, eventDisplay)
+	path := snapshotPath(t.TempDir(), "json", snap.Time)
+	err := writeSnapshotJSON(snap, path)
+	if err != nil {
+		t.Fatalf("Unable to write snapshot %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Unable to read snapshot %v", err)
+	}
+
+	var read struct {
+		Nodes map[string]struct {
+			Times []*time.Time          `json:"times"`
+			Stats map[string][]*float64 `json:"stats"`
+		} `json:"nodes"`
+		Thresholds map[string]map[string]*float64 `json:"thresholds"`
+		Events     []struct {
+			Stat      string       `json:"stat"`
+			DataTimes []*time.Time `json:"data_times"`
+		} `json:"events"`
+	}
+	err = json.Unmarshal(data, &read)
+	if err != nil {
+		t.Fatalf("Unable to parse snapshot %v", err)
+	}
+
+	vals := read.Nodes["node1"].Stats["stat1"]
+	times := read.Nodes["node1"].Times
+	if len(vals) != stats.historyLen || len(times) != stats.historyLen {
+		t.Fatalf("Expected %v got %v %d", stats.historyLen, len(vals), len(times))
+	}
+	if vals[len(vals)-1] != nil || *vals[len(vals)-2] != 1 {
+		t.Errorf("Expected %v got %v %v", "[1 null]",
+			vals[len(vals)-2], vals[len(vals)-1])
+	}
+	if times[0] != nil || !times[len(times)-2].Equal(start) {
+		t.Errorf("Expected %v got %v %v", start, times[0], times[len(times)-2])
+	}
+
+	threshold := read.Thresholds["stat1"]
+	if threshold["min_val"] != nil || *threshold["max_val"] != 10 {
+		t.Errorf("Expected %v got %v %v", 10, threshold["min_val"],
+			threshold["max_val"])
+	}
+
+	if len(read.Events) != 1 || read.Events[0].Stat != "stat1" ||
+		read.Events[0].DataTimes[0] != nil {
+		t.Errorf("Expected %v got %v %d", "stat1", read.Events, len(read.Events))
+	}
+}
+
+func TestSnapshotCSV(t *testing.T) {
+
+	stats, eventDisplay, start := snapshotTestData()
+
+	snap := takeSnapshot(stats, eventDisplay)
+	dir := snapshotPath(t.TempDir(), "csv", snap.Time)
+	err := writeSnapshotCSV(snap, dir)
+	if err != nil {
+		t.Fatalf("Unable to write snapshot %v", err)
+	}
+
+	tests := []struct {
+		file string
+		rows int
+		last []string
+	}{
+		{"samples.csv", stats.historyLen + 1,
+			[]string{"node1", "stat1", start.Add(stats.interval).Format(time.RFC3339Nano), ""}},
+		{"thresholds.csv", 2, []string{"stat1", "", "10", "", "0"}},
+		{"event_data.csv", 3, []string{"0", start.Format(time.RFC3339Nano), "12"}},
+	}
+
+	for _, test := range tests {
+		file, err := os.Open(filepath.Join(dir, test.file))
+		if err != nil {
+			t.Fatalf("Unable to open %s %v", test.file, err)
+		}
+		records, err := csv.NewReader(file).ReadAll()
+		file.Close()
+		if err != nil {
+			t.Fatalf("Unable to read %s %v", test.file, err)
+		}
+
+		if len(records) != test.rows {
+			t.Errorf("Expected %v got %v %s", test.rows, len(records), test.file)
+			continue
+		}
+		last := records[len(records)-1]
+		for i := range test.last {
+			if last[i] != test.last[i] {
+				t.Errorf("Expected %v got %v %s", test.last, last, test.file)
+				break
+			}
+		}
+	}
+
+	for _, file := range []string{"rollups.csv", "events.csv"} {
+		if _, err := os.Stat(filepath.Join(dir, file)); err != nil {
+			t.Errorf("Expected %v got %v", file, err)
+		}
+	}
+}
@@ -0,0 +1,276 @@
+//  Copyright 2023-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included
+//  in the file licenses/BSL-Couchbase.txt.  As of the Change Date specified
+//  in that file, in accordance with the Business Source License, use of this
+//  software will be governed by the Apache License, Version 2.0, included in
+//  the file licenses/APL2.txt.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	log "github.com/couchbase/clog"
+)
+
+// Source of chunks of stats for a single node
+type StatSource interface {
+	// Connect to the node
+	// Fails with errNotSupported if the node does not serve the endpoint
+	Open(ctx context.Context) error
+
+	// Block until the next chunk is available
+	Next() (*message, error)
+
+	// Release the connection to the node
+	Close() error
+}
+
+// Returned when a node does not serve the endpoint of a source
+var errNotSupported = errors.New("endpoint not supported by the node")
+
+// Kinds of sources in the order they are tried
+const (
+	sourceStream  = "stream"
+	sourceNsStats = "nsstats"
+	sourceStats   = "stats"
+)
+
+var sourceKinds = []string{sourceStream, sourceNsStats, sourceStats}
+
+// Create a source of the given kind for the node of a poll
+func newStatSource(kind string, params *updateStatsParams) StatSource {
+
+	switch kind {
+	case sourceNsStats:
+		return &pollSource{
+			url:      params.nodeURL + "/api/nsstats",
+			creds:    params.creds,
+			client:   params.client,
+			interval: params.stats.interval,
+		}
+	case sourceStats:
+		return &pollSource{
+			url:      params.nodeURL + "/api/stats",
+			creds:    params.creds,
+			client:   params.client,
+			interval: params.stats.interval,
+		}
+	default:
+		return &streamSource{
+			url:    params.nodeURL + "/api/statsStream",
+			creds:  params.creds,
+			client: params.client,
+		}
+	}
+}
+
+// Open the first source the node supports
+// The kind found is kept in the params so reconnects skip the detection
+func openStatSource(params *updateStatsParams) (StatSource, error) {
+
+	kinds := sourceKinds
+	if params.sourceKind != "" {
+		kinds = []string{params.sourceKind}
+	}
+
+	for _, kind := range kinds {
+		source := newStatSource(kind, params)
+		if params.prometheus != nil {
+			source = newPrometheusSource(source, params)
+		}
+
+		err := source.Open(params.ctx)
+		if err == errNotSupported {
+			log.Printf("source: %s does not support the %s source",
+				params.nodeName, kind)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if params.sourceKind != kind {
+			log.Printf("source: Using the %s source for %s",
+				kind, params.nodeName)
+			params.sourceKind = kind
+		}
+
+		return source, nil
+	}
+
+	// Detect again on the next attempt in case the node was upgraded
+	params.sourceKind = ""
+
+	return nil, fmt.Errorf("no supported stats endpoint on %s", params.nodeName)
+}
+
+// Make an authorized request for one of the stats endpoints
+// The body of the response is left open only if the status is OK
+func statsRequest(ctx context.Context, client *http.Client,
+	creds *credentials, url string) (*http.Response, error) {
+
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create request for %s: %v", url, err)
+	}
+
+	creds.authorize(req)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("invalid http response from %s: %v", url, err)
+	}
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return resp, nil
+	case http.StatusNotFound:
+		resp.Body.Close()
+		return nil, errNotSupported
+	default:
+		resp.Body.Close()
+		return nil, fmt.Errorf("status code is not OK from %s: %s",
+			url, resp.Status)
+	}
+}
+
+// Reads chunks from /api/statsStream as the node sends them
+type streamSource struct {
+	url    string
+	creds  *credentials
+	client *http.Client
+
+	resp *http.Response
+	dec  *json.Decoder
+}
+
+func (source *streamSource) Open(ctx context.Context) error {
+
+	resp, err := statsRequest(ctx, source.client, source.creds, source.url)
+	if err != nil {
+		return err
+	}
+
+	source.resp = resp
+	source.dec = json.NewDecoder(resp.Body)
+
+	return nil
+}
+
+func (source *streamSource) Next() (*message, error) {
+
+	var m message
+	err := source.dec.Decode(&m)
+	if err != nil {
+		return nil, err
+	}
+
+	return &m, nil
+}
+
+func (source *streamSource) Close() error {
+	return source.resp.Body.Close()
+}
+
+// Requests a snapshot of the stats every interval from an endpoint
+// returning them as JSON, for nodes without the streaming endpoint
+type pollSource struct {
+	url      string
+	creds    *credentials
+	client   *http.Client
+	interval time.Duration
+
+	ctx    context.Context
+	ticker *time.Ticker
+
+	// Chunk fetched while opening, returned by the first call to Next
+	pending *message
+}
+
+func (source *pollSource) Open(ctx context.Context) error {
+
+	source.ctx = ctx
+
+	m, err := source.fetch()
+	if err != nil {
+		return err
+	}
+
+	source.pending = m
+	source.ticker = time.NewTicker(source.interval)
+
+	return nil
+}
+
+func (source *pollSource) Next() (*message, error) {
+
+	if source.pending != nil {
+		m := source.pending
+		source.pending = nil
+		return m, nil
+	}
+
+	select {
+	case <-source.ctx.Done():
+		return nil, source.ctx.Err()
+	case <-source.ticker.C:
+	}
+
+	return source.fetch()
+}
+
+func (source *pollSource) Close() error {
+	source.ticker.Stop()
+	return nil
+}
+
+// Request a single snapshot of the stats
+func (source *pollSource) fetch() (*message, error) {
+
+	resp, err := statsRequest(source.ctx, source.client, source.creds, source.url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var respMsg map[string]interface{}
+	err = json.NewDecoder(resp.Body).Decode(&respMsg)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &message{
+		Stats: make(map[string]float64),
+	}
+	flattenStats("", respMsg, m.Stats)
+
+	return m, nil
+}
+
+// Collect the numeric values of a JSON object into stats
+// Nested objects are joined with ":" like the stat names of the stream,
+// eg. bucket:index:stat
+func flattenStats(prefix string, obj map[string]interface{},
+	stats map[string]float64) {
+
+	for key, val := range obj {
+		name := key
+		if prefix != "" {
+			name = prefix + ":" + key
+		}
+
+		switch val := val.(type) {
+		case float64:
+			stats[name] = val
+		case map[string]interface{}:
+			flattenStats(name, val, stats)
+		}
+	}
+}
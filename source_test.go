@@ -0,0 +1,112 @@
+//  Copyright 2023-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included
+//  in the file licenses/BSL-Couchbase.txt.  As of the Change Date specified
+//  in that file, in accordance with the Business Source License, use of this
+//  software will be governed by the Apache License, Version 2.0, included in
+//  the file licenses/APL2.txt.
+
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/couchbaselabs/chronos/fakenode"
+)
+
+func TestOpenStatSource(t *testing.T) {
+
+	interval := time.Millisecond * time.Duration(10)
+
+	stream, err := fakenode.NewNode(&fakenode.Scenario{
+		Interval: interval,
+		Stats:    map[string]fakenode.Series{"stat1": fakenode.Constant(1)},
+	}, "127.0.0.1:0", "user", "pass")
+	if err != nil {
+		t.Fatalf("Unable to start node %v", err)
+	}
+	defer stream.Close()
+
+	legacy, err := fakenode.NewNode(&fakenode.Scenario{
+		Interval: interval,
+		Stats:    map[string]fakenode.Series{"stat1": fakenode.Constant(2)},
+		NoStream: true,
+	}, "127.0.0.1:0", "user", "pass")
+	if err != nil {
+		t.Fatalf("Unable to start node %v", err)
+	}
+	defer legacy.Close()
+
+	// Node only serving the nested /api/stats
+	nested := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, req *http.Request) {
+			if req.URL.Path != "/api/stats" {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Write([]byte(`{"travel":{"idx1":{"doc_count":3}},"status":"ok"}`))
+		},
+	))
+	defer nested.Close()
+
+	unsupported := httptest.NewServer(http.NotFoundHandler())
+	defer unsupported.Close()
+
+	testCases := []struct {
+		node string
+		kind string
+		stat string
+		val  float64
+		err  bool
+	}{
+		{stream.URL(), sourceStream, "stat1", 1, false},
+		{legacy.URL(), sourceNsStats, "stat1", 2, false},
+		{nested.URL, sourceStats, "travel:idx1:doc_count", 3, false},
+		{unsupported.URL, "", "", 0, true},
+	}
+
+	for i, testCase := range testCases {
+
+		stats := statsInit(&config{
+			stats:    make(map[string]*configStatInfo),
+			interval: &interval,
+		}, []string{testCase.node})
+
+		params := newUpdateStatsParams(
+			&credentials{username: "user", password: "pass"}, stats,
+			testCase.node, nil, nil, nil, nil, context.Background(),
+			httpClientInit(nil),
+		)
+
+		source, err := openStatSource(params)
+		if (err != nil) != testCase.err {
+			t.Errorf("Expected error %v got %v %d", testCase.err, err, i)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+
+		if params.sourceKind != testCase.kind {
+			t.Errorf("Expected %v got %v %d", testCase.kind, params.sourceKind, i)
+		}
+
+		// Read a couple of chunks to cover the wait between polls
+		for j := 0; j < 2; j++ {
+			m, err := source.Next()
+			if err != nil {
+				t.Errorf("Unable to read chunk %v %d", err, i)
+				break
+			}
+			if m.Stats[testCase.stat] != testCase.val {
+				t.Errorf("Expected %v got %v %d", testCase.val, m.Stats, i)
+			}
+		}
+
+		source.Close()
+	}
+}
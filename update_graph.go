@@ -19,26 +19,28 @@ func updateGraph(statName string, stats *stats, nodesList []string,
 
 	lineChart.Stat = statName
 
-	stats.bufferLock.RLock()
+	// Lines are copied at the resolution that fits the zoom of the graph
+	resolution := lineChart.Resolution()
+
 	for _, nodeData := range lineChart.Nodes {
-		nodeData.Line = stats.statBuffers[nodeData.Node][statName]
+		nodeData.Line = stats.line(nodeData.Node, statName, resolution)
 		nodeData.Active = true
 	}
-	stats.bufferLock.RUnlock()
 }
 
 // Handle changes in nodes selected
 func updateUI(stats *stats, lineChart *widgets.LineGraph) {
 
-	stats.bufferLock.RLock()
 	if lineChart.Stat != "" {
+		resolution := lineChart.Resolution()
 		for _, nodeData := range lineChart.Nodes {
 			if nodeData.Active {
-				nodeData.Line = stats.statBuffers[nodeData.Node][lineChart.Stat]
+				nodeData.Line = stats.line(
+					nodeData.Node, lineChart.Stat, resolution,
+				)
 			} else {
-				nodeData.Line = make([]float64, 300)
+				nodeData.Line = make([]float64, stats.historyLen)
 			}
 		}
 	}
-	stats.bufferLock.RUnlock()
 }
@@ -9,8 +9,7 @@
 package main
 
 import (
-	"encoding/json"
-	"fmt"
+	"context"
 	"io"
 	"math"
 	"net/http"
@@ -26,20 +25,50 @@ import (
 type message struct {
 	Stats               map[string]float64 `json:"stats,omitempty"`
 	RebalanceInProgress bool               `json:"rebalance,omitempty"`
+
+	// Time the sample was taken on the server in milliseconds since epoch
+	// Optional, the arrival time is used if not set
+	Timestamp int64 `json:"timestamp,omitempty"`
 }
 
 // Parameters used by each polling routine
 type updateStatsParams struct {
-	username      string
-	password      string
+	creds         *credentials
 	stats         *stats
 	nodeName      string
 	errChannel    chan *errorMsg
 	eventChannel  chan *widgets.Event
 	popupChannel  chan string
 	updateChannel chan updateMessage
-	killSwitch    chan bool
 	timeDiff      float64
+
+	// Address of the node, nodeName also carries the cluster when
+	// monitoring more than one
+	nodeURL string
+
+	// Cancelled when the node leaves the cluster or chronos shuts down
+	ctx context.Context
+
+	// Client shared by all the polls
+	client *http.Client
+
+	// Kind of StatSource the node supports, empty until detected
+	sourceKind string
+
+	// Prometheus endpoint scraped along with the source, nil if not scraping
+	prometheus *prometheusConfig
+
+	// Writes incoming chunks to a file, nil if not recording
+	recorder *recorder
+
+	// Keeps the stored chunks in the data directory, nil if not kept
+	persister *persister
+
+	// Set when chunks come from a recording instead of the node
+	replaying bool
+
+	// Previous values of the rates of the derived stats for the node
+	rates map[*rateExpr]rateSample
 }
 
 // Errors encountered sent to the main routine
@@ -52,22 +81,49 @@ type errorMsg struct {
 }
 
 // Function to consolidate all the input parameters into a struct
-func newUpdateStatsParams(username string, password string, stats *stats,
+func newUpdateStatsParams(creds *credentials, stats *stats,
 	node string, errChannel chan *errorMsg, eventChannel chan *widgets.Event,
 	popupChannel chan string, updateChannel chan updateMessage,
-	killSwitch chan bool) *updateStatsParams {
+	ctx context.Context, client *http.Client) *updateStatsParams {
 
 	return &updateStatsParams{
-		username:      username,
-		password:      password,
+		creds:         creds,
 		stats:         stats,
 		nodeName:      node,
+		nodeURL:       node,
 		errChannel:    errChannel,
 		eventChannel:  eventChannel,
 		popupChannel:  popupChannel,
 		updateChannel: updateChannel,
-		killSwitch:    killSwitch,
+		ctx:           ctx,
 		timeDiff:      0,
+		client:        client,
+		rates:         make(map[*rateExpr]rateSample),
+	}
+}
+
+// Send an error to the main routine unless the poll is stopped first
+func (params *updateStatsParams) sendError(msg *errorMsg) {
+	select {
+	case params.errChannel <- msg:
+	case <-params.ctx.Done():
+	}
+}
+
+// Send a popup message to the main routine unless the poll is stopped first
+func (params *updateStatsParams) sendPopup(msg string) {
+	select {
+	case params.popupChannel <- msg:
+	case <-params.ctx.Done():
+	}
+}
+
+// Send a node or stat change to the main routine unless the poll is
+// stopped first
+func (params *updateStatsParams) sendUpdate(msg updateMessage) {
+	select {
+	case params.updateChannel <- msg:
+	case <-params.ctx.Done():
 	}
 }
 
@@ -81,214 +137,218 @@ func newErrorMsg(name error, description string, terminate bool) *errorMsg {
 	}
 }
 
-// Polling stats from a node every second and updating to stats struct
+// Reading stats from a node as they arrive and updating to stats struct
 func updateStats(params *updateStatsParams) int {
 
 	log.Printf("Started %v", params.nodeName)
-	url := params.nodeName + "/api/statsStream"
 
-	// Making the http request
-	req, err := http.NewRequest("GET", url, nil)
-	req.SetBasicAuth(params.username, params.password)
+	// Connecting to the first endpoint the node supports
+	// The connection is aborted as soon as the poll is stopped
+	source, err := openStatSource(params)
 
 	if err != nil {
-		params.errChannel <- newErrorMsg(
-			err, "update_stats: Cannot connect to server"+
-				params.nodeName+":"+err.Error(), false,
-		)
+		if params.ctx.Err() != nil {
+			return -1
+		}
+		params.sendError(newErrorMsg(
+			err, "update_stats: Cannot read stats from server "+
+				params.nodeName+": "+err.Error(), false,
+		))
 		return 0
 	}
+	defer source.Close()
 
-	// Sending the http request
-	resp, err := http.DefaultClient.Do(req)
+	// Main polling loop
+	// Chunks are read as soon as they are available, cancelling the poll
+	// aborts the request which unblocks the source
+	for {
 
-	if err != nil {
-		params.errChannel <- newErrorMsg(
-			err, "update_stats: Invalid http response from server"+
-				params.nodeName+":"+err.Error(), false,
-		)
-		return 0
-	}
+		// Read chunk sent by the server
+		m, err := source.Next()
+		if err != nil {
+			// Stop the routine if the node is no longer part of the cluster
+			// or chronos is shutting down
+			if params.ctx.Err() != nil {
+				log.Printf("update_stats: Stopped polling %s", params.nodeName)
+				// Indicates to the exponential loop to exit out of it
+				return -1
+			}
+			if err == io.EOF {
+				params.sendError(newErrorMsg(
+					err, "update_stats: Server closed connection"+
+						params.nodeName+err.Error(), false,
+				))
+				return 0
+			}
+			params.sendError(newErrorMsg(
+				err, "update_stats: Invalid message recieved"+
+					params.nodeName+err.Error(), false,
+			))
+			return 0
+		}
 
-	// If status code is not OK
-	if resp.StatusCode != http.StatusOK {
-		params.errChannel <- newErrorMsg(
-			err, "update_stats: Status code is not OK:"+
-				fmt.Sprintf("%d", resp.StatusCode)+resp.Status, false,
-		)
-		return 0
+		// Note time before updating for accurate calculations across commands
+		curTime := sampleTime(m, time.Now())
+
+		// Save the chunk if the session is being recorded
+		if params.recorder != nil {
+			params.recorder.record(params.nodeName, curTime, m)
+		}
+
+		if val := processMessage(params, m, curTime); val < 0 {
+			return val
+		}
+
+		// Keep the chunk on disk along with the aggregates added to it
+		if params.persister != nil {
+			params.persister.persist(params.nodeName, curTime, m.Stats)
+		}
 	}
+}
 
-	dec := json.NewDecoder(resp.Body)
+// Time a chunk was sampled at, taken from the server if it sent one
+func sampleTime(m *message, arrival time.Time) time.Time {
+	if m.Timestamp > 0 {
+		return time.UnixMilli(m.Timestamp)
+	}
+	return arrival
+}
 
-	// Setting the timer for checking if server sent a chunk through the response
-	// Should be equal to the time defined in the server
+// Updates the stats struct with a chunk that arrived from a node at curTime
+// and runs analysis on the new values
+// Shared by the live polls and the replay of a recording
+func processMessage(params *updateStatsParams, m *message,
+	curTime time.Time) int {
 
-	updateTicker := time.NewTicker(time.Second).C
+	// Aggregate rows of the stats table are stored like any other stat
+	addIndexAggregates(m.Stats)
 
-	// Main polling loop
-	for {
-		select {
-		case <-updateTicker:
+	// So are the derived stats, which can use the aggregates
+	addDerivedStats(params.stats.derived, m.Stats, curTime, params.rates)
 
-			// Decode chunk sent by the server
-			var m message
-			err := dec.Decode(&m)
-			if err != nil {
-				if err == io.EOF {
-					params.errChannel <- newErrorMsg(
-						err, "update_stats: Server closed connection"+
-							params.nodeName+err.Error(), false,
-					)
-					return 0
-				}
-				params.errChannel <- newErrorMsg(
-					err, "update_stats: Invalid message recieved"+
-						params.nodeName+err.Error(), false,
-				)
-				return 0
-			}
+	cluster, _ := widgets.SplitNodeKey(params.nodeName)
 
-			params.stats.bufferLock.Lock()
+	params.stats.updateLock.Lock()
 
-			// Check for the first iteration of any poll
-			if !params.stats.updated {
-				// Only one of the polls enters this branch once
-				params.stats.updated = true
+	// Check for the first iteration of any poll
+	if len(params.stats.initialized) == 0 {
+		// Only one of the polls enters this branch once
+		params.stats.initialized[cluster] = true
 
-				// Initialize the stats list for the first time while
-				// updating the threshold information from the flags
-				val := initStatsList(params, m.Stats)
+		// Initialize the stats list for the first time while
+		// updating the threshold information from the flags
+		val := initStatsList(params, m.Stats)
 
-				// Safely exit if there are left over flags
-				if val < 0 {
-					params.stats.bufferLock.Unlock()
-					return val
-				}
+		// Safely exit if there are left over flags
+		if val < 0 {
+			params.stats.updateLock.Unlock()
+			return val
+		}
 
-				// Add additional thresholds from the server
-				addThresholds(params.nodeName, params.username, params.password, params.stats)
-			} else {
-				// Check for differences and update the list of stats every iteration
-				updateStatsList(params, m.Stats)
+		// Add additional thresholds from the server
+		// Not available while replaying a recording
+		if !params.replaying {
+			addThresholds(params.nodeURL, cluster, params.creds,
+				params.client, params.stats)
+		}
+	} else {
+		// Check for differences and update the list of stats every iteration
+		updateStatsList(params, m.Stats)
+
+		// Every cluster has its own server settings, read on the first
+		// chunk from one of its nodes
+		if !params.stats.initialized[cluster] {
+			params.stats.initialized[cluster] = true
+
+			if !params.replaying {
+				addThresholds(params.nodeURL, cluster, params.creds,
+					params.client, params.stats)
 			}
-			params.stats.bufferLock.Unlock()
+		}
+	}
+	params.stats.updateLock.Unlock()
 
-			// Send a message to the main routine if node is under rebalance
-			if m.RebalanceInProgress {
-				params.popupChannel <- "rebalance"
-			}
+	// Send a message to the main routine if node is under rebalance
+	if m.RebalanceInProgress {
+		params.sendPopup("rebalance")
+	}
 
-			// Note time before updating for accurate calculations across commands
-			curTime := time.Now()
+	// Node removed while its chunk was being read
+	series := params.stats.series(params.nodeName)
+	if series == nil {
+		return 0
+	}
 
-			// Update arrival time of the chunk
-			params.stats.timeLock.Lock()
+	statsList := getStatsList(params.stats)
+	statInfo := make([]*configStatInfo, len(statsList))
 
-			sec := 1
+	params.stats.statInfoLock.RLock()
+	for i, stat := range statsList {
+		statInfo[i] = params.stats.thresholds(cluster, stat)
+	}
+	params.stats.statInfoLock.RUnlock()
 
-			// If this is not the first update for the node
-			if !params.stats.arrivalTimes[params.nodeName][len(params.stats.arrivalTimes[params.nodeName])-1].IsZero() {
+	// Values needed by the analysis, read while the buffers are locked
+	vals := make([]statValues, len(statsList))
 
-				// Time passed from the last time stats were updated
-				diffTime := curTime.Sub(
-					params.stats.arrivalTimes[params.nodeName][len(params.stats.arrivalTimes[params.nodeName])-1],
-				)
-				diffSec := diffTime.Seconds()
+	// The whole chunk is added under a single lock of the node
+	series.lock.Lock()
 
-				// Number of seconds to update
-				sec = int(math.Round(diffSec + params.timeDiff))
+	slots := series.store(
+		curTime, m.Stats, statsList, params.stats.interval, &params.timeDiff,
+	)
 
-				// Excess time ignored in rounding
-				params.timeDiff = diffSec + params.timeDiff - float64(sec)
-			}
+	for i, stat := range statsList {
+		if buffer, ok := series.buffers[stat]; ok && statInfo[i] != nil {
+			vals[i] = latestValues(params.stats, buffer, statInfo[i])
+		}
+	}
 
-			// If response is delayed
-			if sec > 1 {
-				params.popupChannel <- params.nodeName
-			}
+	series.lock.Unlock()
 
-			// Update unknown times
-			for i := 0; i < sec-1; i++ {
-				params.stats.arrivalTimes[params.nodeName] =
-					params.stats.arrivalTimes[params.nodeName][1:]
+	// If response is delayed
+	if slots > 1 {
+		params.sendPopup(params.nodeName)
+	}
 
-				params.stats.arrivalTimes[params.nodeName] =
-					append(
-						params.stats.arrivalTimes[params.nodeName],
-						time.Time{},
-					)
-			}
+	// Run analysis on the newest data
+	for i, stat := range statsList {
+		if statInfo[i] == nil {
+			continue
+		}
+		analyzeValues(
+			params.stats, params.nodeName, stat, statInfo[i], curTime,
+			vals[i], params.eventChannel,
+		)
+	}
+	analyzeRules(
+		params.stats, params.nodeName, statsList, params.eventChannel,
+	)
 
-			// Update current time
-			params.stats.arrivalTimes[params.nodeName] =
-				params.stats.arrivalTimes[params.nodeName][1:]
+	// The cluster row combines the nodes once every interval
+	aggregateCluster(params, curTime, statsList)
 
-			params.stats.arrivalTimes[params.nodeName] =
-				append(params.stats.arrivalTimes[params.nodeName], curTime)
+	return 0
+}
 
-			params.stats.timeLock.Unlock()
+// Add the sum of every index level stat across the indexes of each bucket
+// (bucket:*:stat) and across all the indexes (*:*:stat)
+func addIndexAggregates(incomingStats map[string]float64) {
 
-			params.stats.bufferLock.Lock()
+	aggregates := make(map[string]float64)
 
-			// Update unknown stats
-			for i := 0; i < sec-1; i++ {
-				//params.stats.statsListLock.RLock()
-				for _, stat := range params.stats.statsList {
-					params.stats.statBuffers[params.nodeName][stat] =
-						params.stats.statBuffers[params.nodeName][stat][1:]
+	for stat, val := range incomingStats {
+		bucket, index, name, ok := widgets.SplitStatKey(stat)
+		if !ok || bucket == "*" || index == "*" {
+			continue
+		}
 
-					params.stats.statBuffers[params.nodeName][stat] =
-						append(
-							params.stats.statBuffers[params.nodeName][stat],
-							params.stats.statBuffers[params.nodeName][stat][len(params.stats.statBuffers[params.nodeName][stat])-1],
-						)
-				}
-				//params.stats.statsListLock.RUnlock()
-			}
-			params.stats.bufferLock.Unlock()
-
-			// Update current stat slices
-			//params.stats.statsListLock.RLock()
-			for _, stat := range params.stats.statsList {
-				val, ok := m.Stats[stat]
-				params.stats.bufferLock.Lock()
-
-				// Remove first element
-				params.stats.statBuffers[params.nodeName][stat] =
-					params.stats.statBuffers[params.nodeName][stat][1:]
-
-				// If chunk has the stat, update the buffer with the value
-				// else update with 0 as default (should never occur)
-				if ok {
-					params.stats.statBuffers[params.nodeName][stat] =
-						append(
-							params.stats.statBuffers[params.nodeName][stat], val,
-						)
-				} else {
-					params.stats.statBuffers[params.nodeName][stat] =
-						append(
-							params.stats.statBuffers[params.nodeName][stat], 0,
-						)
-				}
-				params.stats.bufferLock.Unlock()
-
-				// Run analysis on the newest data
-				analyzeStat(
-					params.stats, params.nodeName, stat, params.eventChannel,
-				)
-			}
-			//params.stats.statsListLock.RUnlock()
+		aggregates[bucket+":*:"+name] += val
+		aggregates["*:*:"+name] += val
+	}
 
-		// Kill the routine if node is no longer part of the cluster
-		case <-params.killSwitch:
-			params.errChannel <- newErrorMsg(
-				nil, "update_stats: Node not part of cluster anymore: "+
-					params.nodeName, false,
-			)
-			// Indicates to the exponential loop to exit out of it
-			return -1
-		}
+	for stat, val := range aggregates {
+		incomingStats[stat] = val
 	}
 }
 
@@ -301,27 +361,24 @@ func updateStatsExponentialBackoff(params *updateStatsParams) {
 	nextSleepMS := startSleepMS
 
 	for {
-		select {
-		// Exit out of backoff loop if node no longer in the cluster
-		case <-params.killSwitch:
-			params.errChannel <- newErrorMsg(
-				nil, "update_stats: Node not part of cluster anymore: "+
-					params.nodeName, false)
+		val := updateStats(params)
+
+		if val == -1 {
 			return
-		// Retry with exponential backoff
-		default:
-			val := updateStats(params)
+		}
 
-			time.Sleep(time.Duration(nextSleepMS) * time.Millisecond)
-			nextSleepMS = int(float64(nextSleepMS) * backoffFactor)
+		// Retry with exponential backoff
+		// Exit out of backoff loop if the poll is stopped
+		select {
+		case <-params.ctx.Done():
+			return
+		case <-time.After(time.Duration(nextSleepMS) * time.Millisecond):
+		}
 
-			if nextSleepMS > maxSleepMS {
-				nextSleepMS = maxSleepMS
-			}
+		nextSleepMS = int(float64(nextSleepMS) * backoffFactor)
 
-			if val == -1 {
-				return
-			}
+		if nextSleepMS > maxSleepMS {
+			nextSleepMS = maxSleepMS
 		}
 	}
 }
@@ -335,79 +392,51 @@ func initStatsList(params *updateStatsParams,
 	for stat := range incomingStats {
 
 		// Initialize buffers for the stats
-		for node := range params.stats.statBuffers {
-			params.stats.statBuffers[node][stat] = make([]float64, 300)
-		}
+		params.stats.addStat(stat)
 
 		params.stats.statsListLock.Lock()
 		params.stats.statsList = append(params.stats.statsList, stat)
 		params.stats.statsListLock.Unlock()
 
-		statInfo := &configStatInfo{
-			MinVal:        math.NaN(),
-			MaxVal:        math.NaN(),
-			MaxChange:     math.NaN(),
-			MaxChangeTime: 1,
-		}
+		statInfo := newStatInfo()
 
 		// Check flags for the respective flag
-		if len(flag.CommandLine.Additional) != 0 {
-			for threshold, value := range flag.CommandLine.Additional {
-				switch threshold {
-				case stat + "_max_val":
-					temp, err := strconv.ParseFloat(value, 64)
-					if err != nil {
-						params.errChannel <- newErrorMsg(
-							err, "update_stats: Invalid flag value: "+
-								threshold+err.Error(), true,
-						)
-						return -1
-					}
-					statInfo.MaxVal = temp
-					delete(flag.CommandLine.Additional, threshold)
-				case stat + "_min_val":
-					temp, err := strconv.ParseFloat(value, 64)
-					if err != nil {
-						params.errChannel <- newErrorMsg(
-							err, "update_stats: Invalid flag value: "+
-								threshold+err.Error(), true,
-						)
-						return -1
-					}
-					statInfo.MinVal = temp
-					delete(flag.CommandLine.Additional, threshold)
-				case stat + "_max_change":
-					temp, err := strconv.ParseFloat(value, 64)
-					if err != nil {
-						params.errChannel <- newErrorMsg(
-							err, "update_stats: Invalid flag value: "+
-								threshold+err.Error(), true,
-						)
-						return -1
-					}
-					statInfo.MaxChange = temp
-					delete(flag.CommandLine.Additional, threshold)
-				case stat + "_max_change_time":
-					temp, err := strconv.Atoi(value)
-					if err != nil {
-						params.errChannel <- newErrorMsg(
-							err, "update_stats: Invalid flag value: "+
-								threshold+err.Error(), true,
-						)
-						return -1
-					}
-					statInfo.MaxChangeTime = temp
-					delete(flag.CommandLine.Additional, threshold)
-				}
+		_, threshold, err := thresholdFlags(stat, statInfo)
+		if err != nil {
+			params.sendError(newErrorMsg(
+				err, "update_stats: Invalid flag value: "+
+					threshold+err.Error(), true,
+			))
+			return -1
+		}
+
+		// Thresholds of the cluster aggregates of the stat
+		for _, agg := range aggregations {
+			clusterInfo := newStatInfo()
+			name := clusterStatName(agg, stat)
+
+			found, threshold, err := thresholdFlags(name, clusterInfo)
+			if err != nil {
+				params.sendError(newErrorMsg(
+					err, "update_stats: Invalid flag value: "+
+						threshold+err.Error(), true,
+				))
+				return -1
+			}
+
+			if found {
+				params.stats.statInfoLock.Lock()
+				params.stats.statInfo[name] = clusterInfo
+				params.stats.statInfoLock.Unlock()
 			}
 		}
 
 		// Send UI information about the new stat
-		params.updateChannel <- updateMessage{
+		params.sendUpdate(updateMessage{
 			add:  true,
 			node: "",
 			stat: stat,
-		}
+		})
 
 		params.stats.statInfoLock.Lock()
 		params.stats.statInfo[stat] = statInfo
@@ -424,46 +453,113 @@ func initStatsList(params *updateStatsParams,
 			)
 		}
 
-		params.errChannel <- newErrorMsg(
+		params.sendError(newErrorMsg(
 			nil, "update_stats: Invalid flag ",
 			true,
-		)
+		))
 		return -1
 	}
 
 	return 0
 }
 
+// Thresholds of a stat when no flag is given for it
+func newStatInfo() *configStatInfo {
+	return &configStatInfo{
+		MinVal:        math.NaN(),
+		MaxVal:        math.NaN(),
+		MaxChange:     math.NaN(),
+		MaxChangeTime: 1,
+		MaxDelta:      math.NaN(),
+		MaxIncrease:   math.NaN(),
+		MaxDecrease:   math.NaN(),
+		MaxRate:       math.NaN(),
+		MaxClear:      math.NaN(),
+		MinClear:      math.NaN(),
+		Anomaly:       math.NaN(),
+		Outlier:       math.NaN(),
+	}
+}
+
+// Read the threshold flags given for name into statInfo, removing them
+// from the flags left to check
+// Returns whether any was given, or the flag that could not be parsed
+func thresholdFlags(name string, statInfo *configStatInfo) (bool, string, error) {
+
+	found := false
+
+	for threshold, value := range flag.CommandLine.Additional {
+		var err error
+
+		switch threshold {
+		case name + "_max_val":
+			statInfo.MaxVal, err = strconv.ParseFloat(value, 64)
+		case name + "_min_val":
+			statInfo.MinVal, err = strconv.ParseFloat(value, 64)
+		case name + "_max_change":
+			statInfo.MaxChange, err = strconv.ParseFloat(value, 64)
+		case name + "_max_change_time":
+			statInfo.MaxChangeTime, err = strconv.Atoi(value)
+		case name + "_max_delta":
+			statInfo.MaxDelta, err = strconv.ParseFloat(value, 64)
+		case name + "_max_increase":
+			statInfo.MaxIncrease, err = strconv.ParseFloat(value, 64)
+		case name + "_max_decrease":
+			statInfo.MaxDecrease, err = strconv.ParseFloat(value, 64)
+		case name + "_max_rate":
+			statInfo.MaxRate, err = strconv.ParseFloat(value, 64)
+		case name + "_for":
+			statInfo.For, err = strconv.Atoi(value)
+		case name + "_max_clear":
+			statInfo.MaxClear, err = strconv.ParseFloat(value, 64)
+		case name + "_min_clear":
+			statInfo.MinClear, err = strconv.ParseFloat(value, 64)
+		case name + "_anomaly":
+			statInfo.Anomaly, err = strconv.ParseFloat(value, 64)
+		case name + "_anomaly_window":
+			statInfo.AnomalyWindow, err = strconv.Atoi(value)
+		case name + "_anomaly_method":
+			statInfo.AnomalyMethod = value
+			err = checkAnomalyMethod(value)
+		case name + "_outlier":
+			statInfo.Outlier, err = strconv.ParseFloat(value, 64)
+		default:
+			continue
+		}
+
+		if err != nil {
+			return found, threshold, err
+		}
+		delete(flag.CommandLine.Additional, threshold)
+		found = true
+	}
+
+	return found, "", nil
+}
+
 // Compare the current polled statsList with the existing statsList
 // Add or remove stats accordingly
 func updateStatsList(params *updateStatsParams,
 	incomingStats map[string]float64) {
 
-	for stat := range incomingStats {
-		if _, ok := params.stats.statBuffers[params.nodeName][stat]; !ok {
-			for node := range params.stats.statBuffers {
-				params.stats.statBuffers[node][stat] = make([]float64, 300)
-			}
+	missing := params.stats.missingStats(params.nodeName, incomingStats)
 
-			params.stats.statsListLock.Lock()
-			params.stats.statsList = append(params.stats.statsList, stat)
-			params.stats.statsListLock.Unlock()
+	for _, stat := range missing {
+		params.stats.addStat(stat)
 
-			params.stats.statInfoLock.Lock()
-			params.stats.statInfo[stat] = &configStatInfo{
-				MinVal:        math.NaN(),
-				MaxVal:        math.NaN(),
-				MaxChange:     math.NaN(),
-				MaxChangeTime: 1,
-			}
-			params.stats.statInfoLock.Unlock()
+		params.stats.statsListLock.Lock()
+		params.stats.statsList = append(params.stats.statsList, stat)
+		params.stats.statsListLock.Unlock()
 
-			params.updateChannel <- updateMessage{
-				add:  true,
-				node: "",
-				stat: stat,
-			}
-		}
+		params.stats.statInfoLock.Lock()
+		params.stats.statInfo[stat] = newStatInfo()
+		params.stats.statInfoLock.Unlock()
+
+		params.sendUpdate(updateMessage{
+			add:  true,
+			node: "",
+			stat: stat,
+		})
 	}
 
 	statsList := make([]string, 0)
@@ -472,16 +568,16 @@ func updateStatsList(params *updateStatsParams,
 	for _, stat := range curStatsList {
 		if _, ok := incomingStats[stat]; !ok {
 
-			delete(params.stats.statBuffers[params.nodeName], stat)
+			params.stats.removeStat(params.nodeName, stat)
 			params.stats.statInfoLock.Lock()
 			delete(params.stats.statInfo, stat)
 			params.stats.statInfoLock.Unlock()
 
-			params.updateChannel <- updateMessage{
+			params.sendUpdate(updateMessage{
 				add:  false,
 				node: "",
 				stat: stat,
-			}
+			})
 		} else {
 			statsList = append(statsList, stat)
 		}
@@ -0,0 +1,185 @@
+//  Copyright 2023-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included
+//  in the file licenses/BSL-Couchbase.txt.  As of the Change Date specified
+//  in that file, in accordance with the Business Source License, use of this
+//  software will be governed by the Apache License, Version 2.0, included in
+//  the file licenses/APL2.txt.
+
+package main
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestProcessMessageInterval(t *testing.T) {
+
+	interval := time.Millisecond * time.Duration(250)
+	node := "node1"
+
+	stats := statsInit(&config{
+		stats:    make(map[string]*configStatInfo),
+		interval: &interval,
+	}, []string{node})
+	stats.initialized[""] = true
+	stats.statsList = []string{"stat1"}
+	stats.addStat("stat1")
+	stats.statInfo["stat1"] = &configStatInfo{
+		MinVal:        math.NaN(),
+		MaxVal:        math.NaN(),
+		MaxChange:     math.NaN(),
+		MaxChangeTime: 1,
+	}
+
+	popupChannel := make(chan string, 10)
+	params := newUpdateStatsParams(
+		nil, stats, node, nil, nil, popupChannel, nil,
+		context.Background(), nil,
+	)
+
+	start := time.UnixMilli(1690000000000)
+
+	// Server timestamps in milliseconds after start, one sample missing
+	offsets := []int64{0, 250, 750, 1000}
+
+	for i, offset := range offsets {
+		m := &message{
+			Stats:     map[string]float64{"stat1": float64(i + 1)},
+			Timestamp: start.UnixMilli() + offset,
+		}
+
+		// Arrival times are ignored when the server sends a timestamp
+		processMessage(params, m, sampleTime(m, time.Now()))
+	}
+
+	expectedTimes := []time.Time{
+		start,
+		start.Add(interval),
+		{},
+		start.Add(interval * 3),
+		start.Add(interval * 4),
+	}
+	expectedData := []float64{1, 2, math.NaN(), 3, 4}
+
+	times := stats.series(node).times.snapshot()[stats.historyLen-len(expectedTimes):]
+	data := stats.snapshot(node, "stat1")[stats.historyLen-len(expectedData):]
+
+	for i := range expectedTimes {
+		if !times[i].Equal(expectedTimes[i]) {
+			t.Errorf("Expected %v got %v %d", expectedTimes[i], times[i], i)
+		}
+		if !sameValue(data[i], expectedData[i]) {
+			t.Errorf("Expected %v got %v %d", expectedData[i], data[i], i)
+		}
+	}
+
+	if len(popupChannel) != 1 {
+		t.Errorf("Expected %v got %v slow response popups", 1, len(popupChannel))
+	}
+}
+
+func TestAddIndexAggregates(t *testing.T) {
+
+	testCases := []struct {
+		input    map[string]float64
+		expected map[string]float64
+	}{
+		{
+			input: map[string]float64{
+				"pct_cpu_gc":                1,
+				"travel:idx1:doc_count":     10,
+				"travel:idx2:doc_count":     5,
+				"beer:idx3:doc_count":       2,
+				"travel:idx1:num_mutations": 3,
+			},
+			expected: map[string]float64{
+				"pct_cpu_gc":                1,
+				"travel:idx1:doc_count":     10,
+				"travel:idx2:doc_count":     5,
+				"beer:idx3:doc_count":       2,
+				"travel:idx1:num_mutations": 3,
+				"travel:*:doc_count":        15,
+				"beer:*:doc_count":          2,
+				"*:*:doc_count":             17,
+				"travel:*:num_mutations":    3,
+				"*:*:num_mutations":         3,
+			},
+		},
+		// Prometheus stats are left alone
+		{
+			input: map[string]float64{
+				"kv_ops{bucket=\"a:b:c\"}": 1,
+			},
+			expected: map[string]float64{
+				"kv_ops{bucket=\"a:b:c\"}": 1,
+			},
+		},
+	}
+
+	for i, testCase := range testCases {
+
+		addIndexAggregates(testCase.input)
+
+		if len(testCase.input) != len(testCase.expected) {
+			t.Errorf("Expected %v got %v %d", testCase.expected, testCase.input, i)
+			continue
+		}
+
+		for stat, val := range testCase.expected {
+			if testCase.input[stat] != val {
+				t.Errorf("Expected %v got %v %d", val, testCase.input[stat], i)
+			}
+		}
+	}
+}
+
+func TestStatsInitHistory(t *testing.T) {
+
+	durationPointer := func(val time.Duration) *time.Duration {
+		return &val
+	}
+
+	testCases := []struct {
+		interval *time.Duration
+		history  *time.Duration
+		expected int
+	}{
+		{
+			expected: 300,
+		},
+		{
+			history:  durationPointer(time.Hour),
+			expected: 3600,
+		},
+		{
+			interval: durationPointer(time.Millisecond * time.Duration(500)),
+			history:  durationPointer(time.Minute * time.Duration(30)),
+			expected: 3600,
+		},
+		{
+			interval: durationPointer(time.Minute),
+			history:  durationPointer(time.Second),
+			expected: 2,
+		},
+	}
+
+	for i, testCase := range testCases {
+
+		stats := statsInit(&config{
+			stats:    make(map[string]*configStatInfo),
+			interval: testCase.interval,
+			history:  testCase.history,
+		}, []string{"node1"})
+
+		if stats.historyLen != testCase.expected {
+			t.Errorf("Expected %v got %v %d", testCase.expected, stats.historyLen, i)
+		}
+		if stats.series("node1").times.len() != testCase.expected {
+			t.Errorf("Expected %v got %v %d",
+				testCase.expected, stats.series("node1").times.len(), i)
+		}
+	}
+}
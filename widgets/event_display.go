@@ -11,7 +11,9 @@ package widgets
 import (
 	"fmt"
 	"image"
+	"math"
 	"os"
+	"strings"
 	"sync"
 	"time"
 
@@ -25,14 +27,88 @@ const (
 	colorCyan2     ui.Color = 50
 	colorSeaGreen1 ui.Color = 84
 	colorRed3      ui.Color = 160
+	colorOrange1   ui.Color = 214
+	colorMagenta1  ui.Color = 201
+	colorYellow1   ui.Color = 226
+	colorGrey50    ui.Color = 244
 	percent        string   = "%"
 )
 
+// Severities of an alert, the alerts not raised by a rule are warnings
+const (
+	SeverityInfo     = "info"
+	SeverityWarning  = "warning"
+	SeverityCritical = "critical"
+)
+
+// States of an alert
+const (
+	// The alert is still being triggered
+	StateFiring = "firing"
+
+	// The value returned within bounds
+	StateResolved = "resolved"
+
+	// Seen by the user while firing, until it resolves
+	StateAcknowledged = "acknowledged"
+
+	// Not triggered for the alert TTL, removed from the display
+	StateExpired = "expired"
+)
+
+// States an alert can move to from each state
+var transitions = map[string][]string{
+	StateFiring:       {StateResolved, StateAcknowledged, StateExpired},
+	StateAcknowledged: {StateResolved, StateExpired},
+	StateResolved:     {StateFiring, StateExpired},
+}
+
+// Assign colors for severities, shown before the description of an alert
+var severityColors = map[string]ui.Color{
+	SeverityInfo:     colorCyan2,
+	SeverityWarning:  colorOrange1,
+	SeverityCritical: colorRed3,
+}
+
 // Assign colors for event types
 var eventColors = map[string]ui.Color{
 	"Below Threshold": colorCyan2,
 	"Above Threshold": colorRed3,
 	"Sudden Change":   colorSeaGreen1,
+	"Sudden Increase": colorSeaGreen1,
+	"Sudden Decrease": colorSeaGreen1,
+	"Sudden Delta":    colorSeaGreen1,
+	"Rate of Change":  colorSeaGreen1,
+	"Rule":            colorOrange1,
+	"Anomaly":         colorMagenta1,
+	"Node Outlier":    colorYellow1,
+}
+
+// Source of the current time for alerts
+// Replaced while replaying a recording so alerts carry the recorded times
+var Now = time.Now
+
+// Expected time between two data points of an alert
+// Used to detect missing data in reports
+var SampleInterval = time.Second
+
+// Split a node into the cluster it belongs to and its address
+// Nodes are only prefixed with their cluster, eg. east/http://10.0.0.1:8094
+// or east/cluster (sum), when monitoring more than one cluster
+func SplitNodeKey(node string) (string, string) {
+
+	// Cluster rows have no scheme
+	scheme := strings.Index(node, "://")
+	if scheme < 0 {
+		scheme = len(node)
+	}
+
+	sep := strings.LastIndex(node[:scheme], "/")
+	if sep <= 0 {
+		return "", node
+	}
+
+	return node[:sep], node[sep+1:]
 }
 
 // Widget to display a list of alerts
@@ -61,6 +137,9 @@ type EventDisplay struct {
 
 	// Lock for the list of alerts
 	EventLock sync.RWMutex
+
+	// Tracks the reports still being written
+	reports sync.WaitGroup
 }
 
 // Struct to hold all the information for one alert
@@ -78,12 +157,32 @@ type Event struct {
 	// Name of the node the alert corresponds to
 	Node string
 
+	// Name of the cluster of the node, empty when monitoring a single cluster
+	Cluster string
+
 	// Name of the stat the alert corresponds to
 	Stat string
 
 	// Type of the alert triggered
 	EventType string
 
+	// Name and condition of the rule that triggered a "Rule" alert
+	Rule      string
+	Condition string
+
+	// Stats the condition of a rule without stats globs uses, the alert
+	// is kept under the first of them
+	RuleStats []string
+
+	// One of SeverityInfo, SeverityWarning or SeverityCritical
+	Severity string
+
+	// One of the states above, set through SetState
+	State string
+
+	// The time the value returned within bounds
+	ResolvedAt time.Time
+
 	// The threshold for the alert
 	Threshold float64
 
@@ -93,9 +192,16 @@ type Event struct {
 	// The amount of change at the time of the latest alert
 	ThresholdChange float64
 
-	// The amount of time with which the change is calculated
+	// The number of samples back the change is calculated from
 	ThresholdTime int
 
+	// The amount of time with which the change is calculated, ThresholdTime
+	// samples of the stream interval
+	ChangeWindow time.Duration
+
+	// Value expected from the recent values of an anomaly
+	Expected float64
+
 	// Description of alert to be displayed
 	Description string
 
@@ -108,9 +214,6 @@ type Event struct {
 	// The time from which the alert has been collecting data
 	DataStart time.Time
 
-	// Toggle to indicate alert has expired
-	Stale bool
-
 	// Counter for number of times the alert has triggered
 	NumTimes int
 
@@ -119,8 +222,15 @@ type Event struct {
 
 	// Toggle to indicate alert node is no longer in cluster
 	Deprecated bool
+
+	// Maximum number of data points the alert can hold, the length of the
+	// history window of the stat
+	MaxData int
 }
 
+// Data points held by an alert whose MaxData is not set
+const defaultMaxData = 300
+
 // Initializes a new event display
 func NewEventDisplay() *EventDisplay {
 	return &EventDisplay{
@@ -138,18 +248,23 @@ func NewEventDisplay() *EventDisplay {
 // Initializes a new event
 func NewEvent(node string, stat string, eventType string,
 	thresholdData float64, threshold float64) *Event {
+
+	cluster, _ := SplitNodeKey(node)
+
 	return &Event{
 		Data:           make([]float64, 0),
 		DataTimes:      make([]time.Time, 0),
 		AlertTimes:     make([]time.Time, 0),
 		Node:           node,
+		Cluster:        cluster,
 		Stat:           stat,
 		EventType:      eventType,
 		Threshold:      threshold,
 		ThresholdData:  thresholdData,
-		FirstTriggered: time.Now(),
-		LastTriggered:  time.Now(),
-		Stale:          false,
+		FirstTriggered: Now(),
+		LastTriggered:  Now(),
+		Severity:       SeverityWarning,
+		State:          StateFiring,
 		NumTimes:       1,
 		Deprecated:     false,
 	}
@@ -172,21 +287,68 @@ func CopyEvent(event *Event) *Event {
 		DataTimes:       eventDataTimes,
 		AlertTimes:      eventAlertTimes,
 		Node:            event.Node,
+		Cluster:         event.Cluster,
 		Stat:            event.Stat,
 		EventType:       event.EventType,
+		Rule:            event.Rule,
+		Condition:       event.Condition,
+		RuleStats:       append([]string(nil), event.RuleStats...),
+		Severity:        event.Severity,
+		State:           event.State,
+		ResolvedAt:      event.ResolvedAt,
 		Threshold:       event.Threshold,
 		ThresholdData:   event.ThresholdData,
 		ThresholdChange: event.ThresholdChange,
 		ThresholdTime:   event.ThresholdTime,
+		ChangeWindow:    event.ChangeWindow,
+		Expected:        event.Expected,
 		Description:     event.Description,
 		FirstTriggered:  event.FirstTriggered,
 		LastTriggered:   event.LastTriggered,
 		DataStart:       event.DataStart,
-		Stale:           event.Stale,
 		NumTimes:        event.NumTimes,
 		DataFilled:      event.DataFilled,
 		Deprecated:      event.Deprecated,
+		MaxData:         event.MaxData,
+	}
+}
+
+// Current state of the alert, alerts made without NewEvent are firing
+func (event *Event) CurState() string {
+	if event.State == "" {
+		return StateFiring
+	}
+	return event.State
+}
+
+// Move the alert to state if it can go there from its current state,
+// returning whether it did
+func (event *Event) SetState(state string) bool {
+
+	for _, next := range transitions[event.CurState()] {
+		if next != state {
+			continue
+		}
+
+		event.State = state
+		if state == StateResolved {
+			event.ResolvedAt = Now()
+		}
+		return true
+	}
+
+	return false
+}
+
+// Check if the alert holds as much data as its history window allows
+func (event *Event) Full() bool {
+
+	maxData := event.MaxData
+	if maxData <= 0 {
+		maxData = defaultMaxData
 	}
+
+	return len(event.Data) >= maxData
 }
 
 // Handler to generate a report for an event
@@ -215,7 +377,12 @@ func MakeReport(event *Event, path string) {
 // Handler to make the report text as a string
 func ReportText(event *Event) string {
 
-	fileInfo := fmt.Sprintf(
+	fileInfo := ""
+	if event.Cluster != "" {
+		fileInfo = fmt.Sprintf("Cluster - %s\n", event.Cluster)
+	}
+
+	fileInfo = fileInfo + fmt.Sprintf(
 		"Node - %s\nStat - %s\n\n", event.Node, event.Stat,
 	)
 
@@ -224,19 +391,89 @@ func ReportText(event *Event) string {
 		if event.NumTimes == 1 {
 			fileInfo = fileInfo + fmt.Sprintf(
 				"Stat changed by more than the threshold limit of %.2f%s at %s."+
-					" This change occured over %d second(s).\n\n",
+					" This change occured over %g second(s).\n\n",
 				event.Threshold*100, percent,
 				event.LastTriggered.Format("2006-01-02 15:04:05"),
-				event.ThresholdTime,
+				event.ChangeWindow.Seconds(),
 			)
 		} else {
 			fileInfo = fileInfo + fmt.Sprintf("Stat changed by more than the "+
-				"threshold limit of %.2f%s at %s. This change occured over %d "+
+				"threshold limit of %.2f%s at %s. This change occured over %g "+
 				"second(s).\nSimilar changes occured %d times with the last one"+
 				" occuring at %s.\n\n",
 				event.Threshold*100, percent,
 				event.FirstTriggered.Format("2006-01-02 15:04:05"),
-				event.ThresholdTime, event.NumTimes,
+				event.ChangeWindow.Seconds(), event.NumTimes,
+				event.LastTriggered.Format("2006-01-02 15:04:05"),
+			)
+		}
+	case "Sudden Increase", "Sudden Decrease":
+		direction := "rose"
+		if event.EventType == "Sudden Decrease" {
+			direction = "fell"
+		}
+		if event.NumTimes == 1 {
+			fileInfo = fileInfo + fmt.Sprintf(
+				"Stat %s by %.2f%s, more than the threshold limit of %.2f%s,"+
+					" at %s. This change occured over %g second(s).\n\n",
+				direction, event.ThresholdChange*100, percent,
+				event.Threshold*100, percent,
+				event.LastTriggered.Format("2006-01-02 15:04:05"),
+				event.ChangeWindow.Seconds(),
+			)
+		} else {
+			fileInfo = fileInfo + fmt.Sprintf(
+				"Stat %s by %.2f%s, more than the threshold limit of %.2f%s,"+
+					" at %s. This change occured over %g second(s).\nSimilar "+
+					"changes occured %d times with the last one occuring at"+
+					" %s.\n\n",
+				direction, event.ThresholdChange*100, percent,
+				event.Threshold*100, percent,
+				event.FirstTriggered.Format("2006-01-02 15:04:05"),
+				event.ChangeWindow.Seconds(), event.NumTimes,
+				event.LastTriggered.Format("2006-01-02 15:04:05"),
+			)
+		}
+	case "Sudden Delta":
+		if event.NumTimes == 1 {
+			fileInfo = fileInfo + fmt.Sprintf(
+				"Stat changed by %f, more than the threshold limit of %f, at"+
+					" %s. This change occured over %g second(s).\n\n",
+				event.ThresholdChange, event.Threshold,
+				event.LastTriggered.Format("2006-01-02 15:04:05"),
+				event.ChangeWindow.Seconds(),
+			)
+		} else {
+			fileInfo = fileInfo + fmt.Sprintf(
+				"Stat changed by %f, more than the threshold limit of %f, at"+
+					" %s. This change occured over %g second(s).\nSimilar "+
+					"changes occured %d times with the last one occuring at"+
+					" %s.\n\n",
+				event.ThresholdChange, event.Threshold,
+				event.FirstTriggered.Format("2006-01-02 15:04:05"),
+				event.ChangeWindow.Seconds(), event.NumTimes,
+				event.LastTriggered.Format("2006-01-02 15:04:05"),
+			)
+		}
+	case "Rate of Change":
+		if event.NumTimes == 1 {
+			fileInfo = fileInfo + fmt.Sprintf(
+				"Stat changed at %f per second, faster than the threshold "+
+					"limit of %f per second, at %s. The rate was measured "+
+					"over %g second(s).\n\n",
+				event.ThresholdChange, event.Threshold,
+				event.LastTriggered.Format("2006-01-02 15:04:05"),
+				event.ChangeWindow.Seconds(),
+			)
+		} else {
+			fileInfo = fileInfo + fmt.Sprintf(
+				"Stat changed at %f per second, faster than the threshold "+
+					"limit of %f per second, at %s. The rate was measured "+
+					"over %g second(s).\nSimilar changes occured %d times "+
+					"with the last one occuring at %s.\n\n",
+				event.ThresholdChange, event.Threshold,
+				event.FirstTriggered.Format("2006-01-02 15:04:05"),
+				event.ChangeWindow.Seconds(), event.NumTimes,
 				event.LastTriggered.Format("2006-01-02 15:04:05"),
 			)
 		}
@@ -275,60 +512,143 @@ func ReportText(event *Event) string {
 				event.LastTriggered.Format("2006-01-02 15:04:05"),
 			)
 		}
+	case "Anomaly":
+		if event.NumTimes == 1 {
+			fileInfo = fileInfo + fmt.Sprintf(
+				"Stat was %.2f deviations away from its expected value of %f"+
+					" at %s, more than the sensitivity of %.2f.\n\n",
+				event.ThresholdChange, event.Expected,
+				event.LastTriggered.Format("2006-01-02 15:04:05"),
+				event.Threshold,
+			)
+		} else {
+			fileInfo = fileInfo + fmt.Sprintf(
+				"Stat was %.2f deviations away from its expected value of %f"+
+					" at %s, more than the sensitivity of %.2f.\nSimilar "+
+					"anomalies occured %d times with the last one occuring"+
+					" at %s.\n\n",
+				event.ThresholdChange, event.Expected,
+				event.FirstTriggered.Format("2006-01-02 15:04:05"),
+				event.Threshold, event.NumTimes,
+				event.LastTriggered.Format("2006-01-02 15:04:05"),
+			)
+		}
+	case "Node Outlier":
+		if event.NumTimes == 1 {
+			fileInfo = fileInfo + fmt.Sprintf(
+				"Stat was %.2f times the median of %f across the nodes"+
+					" at %s, beyond the threshold factor of %.2f.\n\n",
+				event.ThresholdChange, event.Expected,
+				event.LastTriggered.Format("2006-01-02 15:04:05"),
+				event.Threshold,
+			)
+		} else {
+			fileInfo = fileInfo + fmt.Sprintf(
+				"Stat was %.2f times the median of %f across the nodes"+
+					" at %s, beyond the threshold factor of %.2f.\nThe node "+
+					"stood out %d times with the last one occuring at %s.\n\n",
+				event.ThresholdChange, event.Expected,
+				event.FirstTriggered.Format("2006-01-02 15:04:05"),
+				event.Threshold, event.NumTimes,
+				event.LastTriggered.Format("2006-01-02 15:04:05"),
+			)
+		}
+	case "Rule":
+		if event.NumTimes == 1 {
+			fileInfo = fileInfo + fmt.Sprintf(
+				"Rule %s (%s) of severity %s held at %s with a value of %f.\n\n",
+				event.Rule, event.Condition, event.Severity,
+				event.LastTriggered.Format("2006-01-02 15:04:05"),
+				event.ThresholdData,
+			)
+		} else {
+			fileInfo = fileInfo + fmt.Sprintf(
+				"Rule %s (%s) of severity %s held at %s with a value of %f.\n"+
+					"Similarly, the rule held %d times with the last one "+
+					"occuring at %s.\n\n",
+				event.Rule, event.Condition, event.Severity,
+				event.FirstTriggered.Format("2006-01-02 15:04:05"),
+				event.ThresholdData, event.NumTimes,
+				event.LastTriggered.Format("2006-01-02 15:04:05"),
+			)
+		}
 	}
 
 	if event.Deprecated {
 		fileInfo = fileInfo + "Node corresponding to alert was removed from the cluster.\n\n"
 	}
 
+	// Samples with no arrival time are gaps, only the known ones
+	// bound the data
+	firstTime, lastTime := time.Time{}, time.Time{}
+	for _, dataTime := range event.DataTimes {
+		if !dataTime.IsZero() {
+			if firstTime.IsZero() {
+				firstTime = dataTime
+			}
+			lastTime = dataTime
+		}
+	}
+
 	fileInfo = fileInfo + fmt.Sprintf(
 		"Data collected from %s to %s\n\n",
-		event.DataTimes[0].Format("2006-01-02 15:04:05"),
-		event.DataTimes[len(event.DataTimes)-1].Format("2006-01-02 15:04:05"),
+		firstTime.Format("2006-01-02 15:04:05"),
+		lastTime.Format("2006-01-02 15:04:05"),
 	)
 
 	prevTime := event.DataStart
 	var curTime time.Time
 
+	// Number of samples missing since the previous known one
+	missing := 0
+	first := true
+
 	for i, j := 0, 0; i < len(event.DataTimes); i++ {
 
 		curTime = event.DataTimes[i]
 
-		if i == 0 {
-			if CompareTimes(prevTime, curTime) {
+		if curTime.IsZero() {
+			missing++
+			continue
+		}
+
+		if missing > 0 {
+			if first {
 				fileInfo = fileInfo + fmt.Sprintf(
-					"%s - %f", curTime.Format("2006-01-02 15:04:05"),
-					event.Data[i],
+					"No data recieved from server before %s, %d sample(s) missing\n",
+					curTime.Format("2006-01-02 15:04:05"), missing,
 				)
 			} else {
 				fileInfo = fileInfo + fmt.Sprintf(
-					"No data recieved from server before %s\n",
-					curTime.Format("2006-01-02 15:04:05"),
+					"No data recieved from server between %s and %s,"+
+						" %d sample(s) missing\n",
+					prevTime.Format("2006-01-02 15:04:05"),
+					curTime.Format("2006-01-02 15:04:05"), missing,
 				)
+			}
+		} else if first {
+			if !CompareTimes(prevTime, curTime) {
 				fileInfo = fileInfo + fmt.Sprintf(
-					"%s - %f", curTime.Format("2006-01-02 15:04:05"),
-					event.Data[i],
+					"No data recieved from server before %s\n",
+					curTime.Format("2006-01-02 15:04:05"),
 				)
 			}
 		} else {
-			if CompareTimes(prevTime.Add(time.Second), curTime) {
-				fileInfo = fileInfo + fmt.Sprintf(
-					"%s - %f", curTime.Format("2006-01-02 15:04:05"),
-					event.Data[i],
-				)
-			} else {
+			if !CompareTimes(prevTime.Add(SampleInterval), curTime) &&
+				curTime.Sub(prevTime) >= SampleInterval*3/2 {
 				fileInfo = fileInfo + fmt.Sprintf(
 					"No data recieved from server between %s and %s\n",
 					prevTime.Format("2006-01-02 15:04:05"),
 					curTime.Format("2006-01-02 15:04:05"),
 				)
-				fileInfo = fileInfo + fmt.Sprintf(
-					"%s - %f", curTime.Format("2006-01-02 15:04:05"),
-					event.Data[i],
-				)
 			}
 		}
 
+		fileInfo = fileInfo + fmt.Sprintf(
+			"%s - %s", curTime.Format("2006-01-02 15:04:05"),
+			reportValue(event.Data[i]),
+		)
+
 		if j < len(event.AlertTimes) {
 			if CompareTimes(event.AlertTimes[j], curTime) {
 				fileInfo = fileInfo + " ALERT"
@@ -338,11 +658,21 @@ func ReportText(event *Event) string {
 
 		fileInfo = fileInfo + "\n"
 		prevTime = curTime
+		first = false
+		missing = 0
 	}
 
 	return fileInfo
 }
 
+// Value of a sample in a report, NaN being a missing sample
+func reportValue(val float64) string {
+	if math.IsNaN(val) {
+		return "missing"
+	}
+	return fmt.Sprintf("%f", val)
+}
+
 // Check if two given times are within 500 milliseconds of each other
 func CompareTimes(t1 time.Time, t2 time.Time) bool {
 
@@ -394,26 +724,9 @@ func (display *EventDisplay) Draw(buf *ui.Buffer) {
 
 		event := display.Events[rowNum]
 
-		var eventCells []ui.Cell
-
-		// Check if current row is selected
-		if rowNum == display.SelectedRow && display.selected {
-			// Parse row text into cells
-			eventCells = ui.ParseStyles(
-				event.Description,
-				ui.NewStyle(
-					ui.ColorBlack, eventColors[event.EventType], ui.ModifierClear,
-				),
-			)
-		} else {
-			// Parse row text into cells
-			eventCells = ui.ParseStyles(
-				event.Description,
-				ui.NewStyle(
-					eventColors[event.EventType], ui.ColorClear, ui.ModifierClear,
-				),
-			)
-		}
+		eventCells := eventRowCells(
+			event, rowNum == display.SelectedRow && display.selected,
+		)
 
 		// Add padding for the rows
 		eventCells = ui.WrapCells(
@@ -454,6 +767,48 @@ func (display *EventDisplay) Draw(buf *ui.Buffer) {
 	display.EventLock.RUnlock()
 }
 
+// Text of an alert as cells, led by its severity and state
+// Firing alerts are bold, resolved ones are greyed out
+func eventRowCells(event *Event, selected bool) []ui.Cell {
+
+	severity := event.Severity
+	if _, ok := severityColors[severity]; !ok {
+		severity = SeverityWarning
+	}
+	state := event.CurState()
+
+	label := fmt.Sprintf("[%s, %s] ", severity, state)
+
+	labelColor := severityColors[severity]
+	textColor := eventColors[event.EventType]
+	modifier := ui.ModifierClear
+
+	switch state {
+	case StateFiring:
+		modifier = ui.ModifierBold
+	case StateResolved, StateExpired:
+		labelColor = colorGrey50
+		textColor = colorGrey50
+	}
+
+	if selected {
+		return append(
+			ui.ParseStyles(label, ui.NewStyle(ui.ColorBlack, labelColor, modifier)),
+			ui.ParseStyles(
+				event.Description,
+				ui.NewStyle(ui.ColorBlack, textColor, modifier),
+			)...,
+		)
+	}
+
+	return append(
+		ui.ParseStyles(label, ui.NewStyle(labelColor, ui.ColorClear, modifier)),
+		ui.ParseStyles(
+			event.Description, ui.NewStyle(textColor, ui.ColorClear, modifier),
+		)...,
+	)
+}
+
 // Handler function for scroll up
 func (display *EventDisplay) ScrollUp() {
 
@@ -555,8 +910,45 @@ func (display *EventDisplay) ReportEvent(path string) {
 
 	if event != nil {
 		// Generate report in a separate routine
-		go MakeReport(event, path)
+		display.reports.Add(1)
+		go func() {
+			defer display.reports.Done()
+			MakeReport(event, path)
+		}()
+	}
+}
+
+// Node and stat of the selected alert, empty if there is none
+func (display *EventDisplay) SelectedAlert() (string, string) {
+
+	display.EventLock.RLock()
+	defer display.EventLock.RUnlock()
+
+	if display.SelectedRow < 0 || display.SelectedRow >= len(display.Events) {
+		return "", ""
 	}
+
+	event := display.Events[display.SelectedRow]
+	return event.Node, event.Stat
+}
+
+// Acknowledge the selected alert if it is firing, returning whether it was
+func (display *EventDisplay) AcknowledgeEvent() bool {
+
+	display.EventLock.Lock()
+	defer display.EventLock.Unlock()
+
+	// Can go out of bounds immediately after an event expires
+	if display.SelectedRow < 0 || display.SelectedRow >= len(display.Events) {
+		return false
+	}
+
+	return display.Events[display.SelectedRow].SetState(StateAcknowledged)
+}
+
+// Wait for all the reports being generated to be written
+func (display *EventDisplay) WaitReports() {
+	display.reports.Wait()
 }
 
 // Handler function to indicate if cursor is on widget
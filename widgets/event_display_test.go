@@ -9,6 +9,7 @@
 package widgets
 
 import (
+	"math"
 	"testing"
 	"time"
 )
@@ -30,6 +31,7 @@ func TestReportText(t *testing.T) {
 				Threshold:     0.2,
 				LastTriggered: curTime,
 				ThresholdTime: 1,
+				ChangeWindow:  time.Second,
 				DataTimes: []time.Time{
 					curTime.Add(-time.Second * time.Duration(2)), curTime.Add(-time.Second), curTime, curTime.Add(time.Second), curTime.Add(time.Second * time.Duration(2)),
 				},
@@ -61,6 +63,7 @@ func TestReportText(t *testing.T) {
 				FirstTriggered: curTime.Add(-time.Second),
 				LastTriggered:  curTime.Add(time.Second),
 				ThresholdTime:  1,
+				ChangeWindow:   time.Second,
 				DataTimes: []time.Time{
 					curTime.Add(-time.Second * time.Duration(2)), curTime.Add(-time.Second), curTime, curTime.Add(time.Second), curTime.Add(time.Second * time.Duration(2)),
 				},
@@ -201,6 +204,92 @@ func TestReportText(t *testing.T) {
 				"No data recieved from server between 2001-01-01 01:01:29 and 2001-01-01 01:01:31\n" +
 				"2001-01-01 01:01:31 - 3.000000 ALERT\n",
 		},
+		{
+			event: &Event{
+				Node:          "node7",
+				Stat:          "stat7",
+				EventType:     "Above Threshold",
+				NumTimes:      1,
+				Threshold:     3,
+				LastTriggered: curTime.Add(time.Second),
+				DataTimes: []time.Time{
+					{}, curTime.Add(-time.Second * time.Duration(2)), {}, {}, curTime.Add(time.Second),
+				},
+				DataStart: curTime.Add(-time.Second * time.Duration(3)),
+				AlertTimes: []time.Time{
+					curTime.Add(time.Second),
+				},
+				Data: []float64{
+					math.NaN(), 1, math.NaN(), math.NaN(), 4,
+				},
+			},
+			reportText: "Node - node7\n" +
+				"Stat - stat7\n\n" +
+				"Stat exceeded threshold limit of 3.000000 at 2001-01-01 01:01:31.\n\n" +
+				"Data collected from 2001-01-01 01:01:28 to 2001-01-01 01:01:31\n\n" +
+				"No data recieved from server before 2001-01-01 01:01:28, 1 sample(s) missing\n" +
+				"2001-01-01 01:01:28 - 1.000000\n" +
+				"No data recieved from server between 2001-01-01 01:01:28 and 2001-01-01 01:01:31, 2 sample(s) missing\n" +
+				"2001-01-01 01:01:31 - 4.000000 ALERT\n",
+		},
+		{
+			event: &Event{
+				Node:            "node8",
+				Stat:            "stat8",
+				EventType:       "Sudden Decrease",
+				NumTimes:        1,
+				Threshold:       0.2,
+				ThresholdChange: 0.5,
+				LastTriggered:   curTime,
+				ThresholdTime:   1,
+				ChangeWindow:    time.Second,
+				DataTimes: []time.Time{
+					curTime.Add(-time.Second), curTime,
+				},
+				DataStart: curTime.Add(-time.Second),
+				AlertTimes: []time.Time{
+					curTime,
+				},
+				Data: []float64{
+					4, 2,
+				},
+			},
+			reportText: "Node - node8\n" +
+				"Stat - stat8\n\n" +
+				"Stat fell by 50.00%, more than the threshold limit of 20.00%, at 2001-01-01 01:01:30. This change occured over 1 second(s).\n\n" +
+				"Data collected from 2001-01-01 01:01:29 to 2001-01-01 01:01:30\n\n" +
+				"2001-01-01 01:01:29 - 4.000000\n" +
+				"2001-01-01 01:01:30 - 2.000000 ALERT\n",
+		},
+		// Three samples of a 10 second interval
+		{
+			event: &Event{
+				Node:            "node9",
+				Stat:            "stat9",
+				EventType:       "Rate of Change",
+				NumTimes:        1,
+				Threshold:       1,
+				ThresholdChange: 2,
+				LastTriggered:   curTime,
+				ThresholdTime:   3,
+				ChangeWindow:    30 * time.Second,
+				DataTimes: []time.Time{
+					curTime,
+				},
+				DataStart: curTime,
+				AlertTimes: []time.Time{
+					curTime,
+				},
+				Data: []float64{
+					60,
+				},
+			},
+			reportText: "Node - node9\n" +
+				"Stat - stat9\n\n" +
+				"Stat changed at 2.000000 per second, faster than the threshold limit of 1.000000 per second, at 2001-01-01 01:01:30. The rate was measured over 30 second(s).\n\n" +
+				"Data collected from 2001-01-01 01:01:30 to 2001-01-01 01:01:30\n\n" +
+				"2001-01-01 01:01:30 - 60.000000 ALERT\n",
+		},
 	}
 
 	for i, testCase := range testCases {
@@ -212,3 +301,35 @@ func TestReportText(t *testing.T) {
 		}
 	}
 }
+
+func TestEventState(t *testing.T) {
+
+	tests := []struct {
+		from     string
+		to       string
+		expected string
+	}{
+		{"", StateAcknowledged, StateAcknowledged},
+		{StateFiring, StateResolved, StateResolved},
+		{StateFiring, StateExpired, StateExpired},
+		{StateAcknowledged, StateResolved, StateResolved},
+		// Acknowledged alerts stay so while they keep triggering
+		{StateAcknowledged, StateFiring, StateAcknowledged},
+		{StateResolved, StateFiring, StateFiring},
+		{StateResolved, StateAcknowledged, StateResolved},
+		{StateExpired, StateFiring, StateExpired},
+	}
+
+	for i, test := range tests {
+		event := &Event{State: test.from}
+		event.SetState(test.to)
+
+		if event.CurState() != test.expected {
+			t.Errorf("Expected %v got %v %d", test.expected, event.CurState(), i)
+		}
+		if test.expected == StateResolved && test.from != StateResolved &&
+			event.ResolvedAt.IsZero() {
+			t.Errorf("Expected %v got %v %d", "resolved time", event.ResolvedAt, i)
+		}
+	}
+}
@@ -11,7 +11,9 @@ package widgets
 import (
 	"fmt"
 	"image"
+	"math"
 	"strconv"
+	"time"
 
 	ui "github.com/gizak/termui/v3"
 )
@@ -28,6 +30,13 @@ type LineGraph struct {
 	// Horizontal scaling of the graph
 	horizontalScale int
 
+	// Resolutions the lines are available at, finest first
+	resolutions []Resolution
+
+	// Number of samples of the finest resolution drawn as one point,
+	// raised to zoom out
+	zoom int
+
 	// Stat name corresponding to the graph
 	Stat string
 
@@ -52,6 +61,12 @@ type NodeData struct {
 	Active bool
 }
 
+// Time between two points of a line and the number of points held
+type Resolution struct {
+	Width time.Duration
+	Len   int
+}
+
 // Values of different paddings
 const (
 	xAxisLabelsHeight = 1
@@ -87,7 +102,8 @@ var (
 )
 
 // Initializes a new line graph
-func NewLineGraph(nodesList []string, graphNum int) *LineGraph {
+func NewLineGraph(nodesList []string, graphNum int,
+	resolutions []Resolution) *LineGraph {
 
 	var color ui.Color
 
@@ -103,6 +119,8 @@ func NewLineGraph(nodesList []string, graphNum int) *LineGraph {
 		statColor:       color,
 		Nodes:           make([]*NodeData, 0),
 		horizontalScale: 1,
+		resolutions:     resolutions,
+		zoom:            1,
 		legend:          false,
 		Selected:        false,
 	}
@@ -125,41 +143,51 @@ func NewLineGraph(nodesList []string, graphNum int) *LineGraph {
 }
 
 // Function to render the lines
+// Missing points (NaN) are left out so gaps show as breaks in the line
 func (graph *LineGraph) renderBraille(buf *ui.Buffer, drawArea image.Rectangle,
 	maxVal float64) {
 
 	canvas := ui.NewCanvas()
 	canvas.Rectangle = drawArea
 
+	height := func(val float64) int {
+		return int((val / maxVal) * float64(drawArea.Dy()-1))
+	}
+
 	for _, nodeData := range graph.Nodes {
 
-		line := nodeData.Line
+		line := graph.points(nodeData.Line)
 
 		// Check to prevent rendering of empty or deselected lines
 		if len(line) != 0 && nodeData.Active {
 
-			prevHeight := int((line[len(line)-1] / maxVal) *
-				float64(drawArea.Dy()-1))
+			prevVal := line[len(line)-1]
 
 			for j := 1; j < len(line)-1; j++ {
 
 				val := line[len(line)-1-j]
-				height := int((val / maxVal) * float64(drawArea.Dy()-1))
 
 				if (drawArea.Max.X - ((j - 1) * graph.horizontalScale)) >=
 					drawArea.Min.X {
 
-					canvas.SetLine(
-						image.Pt((drawArea.Max.X-(j*graph.horizontalScale))*2,
-							(drawArea.Max.Y-height-1)*4),
-						image.Pt(
-							(drawArea.Max.X-((j-1)*graph.horizontalScale))*2,
-							(drawArea.Max.Y-prevHeight-1)*4,
-						),
-						nodeData.color,
-					)
+					cur := image.Pt((drawArea.Max.X-(j*graph.horizontalScale))*2,
+						(drawArea.Max.Y-height(val)-1)*4)
+
+					if !math.IsNaN(val) && !math.IsNaN(prevVal) {
+						canvas.SetLine(
+							cur,
+							image.Pt(
+								(drawArea.Max.X-((j-1)*graph.horizontalScale))*2,
+								(drawArea.Max.Y-height(prevVal)-1)*4,
+							),
+							nodeData.color,
+						)
+					} else if !math.IsNaN(val) {
+						// Keep points next to a gap visible
+						canvas.SetPoint(cur, nodeData.color)
+					}
 				}
-				prevHeight = height
+				prevVal = val
 			}
 		}
 	}
@@ -217,8 +245,8 @@ func (graph *LineGraph) plotAxes(buf *ui.Buffer, maxVal float64) {
 		(xAxisLabelsGap)*graph.horizontalScale + 1; x < graph.Inner.Max.X-1; {
 
 		label := fmt.Sprintf(
-			"%d", (x-(graph.Inner.Min.X+yAxisLabelsWidth)-1)/
-				(graph.horizontalScale)+1,
+			"%d", ((x-(graph.Inner.Min.X+yAxisLabelsWidth)-1)/
+				(graph.horizontalScale)+1)*graph.zoom,
 		)
 		buf.SetString(
 			label, axesStyle, image.Pt(x, graph.Inner.Max.Y-1),
@@ -286,8 +314,14 @@ func (graph *LineGraph) Draw(buf *ui.Buffer) {
 
 // Render the stat corresponding to the graph
 func (graph *LineGraph) renderStat(buf *ui.Buffer) {
+
+	stat := graph.Stat
+	if graph.zoom > 1 {
+		stat = fmt.Sprintf("%s (1:%d)", stat, graph.zoom)
+	}
+
 	buf.SetString(
-		graph.Stat,
+		stat,
 		ui.NewStyle(
 			graph.statColor, ui.ColorClear, ui.ModifierClear,
 		),
@@ -327,7 +361,7 @@ func (graph *LineGraph) MaxData(dispLength int) float64 {
 	var maxData float64
 
 	for _, nodeData := range graph.Nodes {
-		line := nodeData.Line
+		line := graph.points(nodeData.Line)
 		if len(line) != 0 {
 			if len(line)-dispLength-1 >= 0 {
 				for _, val := range line[len(line)-dispLength-1:] {
@@ -348,6 +382,98 @@ func (graph *LineGraph) MaxData(dispLength int) float64 {
 	return maxData
 }
 
+// Index of the finest resolution holding enough data to fill the graph
+// at the current zoom, the lines are expected at this resolution
+func (graph *LineGraph) Resolution() int {
+
+	if len(graph.resolutions) == 0 {
+		return 0
+	}
+
+	span := graph.resolutions[0].Width *
+		time.Duration(graph.DispLength()*graph.zoom)
+
+	for i, resolution := range graph.resolutions {
+		if resolution.Width*time.Duration(resolution.Len) >= span {
+			return i
+		}
+	}
+
+	return len(graph.resolutions) - 1
+}
+
+// Number of points of the current resolution drawn as one point
+func (graph *LineGraph) factor() int {
+
+	if len(graph.resolutions) == 0 {
+		return graph.zoom
+	}
+
+	step := graph.resolutions[0].Width * time.Duration(graph.zoom)
+	width := graph.resolutions[graph.Resolution()].Width
+
+	if width <= 0 || step <= width {
+		return 1
+	}
+	return int((step + width - 1) / width)
+}
+
+// Reduce a line to one point per factor points, each point being the
+// largest of its points so that spikes stay visible when zoomed out
+func (graph *LineGraph) points(line []float64) []float64 {
+
+	factor := graph.factor()
+	if factor <= 1 {
+		return line
+	}
+
+	points := make([]float64, (len(line)+factor-1)/factor)
+
+	// Group from the newest point so the latest point is always complete
+	for i := range points {
+		end := len(line) - i*factor
+		start := end - factor
+		if start < 0 {
+			start = 0
+		}
+
+		// A point is only missing if all its points are
+		point := math.NaN()
+		for _, val := range line[start:end] {
+			if math.IsNaN(point) || val > point {
+				point = val
+			}
+		}
+		points[len(points)-1-i] = point
+	}
+
+	return points
+}
+
+// Handler to show more of the history in the graph, up to what the
+// coarsest resolution holds
+func (graph *LineGraph) ZoomOut() {
+
+	if len(graph.resolutions) == 0 {
+		return
+	}
+
+	coarsest := graph.resolutions[len(graph.resolutions)-1]
+	span := graph.resolutions[0].Width *
+		time.Duration(graph.DispLength()*graph.zoom)
+
+	if span < coarsest.Width*time.Duration(coarsest.Len) {
+		graph.zoom *= 2
+	}
+}
+
+// Handler to show the recent data in more detail
+func (graph *LineGraph) ZoomIn() {
+	if graph.zoom > 1 {
+		graph.zoom /= 2
+	}
+}
+
 // Handler to toggle display of the line corresponding to a node
 func (graph *LineGraph) SelectNode(node string) {
 
@@ -383,6 +509,22 @@ func (graph *LineGraph) RemoveNode(node string) {
 	}
 }
 
+// Handler to rename a node, keeping its line and color
+func (graph *LineGraph) RenameNode(node string, newName string) {
+
+	// Colors are shared by the graphs, the first one moves it
+	if color, ok := nodeColors[node]; ok {
+		delete(nodeColors, node)
+		nodeColors[newName] = color
+	}
+
+	for _, nodeData := range graph.Nodes {
+		if nodeData.Node == node {
+			nodeData.Node = newName
+		}
+	}
+}
+
 // Handler to toggle the display of legend
 func (graph *LineGraph) ToggleLegend() {
 	graph.legend = !graph.legend
@@ -0,0 +1,157 @@
+//  Copyright 2023-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included
+//  in the file licenses/BSL-Couchbase.txt.  As of the Change Date specified
+//  in that file, in accordance with the Business Source License, use of this
+//  software will be governed by the Apache License, Version 2.0, included in
+//  the file licenses/APL2.txt.
+
+package widgets
+
+import (
+	"math"
+	"reflect"
+	"testing"
+	"time"
+
+	ui "github.com/gizak/termui/v3"
+)
+
+func TestLineGraphZoom(t *testing.T) {
+
+	graph := NewLineGraph([]string{"node1"}, 1, []Resolution{
+		{Width: time.Second, Len: 40},
+	})
+
+	// Room for 11 points
+	graph.SetRect(0, 0, 16, 10)
+
+	line := []float64{1, 5, 2, 3, 0, 4, 6}
+
+	testCases := []struct {
+		action   func()
+		zoom     int
+		expected []float64
+	}{
+		{
+			action:   func() {},
+			zoom:     1,
+			expected: []float64{1, 5, 2, 3, 0, 4, 6},
+		},
+		{
+			action:   graph.ZoomOut,
+			zoom:     2,
+			expected: []float64{1, 5, 3, 6},
+		},
+		{
+			action:   graph.ZoomOut,
+			zoom:     4,
+			expected: []float64{5, 6},
+		},
+		// 11 points at 1:4 already cover the history
+		{
+			action:   graph.ZoomOut,
+			zoom:     4,
+			expected: []float64{5, 6},
+		},
+		{
+			action:   graph.ZoomIn,
+			zoom:     2,
+			expected: []float64{1, 5, 3, 6},
+		},
+	}
+
+	for i, testCase := range testCases {
+
+		testCase.action()
+
+		if graph.zoom != testCase.zoom {
+			t.Errorf("Expected %v got %v %d", testCase.zoom, graph.zoom, i)
+		}
+
+		points := graph.points(line)
+		if !reflect.DeepEqual(points, testCase.expected) {
+			t.Errorf("Expected %v got %v %d", testCase.expected, points, i)
+		}
+	}
+}
+
+func TestLineGraphResolution(t *testing.T) {
+
+	graph := NewLineGraph([]string{"node1"}, 1, []Resolution{
+		{Width: time.Second, Len: 20},
+		{Width: time.Second * time.Duration(10), Len: 30},
+		{Width: time.Minute, Len: 30},
+	})
+
+	// Room for 10 points
+	graph.SetRect(0, 0, 16, 10)
+
+	// Resolution and points of it per point after zooming out each time
+	testCases := []struct {
+		resolution int
+		factor     int
+	}{
+		{resolution: 0, factor: 1},
+		{resolution: 0, factor: 2},
+		{resolution: 1, factor: 1},
+		{resolution: 1, factor: 1},
+		{resolution: 1, factor: 2},
+		{resolution: 2, factor: 1},
+		{resolution: 2, factor: 2},
+		{resolution: 2, factor: 3},
+		{resolution: 2, factor: 5},
+		// Ten points at 1:256 already cover the coarsest resolution
+		{resolution: 2, factor: 5},
+	}
+
+	for i, testCase := range testCases {
+
+		if i > 0 {
+			graph.ZoomOut()
+		}
+
+		if graph.Resolution() != testCase.resolution {
+			t.Errorf("Expected %v got %v %d",
+				testCase.resolution, graph.Resolution(), i)
+		}
+		if graph.factor() != testCase.factor {
+			t.Errorf("Expected %v got %v %d", testCase.factor, graph.factor(), i)
+		}
+	}
+}
+
+func TestLineGraphGaps(t *testing.T) {
+
+	graph := NewLineGraph([]string{"node1"}, 1, []Resolution{
+		{Width: time.Second, Len: 40},
+	})
+	graph.SetRect(0, 0, 16, 10)
+	graph.ZoomOut()
+
+	nan := math.NaN()
+	line := []float64{1, nan, nan, nan, 2, nan, 3}
+
+	// Points are only missing when all the samples they cover are
+	expected := []float64{1, nan, 2, 3}
+	points := graph.points(line)
+
+	if len(points) != len(expected) {
+		t.Fatalf("Expected %v got %v", expected, points)
+	}
+	for i := range expected {
+		if points[i] != expected[i] && !(math.IsNaN(points[i]) && math.IsNaN(expected[i])) {
+			t.Errorf("Expected %v got %v %d", expected[i], points[i], i)
+		}
+	}
+
+	// Gaps never raise the scale of the graph
+	graph.Nodes[0].Line = line
+	if maxData := graph.MaxData(graph.DispLength()); maxData != 3 {
+		t.Errorf("Expected %v got %v", 3, maxData)
+	}
+
+	// Drawing a line with gaps must not fail
+	buf := ui.NewBuffer(graph.GetRect())
+	graph.Draw(buf)
+}
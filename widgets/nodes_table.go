@@ -311,6 +311,15 @@ func (table *NodesTable) RemoveNode(node string) {
 	table.Rows = tempRows
 }
 
+// Handler function to rename a row, keeping its toggle
+func (table *NodesTable) RenameNode(node string, newName string) {
+	for i, nodeName := range table.Rows {
+		if nodeName == node {
+			table.Rows[i] = newName
+		}
+	}
+}
+
 // Handler function to determins if pixel is within the widget
 func (table *NodesTable) Contains(x int, y int) bool {
 	if x > table.Min.X && x <= table.Max.X &&
@@ -54,37 +54,41 @@ func (popup *popup) ProcessText() {
 	// Max width of popup (Extended if a word larger than width exists)
 	maxWidth := 15
 
-	// Split text into words
-	words := strings.Fields(popup.text)
-	curWidth := 0
+	// Split text into words, each line of the text starts a new line
+	paragraphs := strings.Split(popup.text, "\n")
 
 	lines := make([]string, 0)
-	line := ""
 
 	// Adjust max width
-	for _, word := range words {
+	for _, word := range strings.Fields(popup.text) {
 		if len(word) > maxWidth {
 			maxWidth = len(word)
 		}
 	}
 
 	// Group words into lines
-	for _, word := range words {
-
-		if curWidth == 0 {
-			line = word
-			curWidth = len(word)
-		} else if curWidth+len(word)+1 <= maxWidth {
-			line = line + " " + word
-			curWidth = curWidth + len(word) + 1
-		} else {
-			lines = append(lines, line)
-			line = word
-			curWidth = len(word)
+	for _, paragraph := range paragraphs {
+
+		curWidth := 0
+		line := ""
+
+		for _, word := range strings.Fields(paragraph) {
+
+			if curWidth == 0 {
+				line = word
+				curWidth = len(word)
+			} else if curWidth+len(word)+1 <= maxWidth {
+				line = line + " " + word
+				curWidth = curWidth + len(word) + 1
+			} else {
+				lines = append(lines, line)
+				line = word
+				curWidth = len(word)
+			}
 		}
-	}
 
-	lines = append(lines, line)
+		lines = append(lines, line)
+	}
 
 	// Center align by padding with spaces
 	for _, line := range lines {
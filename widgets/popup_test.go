@@ -0,0 +1,49 @@
+//  Copyright 2023-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included
+//  in the file licenses/BSL-Couchbase.txt.  As of the Change Date specified
+//  in that file, in accordance with the Business Source License, use of this
+//  software will be governed by the Apache License, Version 2.0, included in
+//  the file licenses/APL2.txt.
+
+package widgets
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPopupText(t *testing.T) {
+
+	tests := []struct {
+		text     string
+		expected []string
+	}{
+		{
+			"Cluster undergoing rebalance",
+			[]string{"    Cluster    ", "  undergoing   ", "   rebalance   "},
+		},
+		// Each line of the text starts a new line
+		{
+			"Silenced alerts\nstat1 on node1",
+			[]string{"Silenced alerts", "stat1 on node1 "},
+		},
+	}
+
+	for i, test := range tests {
+		popup := NewPopup(test.text, "test", time.Now())
+		popup.ProcessText()
+
+		if len(popup.processedText) != len(test.expected) {
+			t.Errorf("Expected %q got %q %d", test.expected,
+				popup.processedText, i)
+			continue
+		}
+		for j := range test.expected {
+			if popup.processedText[j] != test.expected[j] {
+				t.Errorf("Expected %q got %q %d", test.expected[j],
+					popup.processedText[j], i)
+			}
+		}
+	}
+}
@@ -11,6 +11,7 @@ package widgets
 import (
 	"image"
 	"sort"
+	"strings"
 
 	ui "github.com/gizak/termui/v3"
 )
@@ -21,9 +22,17 @@ const (
 	stat2Color ui.Color = 165 // Magenta2
 )
 
+// Labels of the aggregate groups
+const (
+	allBucketsLabel = "* (all buckets)"
+	allIndexesLabel = "* (all indexes)"
+)
+
 // Widget to display a list of stats
+// Index level stats (bucket:index:stat) are shown as a tree of buckets and
+// indexes that can be expanded and collapsed
 // Each row displayed on one line
-// Allows selection of 2 rows with cursor on any row
+// Allows selection of 2 stats with cursor on any row
 type StatsTable struct {
 	*ui.Block
 
@@ -33,17 +42,30 @@ type StatsTable struct {
 	// Rows to be displayed
 	Rows []string
 
+	// Stat shown on each row, empty for bucket and index rows
+	RowStats []string
+
+	// Group shown on each row, eg. "travel:" or "travel:idx1:",
+	// empty for stat rows
+	rowGroups []string
+
 	// Array to track the number of lines used to display each row
 	RowSize []int
 
 	// Cursor position
 	SelectedRow int
 
-	// Selected row 1
-	Stat1 int
+	// Selected stat 1
+	Stat1 string
+
+	// Selected stat 2
+	Stat2 string
 
-	// Selected row 2
-	Stat2 int
+	// All the stats in sorted order
+	stats []string
+
+	// Groups currently expanded, all groups start collapsed
+	expanded map[string]bool
 
 	// Row currently displayed on the first line
 	TopRow int
@@ -60,14 +82,35 @@ func NewStatsTable() *StatsTable {
 		Header:      "List of Stats",
 		SelectedRow: 0,
 		TopRow:      0,
-		Stat1:       -1,
-		Stat2:       -1,
+		Stat1:       "",
+		Stat2:       "",
 		selected:    true,
 		Rows:        make([]string, 0),
+		RowStats:    make([]string, 0),
+		rowGroups:   make([]string, 0),
 		RowSize:     make([]int, 0),
+		stats:       make([]string, 0),
+		expanded:    make(map[string]bool),
 	}
 }
 
+// Split an index level stat into its bucket, index and stat name
+// Aggregates use "*" in place of the bucket or index
+// Returns false for node level stats and Prometheus stats
+func SplitStatKey(stat string) (string, string, string, bool) {
+
+	if strings.Contains(stat, "{") {
+		return "", "", "", false
+	}
+
+	parts := strings.Split(stat, ":")
+	if len(parts) != 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+		return "", "", "", false
+	}
+
+	return parts[0], parts[1], parts[2], true
+}
+
 // Render widget
 func (table *StatsTable) Draw(buf *ui.Buffer) {
 
@@ -118,7 +161,7 @@ func (table *StatsTable) Draw(buf *ui.Buffer) {
 		var rowCells []ui.Cell
 
 		// Check if the row is stat 1
-		if rowNum == table.Stat1 {
+		if table.holdsStat(rowNum, table.Stat1) {
 			// Check if cursor is on row
 			if rowNum == table.SelectedRow && table.selected {
 				rowCells = ui.ParseStyles(
@@ -136,7 +179,7 @@ func (table *StatsTable) Draw(buf *ui.Buffer) {
 				)
 			}
 			// Check if the row is stat 2
-		} else if rowNum == table.Stat2 {
+		} else if table.holdsStat(rowNum, table.Stat2) {
 			// Check if cursor is on row
 			if rowNum == table.SelectedRow && table.selected {
 				rowCells = ui.ParseStyles(
@@ -218,17 +261,125 @@ func (table *StatsTable) ToggleTableSelect() {
 }
 
 // Handler function to enable selection of a row
+// Only stat rows can be selected
 func (table *StatsTable) SelectGraph(graphNum int) {
 
-	if table.Stat2 != table.SelectedRow && table.Stat1 != table.SelectedRow {
+	stat := table.SelectedStat()
+
+	if stat != "" && table.Stat2 != stat && table.Stat1 != stat {
 		if graphNum == 1 {
-			table.Stat1 = table.SelectedRow
+			table.Stat1 = stat
 		} else {
-			table.Stat2 = table.SelectedRow
+			table.Stat2 = stat
 		}
 	}
 }
 
+// Stat on the row with the cursor, empty if on a bucket or index row
+func (table *StatsTable) SelectedStat() string {
+
+	if table.SelectedRow < 0 || table.SelectedRow >= len(table.RowStats) {
+		return ""
+	}
+
+	return table.RowStats[table.SelectedRow]
+}
+
+// Check if a row shows the stat, either directly or as a collapsed
+// group holding it
+func (table *StatsTable) holdsStat(rowNum int, stat string) bool {
+
+	if stat == "" {
+		return false
+	}
+
+	if table.RowStats[rowNum] != "" {
+		return table.RowStats[rowNum] == stat
+	}
+
+	group := table.rowGroups[rowNum]
+
+	return !table.expanded[group] && strings.HasPrefix(stat, group)
+}
+
+// Handler function to expand the bucket or index with the cursor
+func (table *StatsTable) Expand() {
+
+	if table.SelectedRow < 0 || table.SelectedRow >= len(table.rowGroups) {
+		return
+	}
+
+	group := table.rowGroups[table.SelectedRow]
+	if group != "" && !table.expanded[group] {
+		table.expanded[group] = true
+		table.rebuild(group)
+	}
+}
+
+// Handler function to collapse the bucket or index with the cursor
+// Collapses the enclosing group if the cursor is on a collapsed group or
+// on a stat, moving the cursor to it
+func (table *StatsTable) Collapse() {
+
+	if table.SelectedRow < 0 || table.SelectedRow >= len(table.rowGroups) {
+		return
+	}
+
+	group := table.rowGroups[table.SelectedRow]
+	if group != "" && table.expanded[group] {
+		table.expanded[group] = false
+		table.rebuild(group)
+		return
+	}
+
+	id := group
+	if id == "" {
+		id = table.RowStats[table.SelectedRow]
+	}
+
+	parent := parentGroup(id)
+	if parent != "" {
+		table.expanded[parent] = false
+		table.rebuild(parent)
+	}
+}
+
+// Handler function to toggle the bucket or index with the cursor
+func (table *StatsTable) ToggleGroup() {
+
+	if table.SelectedRow < 0 || table.SelectedRow >= len(table.rowGroups) {
+		return
+	}
+
+	group := table.rowGroups[table.SelectedRow]
+	if group == "" {
+		return
+	}
+
+	table.expanded[group] = !table.expanded[group]
+	table.rebuild(group)
+}
+
+// Group directly enclosing a stat or group, empty for the top level
+func parentGroup(id string) string {
+
+	if strings.HasSuffix(id, ":") {
+		// Index group, eg. travel:idx1:
+		parts := strings.Split(id, ":")
+		if len(parts) == 3 {
+			return parts[0] + ":"
+		}
+		return ""
+	}
+
+	bucket, index, _, ok := SplitStatKey(id)
+	if !ok {
+		return ""
+	}
+
+	return bucket + ":" + index + ":"
+}
+
 // Handler function for mouse click
 func (table *StatsTable) HandleClick(x int, y int) {
 	x = x - table.Min.X
@@ -307,20 +458,170 @@ func (table *StatsTable) Contains(x int, y int) bool {
 // Handler function to add a new stat in a sorted order
 func (table *StatsTable) AddStat(stat string) {
 
-	index := sort.SearchStrings(table.Rows, stat)
-	table.Rows = append(table.Rows, "")
-	copy(table.Rows[index+1:], table.Rows[index:])
-	table.Rows[index] = stat
+	index := sort.SearchStrings(table.stats, stat)
+	if index < len(table.stats) && table.stats[index] == stat {
+		return
+	}
+
+	table.stats = append(table.stats, "")
+	copy(table.stats[index+1:], table.stats[index:])
+	table.stats[index] = stat
 
+	table.rebuild(table.cursorID())
 }
 
 // Handler function to remove a stat
 func (table *StatsTable) RemoveStat(stat string) {
 
-	for i, row := range table.Rows {
+	for i, row := range table.stats {
 		if row == stat {
-			table.Rows = append(table.Rows[:i], table.Rows[i+1:]...)
+			table.stats = append(table.stats[:i], table.stats[i+1:]...)
+			table.rebuild(table.cursorID())
 			return
 		}
 	}
 }
+
+// Stat or group on the row with the cursor
+func (table *StatsTable) cursorID() string {
+
+	if table.SelectedRow < 0 || table.SelectedRow >= len(table.RowStats) {
+		return ""
+	}
+
+	if table.RowStats[table.SelectedRow] != "" {
+		return table.RowStats[table.SelectedRow]
+	}
+
+	return table.rowGroups[table.SelectedRow]
+}
+
+// Order buckets and indexes with the aggregate first
+func sortGroupNames(names []string) {
+	sort.Slice(names, func(i, j int) bool {
+		if names[i] == "*" || names[j] == "*" {
+			return names[i] == "*" && names[j] != "*"
+		}
+		return names[i] < names[j]
+	})
+}
+
+// Rebuild the rows from the stats and the expanded groups
+// The cursor is kept on the row for id, or on the collapsed group
+// now holding it
+func (table *StatsTable) rebuild(id string) {
+
+	rows := make([]string, 0, len(table.stats))
+	rowStats := make([]string, 0, len(table.stats))
+	rowGroups := make([]string, 0)
+
+	// Index level stats by bucket and index
+	tree := make(map[string]map[string][]string)
+
+	// Node level stats first
+	for _, stat := range table.stats {
+		bucket, index, name, ok := SplitStatKey(stat)
+		if !ok {
+			rows = append(rows, stat)
+			rowStats = append(rowStats, stat)
+			rowGroups = append(rowGroups, "")
+			continue
+		}
+
+		if _, ok := tree[bucket]; !ok {
+			tree[bucket] = make(map[string][]string)
+		}
+		tree[bucket][index] = append(tree[bucket][index], name)
+	}
+
+	buckets := make([]string, 0, len(tree))
+	for bucket := range tree {
+		buckets = append(buckets, bucket)
+	}
+	sortGroupNames(buckets)
+
+	addGroup := func(label string, group string, depth int) {
+		arrow := "▸ "
+		if table.expanded[group] {
+			arrow = "▾ "
+		}
+		rows = append(rows, strings.Repeat("  ", depth)+arrow+label)
+		rowStats = append(rowStats, "")
+		rowGroups = append(rowGroups, group)
+	}
+
+	for _, bucket := range buckets {
+
+		bucketGroup := bucket + ":"
+		label := bucket
+		if bucket == "*" {
+			label = allBucketsLabel
+		}
+		addGroup(label, bucketGroup, 0)
+
+		if !table.expanded[bucketGroup] {
+			continue
+		}
+
+		indexes := make([]string, 0, len(tree[bucket]))
+		for index := range tree[bucket] {
+			indexes = append(indexes, index)
+		}
+		sortGroupNames(indexes)
+
+		for _, index := range indexes {
+
+			indexGroup := bucketGroup + index + ":"
+			label := index
+			if index == "*" {
+				label = allIndexesLabel
+			}
+			addGroup(label, indexGroup, 1)
+
+			if !table.expanded[indexGroup] {
+				continue
+			}
+
+			// Names are already sorted since the stats are
+			for _, name := range tree[bucket][index] {
+				rows = append(rows, "    "+name)
+				rowStats = append(rowStats, indexGroup+name)
+				rowGroups = append(rowGroups, "")
+			}
+		}
+	}
+
+	table.Rows = rows
+	table.RowStats = rowStats
+	table.rowGroups = rowGroups
+
+	// Sizes are recalculated on the next render
+	table.RowSize = make([]int, len(rows))
+	for i := range table.RowSize {
+		table.RowSize[i] = 1
+	}
+
+	// Move the cursor to the row for id or the closest enclosing group
+	for found := false; id != "" && !found; id = parentGroup(id) {
+		for i := range rows {
+			if rowStats[i] == id || rowGroups[i] == id {
+				table.SelectedRow = i
+				found = true
+				break
+			}
+		}
+	}
+
+	if table.SelectedRow > len(rows)-1 {
+		table.SelectedRow = len(rows) - 1
+	}
+	if table.SelectedRow < 0 {
+		table.SelectedRow = 0
+	}
+
+	// Scrolling depends on the size of the widget, not known before the
+	// first render
+	if !table.Inner.Empty() {
+		table.CalcPos()
+	}
+}
@@ -0,0 +1,124 @@
+//  Copyright 2023-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included
+//  in the file licenses/BSL-Couchbase.txt.  As of the Change Date specified
+//  in that file, in accordance with the Business Source License, use of this
+//  software will be governed by the Apache License, Version 2.0, included in
+//  the file licenses/APL2.txt.
+
+package widgets
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestStatsTableTree(t *testing.T) {
+
+	table := NewStatsTable()
+
+	for _, stat := range []string{
+		"travel:idx2:doc_count", "pct_cpu_gc", "travel:idx1:doc_count",
+		"travel:*:doc_count", "beer:idx3:doc_count", "*:*:doc_count",
+		"travel:idx1:num_mutations", "kv_ops{bucket=\"travel\"}",
+	} {
+		table.AddStat(stat)
+	}
+
+	// Cursor on a row, followed by the action and the expected rows
+	testCases := []struct {
+		cursor   string
+		action   func()
+		rows     []string
+		selected string
+	}{
+		{
+			action: func() {},
+			rows: []string{
+				"kv_ops{bucket=\"travel\"}", "pct_cpu_gc",
+				"▸ " + allBucketsLabel, "▸ beer", "▸ travel",
+			},
+		},
+		{
+			cursor: "▸ travel",
+			action: table.Expand,
+			rows: []string{
+				"kv_ops{bucket=\"travel\"}", "pct_cpu_gc",
+				"▸ " + allBucketsLabel, "▸ beer", "▾ travel",
+				"  ▸ " + allIndexesLabel, "  ▸ idx1", "  ▸ idx2",
+			},
+		},
+		{
+			cursor: "  ▸ idx1",
+			action: table.ToggleGroup,
+			rows: []string{
+				"kv_ops{bucket=\"travel\"}", "pct_cpu_gc",
+				"▸ " + allBucketsLabel, "▸ beer", "▾ travel",
+				"  ▸ " + allIndexesLabel, "  ▾ idx1",
+				"    doc_count", "    num_mutations", "  ▸ idx2",
+			},
+		},
+		// Collapsing on a stat collapses its index
+		{
+			cursor: "    num_mutations",
+			action: table.Collapse,
+			rows: []string{
+				"kv_ops{bucket=\"travel\"}", "pct_cpu_gc",
+				"▸ " + allBucketsLabel, "▸ beer", "▾ travel",
+				"  ▸ " + allIndexesLabel, "  ▸ idx1", "  ▸ idx2",
+			},
+			selected: "  ▸ idx1",
+		},
+		{
+			cursor: "▾ travel",
+			action: table.Collapse,
+			rows: []string{
+				"kv_ops{bucket=\"travel\"}", "pct_cpu_gc",
+				"▸ " + allBucketsLabel, "▸ beer", "▸ travel",
+			},
+			selected: "▸ travel",
+		},
+	}
+
+	for i, testCase := range testCases {
+
+		if testCase.cursor != "" {
+			for row, text := range table.Rows {
+				if text == testCase.cursor {
+					table.SelectedRow = row
+				}
+			}
+		}
+
+		testCase.action()
+
+		if !reflect.DeepEqual(table.Rows, testCase.rows) {
+			t.Errorf("Expected %v got %v %d", testCase.rows, table.Rows, i)
+			continue
+		}
+
+		if testCase.selected != "" &&
+			table.Rows[table.SelectedRow] != testCase.selected {
+			t.Errorf("Expected %v got %v %d",
+				testCase.selected, table.Rows[table.SelectedRow], i)
+		}
+	}
+
+	// Selecting a stat keeps it while the table changes
+	table.SelectedRow = 1
+	table.SelectGraph(1)
+	table.AddStat("avg_queries_latency")
+
+	if table.Stat1 != "pct_cpu_gc" || table.SelectedStat() != "pct_cpu_gc" {
+		t.Errorf("Expected %v got %v %v", "pct_cpu_gc",
+			table.Stat1, table.SelectedStat())
+	}
+
+	// Bucket and index rows cannot be graphed
+	table.SelectedRow = 3
+	table.SelectGraph(2)
+
+	if table.Stat2 != "" {
+		t.Errorf("Expected %v got %v", "", table.Stat2)
+	}
+}